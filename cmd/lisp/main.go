@@ -0,0 +1,55 @@
+// Command lisp is an interactive Lisp interpreter.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/yourmodule/lisp"
+)
+
+func myTop() {
+	fmt.Println("Simple LISP Interpreter in Go (Using MY-EVAL)")
+	fmt.Println("Type 'exit' to quit.")
+
+	interp := lisp.New()
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("> ")
+		// Read input from the user.
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			panic(err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "exit" {
+			break
+		}
+		if line == "" {
+			continue
+		}
+		// Parse the input into an S-expression.
+		expr, err := interp.Read(line)
+		if err != nil {
+			fmt.Println("Error:", err)
+			continue
+		}
+		// Evaluate the S-expression.
+		vals, err := interp.EvalValues(expr)
+		if err != nil {
+			fmt.Println("Error:", err)
+			continue
+		}
+		// Print each value of the evaluation on its own line.
+		for _, v := range vals {
+			fmt.Println(lisp.Format(v))
+		}
+	}
+}
+
+// main function starts the REPL.
+func main() {
+	myTop()
+}
@@ -0,0 +1,761 @@
+package lisp
+
+import (
+	"strings"
+)
+
+// Before the machine evaluates a form, the form is analyzed once into an
+// analysis: a Go closure that performs it, with its special form resolved,
+// the builtin it calls looked up, its lexical variables resolved to frame
+// addresses and its subforms already analyzed. The bodies of lambdas and
+// defuns are analyzed the first time they are called and reused by every
+// later call, so the machine does not look at the list structure of a form,
+// compare its head symbol or search for a variable again.
+
+// An analysis is an analyzed form. exec evaluates it on the machine. For
+// forms that need no machine steps, such as constants and variables, value
+// evaluates them directly.
+type analysis struct {
+	exec  func(m *machine, env *environment)
+	value func(m *machine, env *environment) interface{}
+}
+
+// A scope is what the analyzer knows of an environment: the names of the
+// variables of one frame, in the order of its values, and the scope of the
+// enclosing frame. The scope without a parent is the global environment,
+// which has no frame. specials holds the variables declared special for the
+// forms in the scope, which are not lexical there even if an enclosing
+// frame binds them.
+type scope struct {
+	in       *Interpreter
+	names    []string
+	specials map[string]bool
+	parent   *scope
+}
+
+// globalScope returns the scope of the global environment.
+func (in *Interpreter) globalScope() *scope {
+	return &scope{in: in}
+}
+
+// child returns the scope of a frame binding names, inside sc.
+func (sc *scope) child(names []string) *scope {
+	return &scope{in: sc.in, names: names, parent: sc}
+}
+
+// resolve returns the address of the innermost lexical binding of name: the
+// number of frames to go up from the current one and the index of its value
+// there. Special variables are never lexical.
+func (sc *scope) resolve(name string) (depth, index int, ok bool) {
+	if sc.in.isSpecial(name) {
+		return 0, 0, false
+	}
+	for ; sc.parent != nil; sc = sc.parent {
+		if sc.specials[name] {
+			return 0, 0, false
+		}
+		for i := len(sc.names) - 1; i >= 0; i-- {
+			if sc.names[i] == name {
+				return depth, i, true
+			}
+		}
+		depth++
+	}
+	return 0, 0, false
+}
+
+// variable returns functions that read and assign the variable name: its
+// lexical binding if it has one in sc, or else its global value.
+func (sc *scope) variable(name string) (get func(in *Interpreter, env *environment) interface{}, set func(in *Interpreter, env *environment, v interface{}) interface{}) {
+	if depth, index, ok := sc.resolve(name); ok {
+		get = func(_ *Interpreter, env *environment) interface{} { return *env.at(depth, index) }
+		set = func(_ *Interpreter, env *environment, v interface{}) interface{} {
+			*env.at(depth, index) = v
+			return v
+		}
+		return get, set
+	}
+	get = func(in *Interpreter, _ *environment) interface{} { return in.globalValue(name) }
+	set = func(in *Interpreter, _ *environment, v interface{}) interface{} { return in.setGlobal(name, v) }
+	return get, set
+}
+
+// bodyCode is the body of a lambda or defun, analyzed in the scope of its
+// parameters on first use and shared by every closure created from the same
+// lambda expression. dynamic holds the indices of the parameters that are
+// special, or declared special at the start of the body, which are bound
+// dynamically.
+type bodyCode struct {
+	forms   []interface{}
+	scope   *scope
+	dynamic []int
+	code    []*analysis
+	done    bool
+}
+
+// analyzed returns the analyses of the body forms.
+func (b *bodyCode) analyzed() []*analysis {
+	if !b.done {
+		b.code, b.done = b.scope.analyzeAll(b.forms), true
+	}
+	return b.code
+}
+
+// directAnalysis returns the analysis of a form evaluated by value.
+func directAnalysis(value func(m *machine, env *environment) interface{}) *analysis {
+	return &analysis{value: value, exec: func(m *machine, env *environment) { m.ret(value(m, env)) }}
+}
+
+// constantAnalysis returns the analysis of a form whose value is x.
+func constantAnalysis(x interface{}) *analysis {
+	return directAnalysis(func(*machine, *environment) interface{} { return x })
+}
+
+// specialForms holds the forms the analyzer resolves itself rather than
+// calling a function of that name.
+var specialForms = map[string]bool{
+	"QUOTE": true, "LAMBDA": true, "FUNCTION": true, "NOT": true, "IF": true, "COND": true,
+	"AND": true, "OR": true, "PROGN": true, "SETQ": true, "EVAL": true, "FUNCALL": true,
+	"APPLY": true, "LET": true, "LET*": true, "UNWIND-PROTECT": true, "MULTIPLE-VALUE-BIND": true,
+	"MULTIPLE-VALUE-LIST": true, "MULTIPLE-VALUE-CALL": true, "NTH-VALUE": true, "DO-GENERATOR": true,
+	"DEFUN": true, "DEFSTRUCT": true, "DEFVAR": true, "DEFPARAMETER": true, "DEFCONSTANT": true,
+	"DECLARE": true, "SETF": true, "INCF": true, "DECF": true, "PUSH": true, "POP": true,
+	"PUSHNEW": true, "ROTATEF": true, "SHIFTF": true, "DEFSETF": true, "DEFINE-SETF-EXPANDER": true,
+	"DELAY": true, "STREAM-CONS": true, "IGNORE-ERRORS": true, "HANDLER-CASE": true,
+}
+
+// analyzeAll analyzes a list of forms.
+func (sc *scope) analyzeAll(forms []interface{}) []*analysis {
+	code := make([]*analysis, len(forms))
+	for i, f := range forms {
+		code[i] = sc.analyze(f)
+	}
+	return code
+}
+
+// analyze analyzes a form.
+func (sc *scope) analyze(expr interface{}) *analysis {
+	switch v := expr.(type) {
+	case string:
+		switch strings.ToUpper(v) {
+		case "T":
+			return constantAnalysis("T")
+		case "NIL":
+			return constantAnalysis(nil)
+		}
+		get, _ := sc.variable(v)
+		return directAnalysis(func(m *machine, env *environment) interface{} { return get(m.in, env) })
+	case *cons:
+		return sc.analyzeForm(v)
+	}
+	return constantAnalysis(expr)
+}
+
+// analyzeForm analyzes a compound form: a special form or a function call.
+func (sc *scope) analyzeForm(c *cons) *analysis {
+	form, _ := listElements(c)
+	// A lambda expression in function position is applied directly.
+	if lambda, ok := listElements(form[0]); ok && len(lambda) > 0 && isSymbol(lambda[0], "LAMBDA") {
+		makeFn := sc.analyzeLambda(lambda[1:])
+		args := sc.analyzeAll(form[1:])
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.evalArgs(args, env, false, func(m *machine, vals []interface{}) {
+				m.apply(makeFn(env), vals)
+			})
+		}}
+	}
+	fnSym, ok := form[0].(string)
+	if !ok {
+		panic("Invalid function: must be a symbol")
+	}
+	args := form[1:]
+	up := strings.ToUpper(fnSym)
+	switch up {
+	case "QUOTE":
+		if len(args) != 1 {
+			panic("quote expects exactly one argument")
+		}
+		return constantAnalysis(args[0])
+	case "LAMBDA":
+		// A lambda expression evaluates to a closure over the current environment.
+		makeFn := sc.analyzeLambda(args)
+		return directAnalysis(func(_ *machine, env *environment) interface{} { return makeFn(env) })
+	case "FUNCTION":
+		// (function name) is the function named by a symbol; (function (lambda ...)) is a closure.
+		if len(args) != 1 {
+			panic("function expects 1 argument")
+		}
+		if lambda, ok := listElements(args[0]); ok && len(lambda) > 0 && isSymbol(lambda[0], "LAMBDA") {
+			makeFn := sc.analyzeLambda(lambda[1:])
+			return directAnalysis(func(_ *machine, env *environment) interface{} { return makeFn(env) })
+		}
+		name, ok := args[0].(string)
+		if !ok {
+			panic("function expects a symbol or a lambda expression")
+		}
+		return directAnalysis(func(m *machine, _ *environment) interface{} { return m.in.functionValue(name) })
+	case "IF":
+		return sc.analyzeIf(args)
+	case "COND":
+		return sc.analyzeCond(args)
+	case "AND", "OR":
+		return analyzeAndOr(up == "OR", sc.analyzeAll(args))
+	case "NOT":
+		if len(args) != 1 {
+			panic("not expects 1 argument")
+		}
+		arg := sc.analyze(args[0])
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.push(func(m *machine, v interface{}) { m.ret(boolToT(isNil(primary(v)))) })
+			m.exec(arg, env)
+		}}
+	case "PROGN":
+		if sc.parent == nil {
+			return sc.analyzeToplevelProgn(args)
+		}
+		body := sc.analyzeAll(args)
+		return &analysis{exec: func(m *machine, env *environment) { m.evalBody(body, env) }}
+	case "SETQ":
+		return sc.analyzeSetq(args)
+	case "EVAL":
+		// (eval form) evaluates form in the global environment.
+		if len(args) != 1 {
+			panic("eval expects 1 argument")
+		}
+		arg := sc.analyze(args[0])
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.push(func(m *machine, v interface{}) { m.eval(primary(v)) })
+			m.exec(arg, env)
+		}}
+	case "FUNCALL":
+		// (funcall f arg...) calls f with the args.
+		if len(args) < 1 {
+			panic("funcall expects a function")
+		}
+		code := sc.analyzeAll(args)
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.evalArgs(code, env, false, func(m *machine, vals []interface{}) {
+				m.apply(vals[0], vals[1:])
+			})
+		}}
+	case "APPLY":
+		// (apply f arg... list) calls f with the args followed by the elements of list.
+		if len(args) < 2 {
+			panic("apply expects at least 2 arguments")
+		}
+		code := sc.analyzeAll(args)
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.evalArgs(code, env, false, func(m *machine, vals []interface{}) {
+				argList := append(vals[1:len(vals)-1:len(vals)-1], toList(vals[len(vals)-1])...)
+				m.apply(vals[0], argList)
+			})
+		}}
+	case "LET", "LET*":
+		return sc.analyzeLet(up == "LET*", args)
+	case "UNWIND-PROTECT":
+		// (unwind-protect protected cleanup...) evaluates the cleanup forms
+		// however the protected form is exited.
+		if len(args) < 1 {
+			panic("unwind-protect expects a protected form")
+		}
+		protected, cleanup := sc.analyze(args[0]), sc.analyzeAll(args[1:])
+		return &analysis{exec: func(m *machine, env *environment) {
+			in := m.in
+			m.pushRestore(in.winds)
+			in.enterWind(nil, func() { in.execute(func(m *machine) { m.evalBody(cleanup, env) }) })
+			m.exec(protected, env)
+		}}
+	case "MULTIPLE-VALUE-BIND":
+		return sc.analyzeMultipleValueBind(args)
+	case "MULTIPLE-VALUE-LIST":
+		// (multiple-value-list form) returns a list of all the values of form.
+		if len(args) != 1 {
+			panic("multiple-value-list expects 1 argument")
+		}
+		arg := sc.analyze(args[0])
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.push(func(m *machine, v interface{}) { m.ret(makeList(valuesOf(v)...)) })
+			m.exec(arg, env)
+		}}
+	case "MULTIPLE-VALUE-CALL":
+		// (multiple-value-call fn forms...) calls fn with all the values of all the forms.
+		if len(args) < 1 {
+			panic("multiple-value-call expects a function")
+		}
+		fn, code := sc.analyze(args[0]), sc.analyzeAll(args[1:])
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.push(func(m *machine, f interface{}) {
+				m.evalArgs(code, env, true, func(m *machine, vals []interface{}) {
+					m.apply(primary(f), vals)
+				})
+			})
+			m.exec(fn, env)
+		}}
+	case "NTH-VALUE":
+		// (nth-value n form) returns the nth value of form, or NIL.
+		if len(args) != 2 {
+			panic("nth-value expects 2 arguments")
+		}
+		n, arg := sc.analyze(args[0]), sc.analyze(args[1])
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.push(func(m *machine, nv interface{}) {
+				i := nthIndex(primary(nv))
+				m.push(func(m *machine, v interface{}) {
+					if vals := valuesOf(v); i < len(vals) {
+						m.ret(vals[i])
+						return
+					}
+					m.ret(nil)
+				})
+				m.exec(arg, env)
+			})
+			m.exec(n, env)
+		}}
+	case "DO-GENERATOR":
+		return sc.analyzeDoGenerator(args)
+	case "DEFUN":
+		return sc.analyzeDefun(args)
+	case "DEFSTRUCT":
+		return directAnalysis(func(m *machine, _ *environment) interface{} { return m.in.myEvalDefstruct(args) })
+	case "DEFVAR", "DEFPARAMETER", "DEFCONSTANT":
+		return sc.analyzeDefvar(up, args)
+	case "DECLARE":
+		// Declarations only have an effect at the start of a body.
+		return constantAnalysis(nil)
+	case "SETF":
+		return sc.analyzeSetf(args)
+	case "INCF", "DECF", "PUSH", "POP", "PUSHNEW", "ROTATEF", "SHIFTF":
+		return sc.analyzeModify(up, args)
+	case "DEFSETF":
+		return sc.analyzeDefsetf(args)
+	case "DEFINE-SETF-EXPANDER":
+		return sc.analyzeDefineSetfExpander(args)
+	case "DELAY":
+		return sc.analyzeDelay(args)
+	case "STREAM-CONS":
+		return sc.analyzeStreamCons(args)
+	case "IGNORE-ERRORS":
+		return sc.analyzeIgnoreErrors(args)
+	case "HANDLER-CASE":
+		return sc.analyzeHandlerCase(args)
+	}
+	// A builtin is called directly unless the symbol has since been defined
+	// as a function.
+	b := builtins[up]
+	code := sc.analyzeAll(args)
+	return &analysis{exec: func(m *machine, env *environment) {
+		m.evalArgs(code, env, false, func(m *machine, vals []interface{}) {
+			if b != nil && !m.in.isUserFunction(fnSym) {
+				m.callBuiltin(b, vals)
+				return
+			}
+			m.applyNamed(fnSym, up, vals)
+		})
+	}}
+}
+
+// analyzeLambda analyzes the rest of a (lambda (formals...) body...) form,
+// returning a function that creates its closure in an environment.
+func (sc *scope) analyzeLambda(lambda []interface{}) func(env *environment) *closure {
+	if len(lambda) < 1 {
+		panic("lambda: must have (lambda (args...) body...)")
+	}
+	formals, ok := listElements(lambda[0])
+	if !ok {
+		panic("lambda: first argument must be a list of formals")
+	}
+	return sc.analyzeFunction(formals, lambda[1:])
+}
+
+// analyzeFunction analyzes a function of the given formals and body,
+// returning a function that creates its closure in an environment.
+func (sc *scope) analyzeFunction(formals, body []interface{}) func(env *environment) *closure {
+	declared, forms := declaredSpecials(body)
+	code := &bodyCode{forms: forms}
+	names := make([]string, len(formals))
+	for i, f := range formals {
+		names[i] = symbolArg(f, "Formal parameters must be symbols")
+		if sc.in.isSpecial(names[i]) || declared[names[i]] {
+			code.dynamic = append(code.dynamic, i)
+		}
+	}
+	code.scope = sc.child(names)
+	code.scope.specials = declared
+	return func(env *environment) *closure {
+		return &closure{formals: formals, body: body, env: env, in: sc.in, code: code}
+	}
+}
+
+// analyzeDefun analyzes a (defun name (formals...) body...) form, which
+// defines a global function closed over the environment of the defun.
+func (sc *scope) analyzeDefun(args []interface{}) *analysis {
+	if len(args) < 3 {
+		panic("defun: must have (defun fname (args...) body...)")
+	}
+	fname, ok := args[0].(string)
+	if !ok {
+		panic("defun: first argument must be a symbol")
+	}
+	formals, ok := listElements(args[1])
+	if !ok {
+		panic("defun: second argument must be a list of formals")
+	}
+	makeFn := sc.analyzeFunction(formals, args[2:])
+	return directAnalysis(func(m *machine, env *environment) interface{} {
+		f := makeFn(env)
+		f.name = fname
+		m.in.globals[fname] = f
+		return fname
+	})
+}
+
+// analyzeIf analyzes an (if condition then [else]) form.
+func (sc *scope) analyzeIf(args []interface{}) *analysis {
+	if len(args) < 2 || len(args) > 3 {
+		panic("if expects (if condition then [else])")
+	}
+	test, then := sc.analyze(args[0]), sc.analyze(args[1])
+	var otherwise *analysis
+	if len(args) == 3 {
+		otherwise = sc.analyze(args[2])
+	}
+	return &analysis{exec: func(m *machine, env *environment) {
+		m.push(func(m *machine, v interface{}) {
+			switch {
+			case !isNil(primary(v)):
+				m.exec(then, env)
+			case otherwise != nil:
+				m.exec(otherwise, env)
+			default:
+				m.ret(nil)
+			}
+		})
+		m.exec(test, env)
+	}}
+}
+
+// A condClause is an analyzed cond clause.
+type condClause struct {
+	test *analysis
+	body []*analysis
+}
+
+// analyzeCond analyzes a cond expression, which is a series of condition-action clauses.
+func (sc *scope) analyzeCond(args []interface{}) *analysis {
+	clauses := make([]condClause, len(args))
+	for i, c := range args {
+		clause, ok := listElements(c)
+		if !ok || len(clause) == 0 {
+			panic("cond: each clause must be a non-empty list")
+		}
+		clauses[i] = condClause{sc.analyze(clause[0]), sc.analyzeAll(clause[1:])}
+	}
+	return &analysis{exec: func(m *machine, env *environment) { m.evalCond(clauses, env) }}
+}
+
+// evalCond evaluates the cond clauses in turn, returning NIL if no condition is true.
+func (m *machine) evalCond(clauses []condClause, env *environment) {
+	if len(clauses) == 0 {
+		m.ret(nil)
+		return
+	}
+	m.push(func(m *machine, v interface{}) {
+		if !isNil(primary(v)) {
+			m.evalBody(clauses[0].body, env)
+			return
+		}
+		m.evalCond(clauses[1:], env)
+	})
+	m.exec(clauses[0].test, env)
+}
+
+// analyzeAndOr analyzes an and form (stop false) or an or form (stop true).
+// and returns NIL as soon as an argument is NIL and T otherwise; or returns
+// T as soon as an argument is not NIL and NIL otherwise.
+func analyzeAndOr(stop bool, code []*analysis) *analysis {
+	var exec func(m *machine, env *environment, code []*analysis)
+	exec = func(m *machine, env *environment, code []*analysis) {
+		if len(code) == 0 {
+			m.ret(boolToT(!stop))
+			return
+		}
+		m.push(func(m *machine, v interface{}) {
+			if isNil(primary(v)) != stop {
+				m.ret(boolToT(stop))
+				return
+			}
+			exec(m, env, code[1:])
+		})
+		m.exec(code[0], env)
+	}
+	return &analysis{exec: func(m *machine, env *environment) { exec(m, env, code) }}
+}
+
+// analyzeSetq analyzes a (setq var value) form, which assigns to the
+// innermost lexical binding of var, or to its global value.
+func (sc *scope) analyzeSetq(args []interface{}) *analysis {
+	if len(args) != 2 {
+		panic("setq expects 2 arguments")
+	}
+	varName, ok := args[0].(string)
+	if !ok {
+		panic("setq: first argument must be a symbol")
+	}
+	_, set := sc.variable(varName)
+	value := sc.analyze(args[1])
+	return &analysis{exec: func(m *machine, env *environment) {
+		m.push(func(m *machine, v interface{}) {
+			m.ret(set(m.in, env, primary(v)))
+		})
+		m.exec(value, env)
+	}}
+}
+
+// analyzeMultipleValueBind analyzes a
+// (multiple-value-bind (vars...) values-form body...) form, which binds each
+// variable to the matching value, or NIL if there are fewer values.
+func (sc *scope) analyzeMultipleValueBind(args []interface{}) *analysis {
+	if len(args) < 2 {
+		panic("multiple-value-bind expects (vars...), a values form and a body")
+	}
+	vars, ok := listElements(args[0])
+	if !ok {
+		panic("multiple-value-bind: first argument must be a list of variables")
+	}
+	names := make([]string, len(vars))
+	for i, x := range vars {
+		names[i] = symbolArg(x, "multiple-value-bind: variable name must be a symbol")
+	}
+	valuesForm, body := sc.analyze(args[1]), sc.child(names).analyzeAll(args[2:])
+	return &analysis{exec: func(m *machine, env *environment) {
+		m.push(func(m *machine, v interface{}) {
+			vals := make([]interface{}, len(names))
+			copy(vals, valuesOf(v))
+			m.evalBody(body, &environment{values: vals, parent: env})
+		})
+		m.exec(valuesForm, env)
+	}}
+}
+
+// analyzeLet analyzes a let or let* form: ((var val)...) followed by a body.
+// let evaluates every value in the enclosing environment before binding any
+// variable; let* binds each variable before evaluating the next value.
+// Special variables, and variables declared special at the start of the
+// body, are bound dynamically: their global values change for the extent of
+// the body and are restored however it is exited. The other variables of a
+// let share a frame; each lexical variable of a let* gets a frame of its
+// own, so a closure made by a later value form sees only the variables
+// before it.
+func (sc *scope) analyzeLet(sequential bool, args []interface{}) *analysis {
+	name := "let"
+	if sequential {
+		name = "let*"
+	}
+	if len(args) < 1 {
+		panic(name + " expects ((var val)...) and a body")
+	}
+	bindings, ok := listElements(args[0])
+	if !ok {
+		panic(name + ": first argument must be a list of bindings")
+	}
+	declared, bodyForms := declaredSpecials(args[1:])
+	names := make([]string, len(bindings))
+	valForms := make([]interface{}, len(bindings))
+	dynamic := make([]bool, len(bindings))
+	anyDynamic := false
+	for i, b := range bindings {
+		// A binding is (var val), (var) or a bare var, bound to NIL.
+		varSpec := b
+		if pair, ok := listElements(b); ok && b != nil {
+			if len(pair) < 1 || len(pair) > 2 {
+				panic(name + ": each binding must be (var val)")
+			}
+			varSpec = pair[0]
+			if len(pair) == 2 {
+				valForms[i] = pair[1]
+			}
+		}
+		varName, ok := varSpec.(string)
+		if !ok {
+			panic(name + ": variable name must be a symbol")
+		}
+		names[i] = varName
+		dynamic[i] = sc.in.isSpecial(varName) || declared[varName]
+		anyDynamic = anyDynamic || dynamic[i]
+	}
+	// checkConstants panics if the let binds a constant.
+	checkConstants := func(in *Interpreter) {
+		for _, varName := range names {
+			if in.isConstant(varName) {
+				panic(name + ": cannot bind the constant " + varName)
+			}
+		}
+	}
+	if !sequential {
+		values := sc.analyzeAll(valForms)
+		var lexical []string
+		for i, varName := range names {
+			if !dynamic[i] {
+				lexical = append(lexical, varName)
+			}
+		}
+		inner := sc.child(lexical)
+		inner.specials = declared
+		body := inner.analyzeAll(bodyForms)
+		return &analysis{exec: func(m *machine, env *environment) {
+			checkConstants(m.in)
+			if anyDynamic {
+				m.pushRestore(m.in.winds)
+			}
+			m.evalArgs(values, env, false, func(m *machine, vals []interface{}) {
+				local := &environment{values: make([]interface{}, 0, len(lexical)), parent: env}
+				for i, varName := range names {
+					if dynamic[i] {
+						m.in.bindSpecial(varName, vals[i])
+					} else {
+						local.values = append(local.values, vals[i])
+					}
+				}
+				m.evalBody(body, local)
+			})
+		}}
+	}
+	values := make([]*analysis, len(names))
+	inner := sc
+	for i, varName := range names {
+		values[i] = inner.analyze(valForms[i])
+		if !dynamic[i] {
+			inner = inner.child([]string{varName})
+		}
+	}
+	// Declarations apply to the body, which gets a frame of its own for them.
+	if len(declared) > 0 {
+		inner = inner.child(nil)
+		inner.specials = declared
+	}
+	body := inner.analyzeAll(bodyForms)
+	var next func(m *machine, i int, env *environment)
+	next = func(m *machine, i int, env *environment) {
+		if i == len(names) {
+			if len(declared) > 0 {
+				env = &environment{parent: env}
+			}
+			m.evalBody(body, env)
+			return
+		}
+		m.push(func(m *machine, v interface{}) {
+			if dynamic[i] {
+				m.in.bindSpecial(names[i], primary(v))
+				next(m, i+1, env)
+				return
+			}
+			next(m, i+1, &environment{values: []interface{}{primary(v)}, parent: env})
+		})
+		m.exec(values[i], env)
+	}
+	return &analysis{exec: func(m *machine, env *environment) {
+		checkConstants(m.in)
+		if anyDynamic {
+			m.pushRestore(m.in.winds)
+		}
+		next(m, 0, env)
+	}}
+}
+
+// analyzeDoGenerator analyzes a (do-generator (var generator [result]) body...)
+// form, which evaluates the body with var bound to each value of the
+// generator, then the result.
+func (sc *scope) analyzeDoGenerator(args []interface{}) *analysis {
+	if len(args) < 1 {
+		panic("do-generator expects (var generator [result]) and a body")
+	}
+	spec, ok := listElements(args[0])
+	if !ok || len(spec) < 2 || len(spec) > 3 {
+		panic("do-generator expects (var generator [result]) and a body")
+	}
+	varName := symbolArg(spec[0], "do-generator: variable name must be a symbol")
+	inner := sc.child([]string{varName})
+	gen, result, body := sc.analyze(spec[1]), inner.analyzeAll(spec[2:]), inner.analyzeAll(args[1:])
+	return &analysis{exec: func(m *machine, env *environment) {
+		m.push(func(m *machine, v interface{}) {
+			g := generatorArg(primary(v), "do-generator expects a generator")
+			local := &environment{values: []interface{}{nil}, parent: env}
+			m.doGenerator(g, result, body, local)
+		})
+		m.exec(gen, env)
+	}}
+}
+
+// analyzeToplevelProgn analyzes a progn form in the global scope. As in CL,
+// its forms are processed as toplevel forms in turn: each is analyzed when
+// it is first reached, after the forms before it have run, so that a defvar
+// among them makes its variable special for the forms that follow.
+func (sc *scope) analyzeToplevelProgn(forms []interface{}) *analysis {
+	code := make([]*analysis, len(forms))
+	var run func(m *machine, i int)
+	run = func(m *machine, i int) {
+		if i == len(forms) {
+			m.ret(nil)
+			return
+		}
+		if code[i] == nil {
+			code[i] = sc.analyze(forms[i])
+		}
+		if i < len(forms)-1 {
+			m.push(func(m *machine, _ interface{}) { run(m, i+1) })
+		}
+		m.exec(code[i], nil)
+	}
+	return &analysis{exec: func(m *machine, _ *environment) { run(m, 0) }}
+}
+
+// evalArgs evaluates the analyzed forms, then calls then with their values.
+// With all, every value of each form is collected rather than just the
+// primary one.
+func (m *machine) evalArgs(code []*analysis, env *environment, all bool, then func(m *machine, vals []interface{})) {
+	m.evalArgsFrom(code, env, 0, nil, all, then)
+}
+
+// evalArgsFrom continues evalArgs from the form i, with done holding the
+// values collected from the forms before it. Forms with a direct value are
+// evaluated without a machine step; a frame is pushed for each other form.
+func (m *machine) evalArgsFrom(code []*analysis, env *environment, i int, done []interface{}, all bool, then func(m *machine, vals []interface{})) {
+	for ; i < len(code); i++ {
+		a := code[i]
+		if a.value != nil {
+			if all {
+				done = append(done, valuesOf(a.value(m, env))...)
+			} else {
+				done = append(done, primary(a.value(m, env)))
+			}
+			continue
+		}
+		n, i := len(done), i
+		m.push(func(m *machine, v interface{}) {
+			// Copy, so that resuming this frame again starts from the same values.
+			next := done[:n:n]
+			if all {
+				next = append(next, valuesOf(v)...)
+			} else {
+				next = append(next, primary(v))
+			}
+			m.evalArgsFrom(code, env, i+1, next, all, then)
+		})
+		m.exec(a, env)
+		return
+	}
+	then(m, done)
+}
+
+// evalBody evaluates analyzed forms in sequence, returning all the values of
+// the last, which is evaluated in tail position.
+func (m *machine) evalBody(code []*analysis, env *environment) {
+	if len(code) == 0 {
+		m.ret(nil)
+		return
+	}
+	if len(code) > 1 {
+		m.push(func(m *machine, _ interface{}) { m.evalBody(code[1:], env) })
+	}
+	m.exec(code[0], env)
+}
@@ -0,0 +1,269 @@
+package lisp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A lispArray is a Lisp array. Elements are stored in row-major order in data
+// and dims holds the size of each dimension. A one-dimensional array is a
+// vector, which may have a fill pointer marking how many of its elements are
+// active, and may be adjustable, letting vector-push-extend grow it.
+type lispArray struct {
+	data        []interface{}
+	dims        []int
+	fillPointer int // -1 when the vector has no fill pointer
+	adjustable  bool
+}
+
+// newVector creates a simple vector holding elems.
+func newVector(elems []interface{}) *lispArray {
+	return &lispArray{data: elems, dims: []int{len(elems)}, fillPointer: -1}
+}
+
+// isVector checks if the array is one-dimensional.
+func (a *lispArray) isVector() bool {
+	return len(a.dims) == 1
+}
+
+// length returns the number of active elements of a vector.
+func (a *lispArray) length() int {
+	if a.fillPointer >= 0 {
+		return a.fillPointer
+	}
+	return a.dims[0]
+}
+
+// elements returns the active elements of a vector.
+func (a *lispArray) elements() []interface{} {
+	return a.data[:a.length()]
+}
+
+// arrayArg checks that x is an array, panicking with msg otherwise.
+func arrayArg(x interface{}, msg string) *lispArray {
+	a, ok := x.(*lispArray)
+	if !ok {
+		panic(msg)
+	}
+	return a
+}
+
+// vectorArg checks that x is a vector, panicking with msg otherwise.
+func vectorArg(x interface{}, msg string) *lispArray {
+	a, ok := x.(*lispArray)
+	if !ok || !a.isVector() {
+		panic(msg)
+	}
+	return a
+}
+
+// arrayDimensions converts the dimensions argument of make-array, a single
+// size or a list of sizes, to a slice of ints.
+func arrayDimensions(x interface{}) []int {
+	var dims []int
+	for _, d := range toList(x) {
+		n, ok := d.(int)
+		if !ok || n < 0 {
+			panic("make-array: dimensions must be non-negative integers")
+		}
+		dims = append(dims, n)
+	}
+	return dims
+}
+
+// makeArray creates an array with the given dimensions. The keyword arguments
+// are those of make-array: INITIAL-ELEMENT, INITIAL-CONTENTS, ADJUSTABLE and
+// FILL-POINTER.
+func makeArray(dims []int, kwargs map[string]interface{}) *lispArray {
+	size := 1
+	for _, d := range dims {
+		size *= d
+	}
+	a := &lispArray{data: make([]interface{}, size), dims: dims, fillPointer: -1}
+	if init, ok := kwargs["INITIAL-ELEMENT"]; ok {
+		for i := range a.data {
+			a.data[i] = init
+		}
+	}
+	if contents, ok := kwargs["INITIAL-CONTENTS"]; ok {
+		flat := flattenContents(contents, dims)
+		copy(a.data, flat)
+	}
+	a.adjustable = !isNil(kwargs["ADJUSTABLE"])
+	if fp, ok := kwargs["FILL-POINTER"]; ok && !isNil(fp) {
+		if len(dims) != 1 {
+			panic("make-array: only vectors can have a fill pointer")
+		}
+		a.fillPointer = dims[0]
+		if n, isInt := fp.(int); isInt {
+			if n < 0 || n > dims[0] {
+				panic("make-array: fill pointer out of range")
+			}
+			a.fillPointer = n
+		}
+	}
+	return a
+}
+
+// flattenContents flattens nested initial contents into row-major order,
+// checking that their shape matches dims.
+func flattenContents(contents interface{}, dims []int) []interface{} {
+	if len(dims) == 0 {
+		return []interface{}{contents}
+	}
+	elems := sequenceElements(contents, "make-array: initial contents must be sequences")
+	if len(elems) != dims[0] {
+		panic("make-array: initial contents do not match the dimensions")
+	}
+	var flat []interface{}
+	for _, e := range elems {
+		flat = append(flat, flattenContents(e, dims[1:])...)
+	}
+	return flat
+}
+
+// rowMajorIndex converts subscripts to an index into the array's data.
+func (a *lispArray) rowMajorIndex(subscripts []interface{}) int {
+	if len(subscripts) != len(a.dims) {
+		panic("aref: wrong number of subscripts for array of rank " + strconv.Itoa(len(a.dims)))
+	}
+	index := 0
+	for i, s := range subscripts {
+		n, ok := s.(int)
+		if !ok || n < 0 || n >= a.dims[i] {
+			panic("aref: index " + toLispString(s) + " out of bounds")
+		}
+		index = index*a.dims[i] + n
+	}
+	return index
+}
+
+// aref returns the element of an array or string at the given subscripts.
+func aref(array interface{}, subscripts []interface{}) interface{} {
+	if s, ok := array.(*lispString); ok {
+		i := stringIndex(s, subscripts)
+		return lispChar(s.runes[i])
+	}
+	a := arrayArg(array, "aref expects an array")
+	return a.data[a.rowMajorIndex(subscripts)]
+}
+
+// setAref stores value in an array or string at the given subscripts.
+func setAref(array interface{}, subscripts []interface{}, value interface{}) interface{} {
+	if s, ok := array.(*lispString); ok {
+		i := stringIndex(s, subscripts)
+		s.runes[i] = rune(charArg(value, "aref: a string can only hold characters"))
+		return value
+	}
+	a := arrayArg(array, "aref expects an array")
+	a.data[a.rowMajorIndex(subscripts)] = value
+	return value
+}
+
+// stringIndex checks a single subscript into a string.
+func stringIndex(s *lispString, subscripts []interface{}) int {
+	if len(subscripts) != 1 {
+		panic("aref: strings take exactly one subscript")
+	}
+	i, ok := subscripts[0].(int)
+	if !ok || i < 0 || i >= len(s.runes) {
+		panic("aref: index " + toLispString(subscripts[0]) + " out of bounds")
+	}
+	return i
+}
+
+// vectorPush stores value at the fill pointer of a vector and advances it.
+// When the vector is full, vector-push returns NIL while vector-push-extend
+// grows the vector by at least extension elements.
+func vectorPush(value interface{}, a *lispArray, extend bool, extension int) interface{} {
+	if a.fillPointer < 0 {
+		panic("vector-push: vector has no fill pointer")
+	}
+	if a.fillPointer == len(a.data) {
+		if !extend {
+			return nil
+		}
+		if !a.adjustable {
+			panic("vector-push-extend: vector is not adjustable")
+		}
+		if extension < len(a.data) {
+			extension = len(a.data)
+		}
+		if extension < 1 {
+			extension = 1
+		}
+		a.data = append(a.data, make([]interface{}, extension)...)
+		a.dims[0] = len(a.data)
+	}
+	a.data[a.fillPointer] = value
+	a.fillPointer++
+	return a.fillPointer - 1
+}
+
+// formatArray prints a vector as #(...) and other arrays as #nA(...), with
+// nested lists for each dimension.
+func (p *printer) formatArray(a *lispArray) string {
+	if a.isVector() {
+		parts := make([]string, a.length())
+		for i, e := range a.elements() {
+			parts[i] = p.printObject(e)
+		}
+		return "#(" + strings.Join(parts, " ") + ")"
+	}
+	return "#" + strconv.Itoa(len(a.dims)) + "A" + p.formatArrayContents(a.data, a.dims)
+}
+
+// formatArrayContents prints row-major data with the given dimensions as nested lists.
+func (p *printer) formatArrayContents(data []interface{}, dims []int) string {
+	if len(dims) == 0 {
+		return p.printObject(data[0])
+	}
+	stride := len(data)
+	if dims[0] > 0 {
+		stride /= dims[0]
+	}
+	parts := make([]string, dims[0])
+	for i := range parts {
+		parts[i] = p.formatArrayContents(data[i*stride:(i+1)*stride], dims[1:])
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// readArrayLiteral builds the array denoted by #(...) (rank 1) or #nA(...).
+func readArrayLiteral(rank int, contents interface{}) *lispArray {
+	if rank == 1 {
+		return newVector(append([]interface{}(nil), toList(contents)...))
+	}
+	// The dimensions are taken from the first element at each level.
+	var dims []int
+	level := contents
+	for i := 0; i < rank; i++ {
+		elems := sequenceElements(level, "#A: contents must be nested lists")
+		dims = append(dims, len(elems))
+		if len(elems) > 0 {
+			level = elems[0]
+		}
+	}
+	return makeArray(dims, map[string]interface{}{"INITIAL-CONTENTS": contents})
+}
+
+// equalpArrays checks if two arrays have the same dimensions and EQUALP elements.
+func equalpArrays(a, b *lispArray) bool {
+	if len(a.dims) != len(b.dims) {
+		return false
+	}
+	if a.isVector() {
+		return equalFold(listOrNil(a.elements()), listOrNil(b.elements()))
+	}
+	for i := range a.dims {
+		if a.dims[i] != b.dims[i] {
+			return false
+		}
+	}
+	return equalFold(listOrNil(a.data), listOrNil(b.data))
+}
+
+// listOrNil returns a fresh list of elems, or NIL when it is empty.
+func listOrNil(elems []interface{}) interface{} {
+	return makeList(elems...)
+}
@@ -0,0 +1,188 @@
+package lisp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A builtin is a function implemented in Go. Builtins are registered by
+// name in builtins, which the evaluator consults when a symbol that is not
+// defined as a function is called, and (function name) returns the builtin
+// itself, so builtins can be passed around and inspected like any other
+// function. A builtin's arguments are counted against its arity before fn
+// is called. A pure builtin has no side effects and does not call back into
+// Lisp. A machine builtin, such as mapcar, has a machine function that calls
+// back into Lisp on the machine running it rather than in a nested run, so
+// its callbacks can yield and continuations captured in them can be resumed;
+// its fn runs machine in a run of its own.
+type builtin struct {
+	name    string
+	fn      func(args []interface{}, in *Interpreter) interface{}
+	machine func(m *machine, args []interface{})
+	minArgs int
+	maxArgs int
+	doc     string
+	pure    bool
+}
+
+// many is the maximum arity of a builtin that takes any number of arguments.
+const many = -1
+
+// Purity flags for defBuiltin.
+const (
+	impure = false
+	pure   = true
+)
+
+// builtins maps upper-case names to the builtin functions.
+var builtins = make(map[string]*builtin)
+
+// defBuiltin registers a builtin under an upper-case name.
+func defBuiltin(name string, minArgs, maxArgs int, pure bool, doc string, fn func(args []interface{}, in *Interpreter) interface{}) {
+	builtins[name] = &builtin{name: strings.ToLower(name), fn: fn, minArgs: minArgs, maxArgs: maxArgs, doc: doc, pure: pure}
+}
+
+// defBuiltins registers a builtin under several upper-case names. fn
+// receives the name it was called by.
+func defBuiltins(names []string, minArgs, maxArgs int, pure bool, doc string, fn func(up string, args []interface{}, in *Interpreter) interface{}) {
+	for _, name := range names {
+		up := name
+		defBuiltin(name, minArgs, maxArgs, pure, doc, func(args []interface{}, in *Interpreter) interface{} {
+			return fn(up, args, in)
+		})
+	}
+}
+
+// defMachineBuiltins registers a machine builtin under several upper-case
+// names. run receives the name it was called by and, like the exec function
+// of an analysis, leaves the machine returning a value or evaluating a form.
+func defMachineBuiltins(names []string, minArgs, maxArgs int, doc string, run func(up string, m *machine, args []interface{})) {
+	for _, name := range names {
+		up := name
+		b := &builtin{name: strings.ToLower(name), minArgs: minArgs, maxArgs: maxArgs, doc: doc, pure: impure}
+		b.machine = func(m *machine, args []interface{}) { run(up, m, args) }
+		b.fn = func(args []interface{}, in *Interpreter) interface{} {
+			return in.execute(func(m *machine) { b.machine(m, args) })
+		}
+		builtins[name] = b
+	}
+}
+
+// checkArgs checks the number of arguments passed to the builtin.
+func (b *builtin) checkArgs(args []interface{}) {
+	if len(args) < b.minArgs || (b.maxArgs != many && len(args) > b.maxArgs) {
+		panic(b.name + " expects " + b.arity())
+	}
+}
+
+// call checks the number of arguments and calls the builtin.
+func (b *builtin) call(args []interface{}, in *Interpreter) interface{} {
+	b.checkArgs(args)
+	return b.fn(args, in)
+}
+
+// callBuiltin makes the machine call a builtin, on the machine itself if it
+// is a machine builtin.
+func (m *machine) callBuiltin(b *builtin, args []interface{}) {
+	if b.machine == nil {
+		m.ret(b.call(args, m.in))
+		return
+	}
+	b.checkArgs(args)
+	b.machine(m, args)
+}
+
+// arity describes the number of arguments the builtin takes.
+func (b *builtin) arity() string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case b.maxArgs == many && b.minArgs == 0:
+		return "any number of arguments"
+	case b.maxArgs == many:
+		return "at least " + plural(b.minArgs)
+	case b.minArgs == b.maxArgs:
+		return plural(b.minArgs)
+	case b.minArgs == 0:
+		return "at most " + plural(b.maxArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", b.minArgs, b.maxArgs)
+}
+
+// lookupBuiltin returns the builtin called by name, or nil if there is none
+// or name is defined as a function, which then takes precedence.
+func (in *Interpreter) lookupBuiltin(name string) *builtin {
+	if b, ok := in.globals[name].(*builtin); ok {
+		return b
+	}
+	if in.isUserFunction(name) {
+		return nil
+	}
+	return builtins[strings.ToUpper(name)]
+}
+
+// namedBuiltin returns the builtin a symbol names, such as a Go function
+// registered under it, or nil.
+func (in *Interpreter) namedBuiltin(name string) *builtin {
+	if b, ok := in.globals[name].(*builtin); ok {
+		return b
+	}
+	return builtins[strings.ToUpper(name)]
+}
+
+// functionValue returns the function named by a symbol: its builtin, or the
+// symbol itself, which calls whatever it is defined as when applied.
+func (in *Interpreter) functionValue(name string) interface{} {
+	if b := in.lookupBuiltin(name); b != nil {
+		return b
+	}
+	return name
+}
+
+// builtinArg returns the builtin named by a symbol or given as a builtin
+// object, or panics with msg.
+func (in *Interpreter) builtinArg(x interface{}, msg string) *builtin {
+	switch v := x.(type) {
+	case *builtin:
+		return v
+	case string:
+		if b := in.namedBuiltin(v); b != nil {
+			return b
+		}
+	}
+	panic(msg)
+}
+
+// formatBuiltin prints a builtin in unreadable #<...> syntax.
+func formatBuiltin(b *builtin) string {
+	return "#<BUILTIN-FUNCTION " + b.name + ">"
+}
+
+// The builtins that describe builtins.
+func init() {
+	defBuiltin("DOCUMENTATION", 1, 2, pure, "(documentation function [doc-type]) returns the docstring of a builtin, or NIL.", func(args []interface{}, in *Interpreter) interface{} {
+		switch f := args[0].(type) {
+		case *builtin:
+			return newLispString(f.doc)
+		case string:
+			if b := in.namedBuiltin(f); b != nil {
+				return newLispString(b.doc)
+			}
+		}
+		return nil
+	})
+	defBuiltin("FUNCTION-ARITY", 1, 1, pure, "Return the least and greatest number of arguments a builtin takes, the greatest being NIL if there is no limit.", func(args []interface{}, in *Interpreter) interface{} {
+		b := in.builtinArg(args[0], "function-arity expects a builtin function")
+		if b.maxArgs == many {
+			return values(b.minArgs, nil)
+		}
+		return values(b.minArgs, b.maxArgs)
+	})
+	defBuiltin("FUNCTION-PURE-P", 1, 1, pure, "Check if a builtin has no side effects and does not call back into Lisp.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(in.builtinArg(args[0], "function-pure-p expects a builtin function").pure)
+	})
+}
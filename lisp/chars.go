@@ -0,0 +1,127 @@
+package lisp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A lispChar is a Lisp character. Characters are read with #\ syntax, either
+// as a single character (#\a), a name (#\Space) or a code point (#\U+03BB).
+type lispChar rune
+
+// charNames maps the names accepted after #\ to their characters. Lookups
+// are case-insensitive, so the keys are upper case.
+var charNames = map[string]lispChar{
+	"SPACE":     ' ',
+	"NEWLINE":   '\n',
+	"LINEFEED":  '\n',
+	"TAB":       '\t',
+	"RETURN":    '\r',
+	"PAGE":      '\f',
+	"BACKSPACE": '\b',
+	"RUBOUT":    0x7f,
+	"NULL":      0,
+	"NUL":       0,
+	"ESCAPE":    0x1b,
+}
+
+// charPrintNames gives the name each named character is printed with.
+var charPrintNames = map[lispChar]string{
+	' ':  "Space",
+	'\n': "Newline",
+	'\t': "Tab",
+	'\r': "Return",
+	'\f': "Page",
+	'\b': "Backspace",
+	0x7f: "Rubout",
+	0:    "Null",
+	0x1b: "Escape",
+}
+
+// parseCharacter parses the text following #\ in a character literal.
+func parseCharacter(name string) lispChar {
+	if name == "" {
+		panic("incomplete character literal")
+	}
+	if r, size := utf8.DecodeRuneInString(name); size == len(name) {
+		return lispChar(r)
+	}
+	up := strings.ToUpper(name)
+	if c, ok := charNames[up]; ok {
+		return c
+	}
+	if strings.HasPrefix(up, "U+") {
+		if code, err := strconv.ParseUint(up[2:], 16, 32); err == nil && utf8.ValidRune(rune(code)) {
+			return lispChar(code)
+		}
+	}
+	panic("unknown character name: " + name)
+}
+
+// formatChar prints a character in #\ syntax so that it reads back as the
+// same character. Named characters use their names and characters outside
+// printable ASCII use their code points.
+func formatChar(c lispChar) string {
+	if name, ok := charPrintNames[c]; ok {
+		return `#\` + name
+	}
+	if c > ' ' && c < 0x7f {
+		return `#\` + string(rune(c))
+	}
+	return fmt.Sprintf(`#\U+%04X`, rune(c))
+}
+
+// charArg checks that x is a character, panicking with msg otherwise.
+func charArg(x interface{}, msg string) lispChar {
+	c, ok := x.(lispChar)
+	if !ok {
+		panic(msg)
+	}
+	return c
+}
+
+// charCompareChain applies the comparison op (CHAR=, CHAR/=, CHAR<, CHAR>,
+// CHAR<=, CHAR>= or CHAR-EQUAL) to one or more characters, with the same
+// chaining rules as numCompareChain.
+func charCompareChain(op string, args []interface{}) bool {
+	name := strings.ToLower(op)
+	if len(args) < 1 {
+		panic(name + " expects at least one argument")
+	}
+	codes := make([]interface{}, len(args))
+	for i, a := range args {
+		c := charArg(a, name+" expects characters")
+		if op == "CHAR-EQUAL" {
+			c = lispChar(unicode.ToUpper(rune(c)))
+		}
+		codes[i] = int(c)
+	}
+	switch op {
+	case "CHAR=", "CHAR-EQUAL":
+		return numCompareChain("=", codes)
+	}
+	return numCompareChain(strings.TrimPrefix(op, "CHAR"), codes)
+}
+
+// digitWeight returns the value of c as a digit in the given radix, or -1
+// if it is not a digit in that radix.
+func digitWeight(c lispChar, radix int) int {
+	var w int
+	switch {
+	case c >= '0' && c <= '9':
+		w = int(c - '0')
+	case c >= 'a' && c <= 'z':
+		w = int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		w = int(c-'A') + 10
+	default:
+		return -1
+	}
+	if w >= radix {
+		return -1
+	}
+	return w
+}
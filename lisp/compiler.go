@@ -0,0 +1,685 @@
+package lisp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The compiler turns the body of a lambda or defun into bytecode for a
+// small stack machine. Parameters and let variables live in numbered slots
+// resolved at compile time, if, cond, and and or become jumps, and calls to
+// common builtins with a fixed number of arguments become their own
+// opcodes. Forms the compiler does not handle, such as lambda or a let that
+// binds special variables, are compiled into an instruction that hands them
+// to the interpreter with the slots visible to them. Compiled code runs on
+// the same machine as interpreted code: calls to functions that are not
+// builtins and fallbacks leave the bytecode loop with a frame that resumes
+// it, so generators, continuations and deep recursion work in compiled code
+// as they do in interpreted code.
+
+// An opcode is a bytecode instruction.
+type opcode byte
+
+const (
+	opConst     opcode = iota // push consts[a]
+	opLocal                   // push slots[a]
+	opSetLocal                // store the top of the stack in slots[a]
+	opGlobal                  // push the value of the symbol consts[a]
+	opSetGlobal               // assign the top of the stack to the symbol consts[a]
+	opEnv                     // push the value b of the frame a levels up from env
+	opSetEnv                  // store the top of the stack in the value b of the frame a levels up from env
+	opPop                     // discard the top of the stack
+	opJump                    // continue at a
+	opJumpIfNil               // pop a value and continue at a if it is NIL
+	opCall                    // call the function named consts[a] with b arguments
+	opTailCall                // reenter this function with new arguments
+	opReturn                  // return the top of the stack
+	opEval                    // evaluate the fallback consts[a] with the interpreter
+	opCar
+	opCdr
+	opCons
+	opNull
+	opAtom
+	opEq
+	opEqual
+	opAdd
+	opSub
+	opMul
+	opAdd1
+	opSub1
+	opZerop
+	opNumEq
+	opLess
+	opGreater
+	opLessEq
+	opGreaterEq
+)
+
+// opNames holds the names that disassemble prints for each opcode.
+var opNames = []string{
+	"CONST", "LOCAL", "SET-LOCAL", "GLOBAL", "SET-GLOBAL", "ENV", "SET-ENV", "POP", "JUMP", "JUMP-IF-NIL",
+	"CALL", "TAIL-CALL", "RETURN", "EVAL", "CAR", "CDR", "CONS", "NULL", "ATOM", "EQ",
+	"EQUAL", "ADD", "SUB", "MUL", "ADD1", "SUB1", "ZEROP", "=", "<", ">", "<=", ">=",
+}
+
+// A primitive is a builtin compiled to its own opcode when called with arity arguments.
+type primitive struct {
+	op    opcode
+	arity int
+}
+
+// primitives maps upper-case builtin names to their opcodes.
+var primitives = map[string]primitive{
+	"CAR": {opCar, 1}, "FIRST": {opCar, 1}, "CDR": {opCdr, 1}, "REST": {opCdr, 1},
+	"CONS": {opCons, 2}, "NULL": {opNull, 1}, "NOT": {opNull, 1}, "ATOM": {opAtom, 1},
+	"EQ": {opEq, 2}, "EQL": {opEq, 2}, "EQUAL": {opEqual, 2},
+	"+": {opAdd, 2}, "-": {opSub, 2}, "*": {opMul, 2}, "1+": {opAdd1, 1}, "1-": {opSub1, 1},
+	"ZEROP": {opZerop, 1}, "=": {opNumEq, 2}, "<": {opLess, 2}, ">": {opGreater, 2},
+	"<=": {opLessEq, 2}, ">=": {opGreaterEq, 2},
+}
+
+// An instr is one instruction. keep marks calls in tail position, which
+// return all the values of the callee rather than just the primary one.
+type instr struct {
+	op   opcode
+	a, b int
+	keep bool
+}
+
+// A compiledFunction is a function compiled to bytecode. Free variables are
+// looked up in env, the environment the function was defined in, whose
+// scope is outer: the global environment (nil) for a toplevel defun.
+type compiledFunction struct {
+	name      string
+	formals   []interface{}
+	slotNames []string
+	code      []instr
+	consts    []interface{}
+	env       *environment
+	outer     *scope
+	// dynamic holds the slots of the parameters bound dynamically, as
+	// they are special or declared special.
+	dynamic []int
+}
+
+// A fallback is a form left to the interpreter. It runs in a frame whose
+// values are the function's slots, in a scope naming each slot visible to
+// it and "" for the others, so assignments and closures in the form share
+// the slots. The form is analyzed the first time it runs.
+type fallback struct {
+	form  interface{}
+	code  *analysis
+	scope *scope
+}
+
+// A scopeEntry binds a variable name to a slot.
+type scopeEntry struct {
+	name string
+	slot int
+}
+
+// A compiler holds the state of compiling one function. declared holds the
+// variables declared special at the start of its body.
+type compiler struct {
+	in       *Interpreter
+	fn       *compiledFunction
+	scope    []scopeEntry
+	declared map[string]bool
+}
+
+// compileLambda compiles a function with the given formals and body, defined
+// in env, whose scope is outer.
+func (in *Interpreter) compileLambda(name string, formals, body []interface{}, env *environment, outer *scope) *compiledFunction {
+	declared, body := declaredSpecials(body)
+	c := &compiler{in: in, fn: &compiledFunction{name: name, formals: formals, env: env, outer: outer}, declared: declared}
+	for _, f := range formals {
+		name := symbolArg(f, "Formal parameters must be symbols")
+		slot := c.bind(name)
+		if in.isSpecial(name) || declared[name] {
+			c.fn.dynamic = append(c.fn.dynamic, slot)
+		}
+	}
+	c.compileBody(body, true)
+	return c.fn
+}
+
+// compileFunction compiles a function value: a closure, or a symbol naming a
+// function defined with defun. Compiled functions are returned as they are.
+func (in *Interpreter) compileFunction(fn interface{}) *compiledFunction {
+	switch f := fn.(type) {
+	case *compiledFunction:
+		return f
+	case *closure:
+		return in.compileClosure("LAMBDA", f)
+	case string:
+		switch def := in.globals[f].(type) {
+		case *compiledFunction:
+			return def
+		case *closure:
+			return in.compileClosure(f, def)
+		}
+		panic("compile: " + f + " is not a user-defined function")
+	}
+	panic("compile: cannot compile " + toLispString(fn))
+}
+
+// compileClosure compiles the lambda a closure was made from, in the
+// closure's environment.
+func (in *Interpreter) compileClosure(name string, f *closure) *compiledFunction {
+	return in.compileLambda(name, f.formals, f.body, f.env, f.code.scope.parent)
+}
+
+// emit appends an instruction and returns its address.
+func (c *compiler) emit(op opcode, a, b int) int {
+	c.fn.code = append(c.fn.code, instr{op: op, a: a, b: b})
+	return len(c.fn.code) - 1
+}
+
+// patch makes the jump at address at continue at the next instruction.
+func (c *compiler) patch(at int) {
+	c.fn.code[at].a = len(c.fn.code)
+}
+
+// constant adds x to the constants and returns its index.
+func (c *compiler) constant(x interface{}) int {
+	c.fn.consts = append(c.fn.consts, x)
+	return len(c.fn.consts) - 1
+}
+
+// bind allocates a new slot for a variable and brings it into scope.
+func (c *compiler) bind(name string) int {
+	slot := len(c.fn.slotNames)
+	c.fn.slotNames = append(c.fn.slotNames, name)
+	c.scope = append(c.scope, scopeEntry{name, slot})
+	return slot
+}
+
+// lookup returns the slot of a lexical variable in scope, or -1. Special
+// variables are never lexical.
+func (c *compiler) lookup(name string) int {
+	if c.in.isSpecial(name) || c.declared[name] {
+		return -1
+	}
+	for i := len(c.scope) - 1; i >= 0; i-- {
+		if c.scope[i].name == name {
+			return c.scope[i].slot
+		}
+	}
+	return -1
+}
+
+// finish ends a form in tail position by returning its value.
+func (c *compiler) finish(tail bool) {
+	if tail {
+		c.emit(opReturn, 0, 0)
+	}
+}
+
+// compileBody compiles a sequence of forms, leaving the value of the last.
+func (c *compiler) compileBody(forms []interface{}, tail bool) {
+	if len(forms) == 0 {
+		c.emit(opConst, c.constant(nil), 0)
+		c.finish(tail)
+		return
+	}
+	for _, f := range forms[:len(forms)-1] {
+		c.compile(f, false)
+		c.emit(opPop, 0, 0)
+	}
+	c.compile(forms[len(forms)-1], tail)
+}
+
+// compile compiles one form. In tail position the code returns the form's
+// value; otherwise it leaves the value on the stack.
+func (c *compiler) compile(form interface{}, tail bool) {
+	switch v := form.(type) {
+	case string:
+		switch up := strings.ToUpper(v); {
+		case up == "T":
+			c.emit(opConst, c.constant("T"), 0)
+		case up == "NIL":
+			c.emit(opConst, c.constant(nil), 0)
+		case isKeyword(v):
+			c.emit(opConst, c.constant(v), 0)
+		case c.lookup(v) >= 0:
+			c.emit(opLocal, c.lookup(v), 0)
+		default:
+			if depth, index, ok := c.fn.outer.resolve(v); ok {
+				c.emit(opEnv, depth, index)
+			} else {
+				c.emit(opGlobal, c.constant(v), 0)
+			}
+		}
+		c.finish(tail)
+		return
+	case *cons:
+	default:
+		c.emit(opConst, c.constant(form), 0)
+		c.finish(tail)
+		return
+	}
+	elems, _ := listElements(form)
+	head, ok := elems[0].(string)
+	if !ok {
+		c.compileFallback(form, tail)
+		return
+	}
+	args := elems[1:]
+	switch up := strings.ToUpper(head); up {
+	case "QUOTE":
+		if len(args) != 1 {
+			panic("quote expects exactly one argument")
+		}
+		c.emit(opConst, c.constant(args[0]), 0)
+		c.finish(tail)
+	case "PROGN":
+		c.compileBody(args, tail)
+	case "IF":
+		if len(args) < 2 || len(args) > 3 {
+			panic("if expects (if condition then [else])")
+		}
+		c.compile(args[0], false)
+		jumpElse := c.emit(opJumpIfNil, 0, 0)
+		c.compile(args[1], tail)
+		jumpEnd := -1
+		if !tail {
+			jumpEnd = c.emit(opJump, 0, 0)
+		}
+		c.patch(jumpElse)
+		c.compileBody(args[2:], tail)
+		if jumpEnd >= 0 {
+			c.patch(jumpEnd)
+		}
+	case "COND":
+		c.compileCond(args, tail)
+	case "AND", "OR":
+		// and returns NIL as soon as an argument is NIL and T otherwise; or
+		// returns T as soon as an argument is not NIL and NIL otherwise.
+		var jumps []int
+		for _, a := range args {
+			c.compile(a, false)
+			if up == "OR" {
+				c.emit(opNull, 0, 0)
+			}
+			jumps = append(jumps, c.emit(opJumpIfNil, 0, 0))
+		}
+		c.emit(opConst, c.constant(boolToT(up == "AND")), 0)
+		jumpEnd := c.emit(opJump, 0, 0)
+		for _, j := range jumps {
+			c.patch(j)
+		}
+		c.emit(opConst, c.constant(boolToT(up == "OR")), 0)
+		c.patch(jumpEnd)
+		c.finish(tail)
+	case "SETQ":
+		if len(args) != 2 {
+			panic("setq expects 2 arguments")
+		}
+		name, ok := args[0].(string)
+		if !ok {
+			panic("setq: first argument must be a symbol")
+		}
+		c.compile(args[1], false)
+		if slot := c.lookup(name); slot >= 0 {
+			c.emit(opSetLocal, slot, 0)
+		} else if depth, index, ok := c.fn.outer.resolve(name); ok {
+			c.emit(opSetEnv, depth, index)
+		} else {
+			c.emit(opSetGlobal, c.constant(name), 0)
+		}
+		c.finish(tail)
+	case "LET", "LET*":
+		c.compileLet(up == "LET*", form, args, tail)
+	default:
+		if specialForms[up] {
+			c.compileFallback(form, tail)
+			return
+		}
+		c.compileCall(head, up, args, tail)
+	}
+}
+
+// compileCond compiles the clauses of a cond form.
+func (c *compiler) compileCond(clauses []interface{}, tail bool) {
+	var jumpsEnd []int
+	for _, cl := range clauses {
+		clause, ok := listElements(cl)
+		if !ok || len(clause) == 0 {
+			panic("cond: each clause must be a non-empty list")
+		}
+		c.compile(clause[0], false)
+		jumpNext := c.emit(opJumpIfNil, 0, 0)
+		c.compileBody(clause[1:], tail)
+		if !tail {
+			jumpsEnd = append(jumpsEnd, c.emit(opJump, 0, 0))
+		}
+		c.patch(jumpNext)
+	}
+	c.emit(opConst, c.constant(nil), 0)
+	c.finish(tail)
+	for _, j := range jumpsEnd {
+		c.patch(j)
+	}
+}
+
+// compileLet compiles a let or let* form into slot assignments. A let that
+// binds or declares special variables is left to the interpreter.
+func (c *compiler) compileLet(sequential bool, form interface{}, args []interface{}, tail bool) {
+	if len(args) < 1 {
+		c.compileFallback(form, tail)
+		return
+	}
+	bindings, ok := listElements(args[0])
+	declared, body := declaredSpecials(args[1:])
+	if !ok || len(declared) > 0 || len(body) != len(args)-1 {
+		c.compileFallback(form, tail)
+		return
+	}
+	names := make([]string, len(bindings))
+	values := make([]interface{}, len(bindings))
+	for i, b := range bindings {
+		varSpec := b
+		if pair, ok := listElements(b); ok && b != nil {
+			if len(pair) < 1 || len(pair) > 2 {
+				c.compileFallback(form, tail)
+				return
+			}
+			varSpec = pair[0]
+			if len(pair) == 2 {
+				values[i] = pair[1]
+			}
+		}
+		name, ok := varSpec.(string)
+		if !ok || c.in.isSpecial(name) || c.declared[name] || c.in.isConstant(name) {
+			c.compileFallback(form, tail)
+			return
+		}
+		names[i] = name
+	}
+	depth := len(c.scope)
+	if sequential {
+		for i, name := range names {
+			c.compile(values[i], false)
+			c.emit(opSetLocal, c.bind(name), 0)
+			c.emit(opPop, 0, 0)
+		}
+	} else {
+		for _, v := range values {
+			c.compile(v, false)
+		}
+		slots := make([]int, len(names))
+		for i, name := range names {
+			slots[i] = c.bind(name)
+		}
+		for i := len(slots) - 1; i >= 0; i-- {
+			c.emit(opSetLocal, slots[i], 0)
+			c.emit(opPop, 0, 0)
+		}
+	}
+	c.compileBody(body, tail)
+	c.scope = c.scope[:depth]
+}
+
+// compileCall compiles a call to a function named head: a self tail call,
+// a primitive opcode, or a call by name.
+func (c *compiler) compileCall(head, up string, args []interface{}, tail bool) {
+	for _, a := range args {
+		c.compile(a, false)
+	}
+	if tail && head == c.fn.name && len(args) == len(c.fn.formals) {
+		c.emit(opTailCall, 0, 0)
+		return
+	}
+	if p, ok := primitives[up]; ok && p.arity == len(args) && !c.in.isUserFunction(head) {
+		c.emit(p.op, 0, 0)
+		c.finish(tail)
+		return
+	}
+	at := c.emit(opCall, c.constant(head), len(args))
+	c.fn.code[at].keep = tail
+	c.finish(tail)
+}
+
+// compileFallback compiles a form the interpreter evaluates, with the
+// innermost binding of each variable in scope.
+func (c *compiler) compileFallback(form interface{}, tail bool) {
+	names := make([]string, len(c.fn.slotNames))
+	seen := make(map[string]bool)
+	for i := len(c.scope) - 1; i >= 0; i-- {
+		if e := c.scope[i]; !seen[e.name] {
+			seen[e.name] = true
+			names[e.slot] = e.name
+		}
+	}
+	fb := &fallback{form: form, scope: c.fn.outer.child(names)}
+	fb.scope.specials = c.declared
+	at := c.emit(opEval, c.constant(fb), 0)
+	c.fn.code[at].keep = tail
+	c.finish(tail)
+}
+
+// isUserFunction checks if name is globally bound to a function object.
+func (in *Interpreter) isUserFunction(name string) bool {
+	switch in.globals[name].(type) {
+	case *closure, *compiledFunction, *continuation, *structFunction, *builtin:
+		return true
+	}
+	return false
+}
+
+// An activation is a call of a compiled function in progress: the function
+// and the slots of its variables. entry holds the dynamic-wind stack on
+// entry, to which a self tail call returns before binding the special
+// parameters again.
+type activation struct {
+	f     *compiledFunction
+	slots []interface{}
+	entry *wind
+}
+
+// callCompiled makes the machine call a compiled function. Special
+// parameters are bound dynamically until the call returns.
+func (m *machine) callCompiled(f *compiledFunction, args []interface{}) {
+	if len(args) != len(f.formals) {
+		panic("Lambda argument count mismatch")
+	}
+	a := &activation{f: f, slots: make([]interface{}, len(f.slotNames)), entry: m.in.winds}
+	copy(a.slots, args)
+	if len(f.dynamic) > 0 {
+		m.pushRestore(a.entry)
+		f.bindSpecials(m.in, a.slots)
+	}
+	m.runCompiled(a, 0, make([]interface{}, 0, 8))
+}
+
+// runCompiled executes the code of an activation from pc with the given
+// operand stack. Primitives and builtins run directly; any other call, and a
+// fallback, is handed to the machine, with a frame that resumes the code
+// with the stack when it returns unless it is in tail position. Resuming
+// copies the stack, so a continuation captured in a callee can be resumed
+// any number of times.
+func (m *machine) runCompiled(a *activation, pc int, stack []interface{}) {
+	in, f := m.in, a.f
+	pop := func() interface{} {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	// resume pushes a frame that continues at pc with the primary value
+	// returned to it on the stack.
+	resume := func() {
+		act, at, saved := a, pc, stack
+		m.push(func(m *machine, v interface{}) {
+			m.runCompiled(act, at, append(saved[:len(saved):len(saved)], primary(v)))
+		})
+	}
+	for {
+		ins := f.code[pc]
+		pc++
+		switch ins.op {
+		case opConst:
+			stack = append(stack, f.consts[ins.a])
+		case opLocal:
+			stack = append(stack, a.slots[ins.a])
+		case opSetLocal:
+			a.slots[ins.a] = stack[len(stack)-1]
+		case opGlobal:
+			stack = append(stack, in.globalValue(f.consts[ins.a].(string)))
+		case opSetGlobal:
+			in.setGlobal(f.consts[ins.a].(string), stack[len(stack)-1])
+		case opEnv:
+			stack = append(stack, *f.env.at(ins.a, ins.b))
+		case opSetEnv:
+			*f.env.at(ins.a, ins.b) = stack[len(stack)-1]
+		case opPop:
+			pop()
+		case opJump:
+			pc = ins.a
+		case opJumpIfNil:
+			if isNil(pop()) {
+				pc = ins.a
+			}
+		case opCall:
+			n := len(stack) - ins.b
+			callArgs := append([]interface{}(nil), stack[n:]...)
+			stack = stack[:n]
+			name := f.consts[ins.a].(string)
+			if b := in.lookupBuiltin(name); b != nil && b.machine == nil {
+				v := b.call(callArgs, in)
+				if !ins.keep {
+					v = primary(v)
+				}
+				stack = append(stack, v)
+				continue
+			}
+			if !ins.keep {
+				resume()
+			}
+			m.applyNamed(name, strings.ToUpper(name), callArgs)
+			return
+		case opTailCall:
+			// The new call gets new slots, as closures made by fallbacks
+			// may still refer to the old ones.
+			a = &activation{f: f, slots: make([]interface{}, len(f.slotNames)), entry: a.entry}
+			copy(a.slots, stack[len(stack)-len(f.formals):])
+			stack = stack[:0]
+			pc = 0
+			if len(f.dynamic) > 0 {
+				in.rewind(a.entry)
+				f.bindSpecials(in, a.slots)
+			}
+		case opReturn:
+			m.ret(pop())
+			return
+		case opEval:
+			code, env := f.fallbackCode(ins.a), &environment{values: a.slots, parent: f.env}
+			if code.value != nil {
+				v := code.value(m, env)
+				stack = append(stack, v)
+				continue
+			}
+			if !ins.keep {
+				resume()
+			}
+			m.exec(code, env)
+			return
+		case opCar:
+			stack[len(stack)-1] = lispCar(stack[len(stack)-1])
+		case opCdr:
+			stack[len(stack)-1] = lispCdr(stack[len(stack)-1])
+		case opCons:
+			y := pop()
+			stack[len(stack)-1] = consValue(stack[len(stack)-1], y)
+		case opNull:
+			stack[len(stack)-1] = boolToT(isNil(stack[len(stack)-1]))
+		case opAtom:
+			_, ok := stack[len(stack)-1].(*cons)
+			stack[len(stack)-1] = boolToT(!ok)
+		case opEq:
+			y := pop()
+			stack[len(stack)-1] = boolToT(eqlp(stack[len(stack)-1], y))
+		case opEqual:
+			y := pop()
+			stack[len(stack)-1] = boolToT(equalp(stack[len(stack)-1], y))
+		case opAdd, opSub, opMul:
+			y := numberArg(pop(), opNames[ins.op]+" expects numbers")
+			x := numberArg(stack[len(stack)-1], opNames[ins.op]+" expects numbers")
+			switch ins.op {
+			case opAdd:
+				stack[len(stack)-1] = numAdd(x, y)
+			case opSub:
+				stack[len(stack)-1] = numSub(x, y)
+			default:
+				stack[len(stack)-1] = numMul(x, y)
+			}
+		case opAdd1:
+			stack[len(stack)-1] = numAdd(numberArg(stack[len(stack)-1], "1+ expects a number"), 1)
+		case opSub1:
+			stack[len(stack)-1] = numSub(numberArg(stack[len(stack)-1], "1- expects a number"), 1)
+		case opZerop:
+			stack[len(stack)-1] = boolToT(numZerop(numberArg(stack[len(stack)-1], "zerop expects a number")))
+		case opNumEq, opLess, opGreater, opLessEq, opGreaterEq:
+			y := pop()
+			stack[len(stack)-1] = boolToT(numCompareChain(opNames[ins.op], []interface{}{stack[len(stack)-1], y}))
+		default:
+			panic(fmt.Sprintf("unknown opcode %d", ins.op))
+		}
+	}
+}
+
+// bindSpecials binds the special parameters of the function dynamically to
+// their values in slots.
+func (f *compiledFunction) bindSpecials(in *Interpreter, slots []interface{}) {
+	for _, slot := range f.dynamic {
+		in.bindParameter(f.slotNames[slot], slots[slot])
+	}
+}
+
+// fallbackCode returns the analysis of the fallback consts[i], analyzing it
+// the first time it runs, in a scope over the function's slots.
+func (f *compiledFunction) fallbackCode(i int) *analysis {
+	fb := f.consts[i].(*fallback)
+	if fb.code == nil {
+		fb.code = fb.scope.analyze(fb.form)
+	}
+	return fb.code
+}
+
+// disassemble returns a listing of the function's bytecode.
+func (f *compiledFunction) disassemble() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", formatCompiledFunction(f), formatFormals(f.formals))
+	for pc, in := range f.code {
+		operand := ""
+		switch in.op {
+		case opConst, opGlobal, opSetGlobal:
+			operand = toLispString(f.consts[in.a])
+		case opLocal, opSetLocal:
+			operand = fmt.Sprintf("%d ; %s", in.a, f.slotNames[in.a])
+		case opJump, opJumpIfNil:
+			operand = fmt.Sprintf("%d", in.a)
+		case opEnv, opSetEnv:
+			operand = fmt.Sprintf("%d %d", in.a, in.b)
+		case opCall:
+			operand = fmt.Sprintf("%s %d", f.consts[in.a], in.b)
+		case opEval:
+			operand = toLispString(f.consts[in.a].(*fallback).form)
+		}
+		line := fmt.Sprintf("%4d  %-12s%s", pc, opNames[in.op], operand)
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
+
+// formatCompiledFunction prints a compiled function in unreadable #<...> syntax.
+func formatCompiledFunction(f *compiledFunction) string {
+	return "#<COMPILED-FUNCTION " + f.name + ">"
+}
+
+// formatFormals prints a list of formal parameters.
+func formatFormals(formals []interface{}) string {
+	if len(formals) == 0 {
+		return "()"
+	}
+	return toLispString(makeList(formals...))
+}
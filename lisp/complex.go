@@ -0,0 +1,102 @@
+package lisp
+
+import (
+	"math/cmplx"
+)
+
+// A complexNum is a complex number with real parts re and im. Both parts are
+// rationals or both are floats. A complex with rational parts and a zero
+// imaginary part is always normalized to its real part, so it is never
+// stored as a complexNum.
+type complexNum struct {
+	re, im interface{}
+}
+
+// makeComplex builds the complex number re+im*i from two reals, applying
+// float contagion between the parts and normalizing exact results to reals.
+func makeComplex(re, im interface{}) interface{} {
+	if isRational(re) && isRational(im) {
+		if numSign(im) == 0 {
+			return re
+		}
+		return &complexNum{re, im}
+	}
+	return &complexNum{toFloat(re), toFloat(im)}
+}
+
+// realPart returns the real part of any number.
+func realPart(x interface{}) interface{} {
+	if c, ok := x.(*complexNum); ok {
+		return c.re
+	}
+	return x
+}
+
+// imagPart returns the imaginary part of any number. The imaginary part of a
+// float is 0.0 and that of a rational is 0.
+func imagPart(x interface{}) interface{} {
+	switch v := x.(type) {
+	case *complexNum:
+		return v.im
+	case float64:
+		return 0.0
+	}
+	return 0
+}
+
+// complexAdd adds two numbers where at least one is complex.
+func complexAdd(x, y interface{}) interface{} {
+	return makeComplex(numAdd(realPart(x), realPart(y)), numAdd(imagPart(x), imagPart(y)))
+}
+
+// complexSub subtracts y from x where at least one is complex.
+func complexSub(x, y interface{}) interface{} {
+	return makeComplex(numSub(realPart(x), realPart(y)), numSub(imagPart(x), imagPart(y)))
+}
+
+// complexMul multiplies two numbers where at least one is complex:
+// (a+bi)(c+di) = (ac-bd) + (ad+bc)i.
+func complexMul(x, y interface{}) interface{} {
+	a, b := realPart(x), imagPart(x)
+	c, d := realPart(y), imagPart(y)
+	return makeComplex(numSub(numMul(a, c), numMul(b, d)), numAdd(numMul(a, d), numMul(b, c)))
+}
+
+// complexDiv divides x by a non-zero y where at least one is complex:
+// (a+bi)/(c+di) = ((ac+bd) + (bc-ad)i) / (c^2+d^2).
+func complexDiv(x, y interface{}) interface{} {
+	a, b := realPart(x), imagPart(x)
+	c, d := realPart(y), imagPart(y)
+	den := numAdd(numMul(c, c), numMul(d, d))
+	re := numDiv(numAdd(numMul(a, c), numMul(b, d)), den)
+	im := numDiv(numSub(numMul(b, c), numMul(a, d)), den)
+	return makeComplex(re, im)
+}
+
+// toComplex128 converts any number to a Go complex128.
+func toComplex128(x interface{}) complex128 {
+	return complex(toFloat(realPart(x)), toFloat(imagPart(x)))
+}
+
+// fromComplex128 converts a Go complex128 to a complex number with float parts.
+func fromComplex128(c complex128) interface{} {
+	return &complexNum{real(c), imag(c)}
+}
+
+// conjugate returns the complex conjugate of a number.
+func conjugate(x interface{}) interface{} {
+	if c, ok := x.(*complexNum); ok {
+		return makeComplex(c.re, numNeg(c.im))
+	}
+	return x
+}
+
+// phase returns the angle of a number in radians.
+func phase(x interface{}) float64 {
+	return cmplx.Phase(toComplex128(x))
+}
+
+// formatComplex prints a complex number in #c(re im) syntax.
+func formatComplex(c *complexNum) string {
+	return "#c(" + toLispString(c.re) + " " + toLispString(c.im) + ")"
+}
@@ -0,0 +1,95 @@
+package lisp
+
+import "strings"
+
+// Errors signaled by Lisp code, by builtins and by Go functions registered
+// with RegisterFunc are conditions, represented by *Error values. The
+// handler-case and ignore-errors forms catch them, and error signals one.
+// Every condition is of the types error and condition.
+
+// condition returns the condition for a value recovered from a panic.
+func condition(x interface{}) *Error {
+	if e, ok := x.(*Error); ok {
+		return e
+	}
+	return &Error{Value: x}
+}
+
+// signalError signals an error with a message built from the arguments of
+// error: a condition is signaled again, and anything else is printed as if
+// by princ, separated by spaces.
+func signalError(args []interface{}) {
+	if e, ok := args[0].(*Error); ok && len(args) == 1 {
+		panic(e)
+	}
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = princToString(arg)
+	}
+	panic(&Error{Value: strings.Join(parts, " ")})
+}
+
+// analyzeIgnoreErrors analyzes an (ignore-errors form...) form, which
+// returns the values of the last form, or NIL and the condition if one of
+// them signals an error.
+func (sc *scope) analyzeIgnoreErrors(args []interface{}) *analysis {
+	body := sc.analyzeAll(args)
+	return &analysis{exec: func(m *machine, env *environment) {
+		m.pushHandler(func(m *machine, err *Error) { m.ret(values(nil, err)) })
+		m.evalBody(body, env)
+	}}
+}
+
+// A handlerClause is a clause of a handler-case form, whose body is
+// evaluated with var, if any, bound to the condition.
+type handlerClause struct {
+	bindsVar bool
+	body     []*analysis
+}
+
+// analyzeHandlerCase analyzes a (handler-case form (type ([var]) body...)...)
+// form, which returns the values of form, or, if it signals an error, those
+// of the body of the first clause whose type matches the condition. The
+// types error, condition and t match every condition.
+func (sc *scope) analyzeHandlerCase(args []interface{}) *analysis {
+	if len(args) < 1 {
+		panic("handler-case expects a form")
+	}
+	form := sc.analyze(args[0])
+	var clauses []handlerClause
+	for _, c := range args[1:] {
+		clause, ok := listElements(c)
+		if !ok || len(clause) < 2 {
+			panic("handler-case: each clause must be (type ([var]) body...)")
+		}
+		typeName := strings.ToUpper(symbolArg(clause[0], "handler-case: the condition type must be a symbol"))
+		if typeName != "ERROR" && typeName != "CONDITION" && typeName != "T" {
+			panic("handler-case: unknown condition type " + typeName)
+		}
+		vars, ok := listElements(clause[1])
+		if !ok || len(vars) > 1 {
+			panic("handler-case: each clause must be (type ([var]) body...)")
+		}
+		inner := sc
+		if len(vars) == 1 {
+			inner = sc.child([]string{symbolArg(vars[0], "handler-case: the variable must be a symbol")})
+		}
+		clauses = append(clauses, handlerClause{bindsVar: len(vars) == 1, body: inner.analyzeAll(clause[2:])})
+	}
+	return &analysis{exec: func(m *machine, env *environment) {
+		if len(clauses) == 0 {
+			m.exec(form, env)
+			return
+		}
+		// Every clause matches every condition, so the first one handles it.
+		handler := clauses[0]
+		m.pushHandler(func(m *machine, err *Error) {
+			local := env
+			if handler.bindsVar {
+				local = &environment{values: []interface{}{err}, parent: env}
+			}
+			m.evalBody(handler.body, local)
+		})
+		m.exec(form, env)
+	}}
+}
@@ -0,0 +1,572 @@
+package lisp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Go values are converted to and from Lisp values by reflection:
+//
+//	Go                          Lisp
+//	bool                        T or NIL
+//	int, uint and their kinds   integer, a bignum when it does not fit in an int
+//	float32, float64            float
+//	string                      string; a symbol also converts to a Go string
+//	slice, array                list, or a vector for a field tagged
+//	                            lisp:",vector"; a list or vector when
+//	                            converting to Go
+//	map                         hash table with an EQUAL test
+//	struct                      plist of :field value pairs, or a structure
+//	                            instance for a struct with a Struct field;
+//	                            a plist or structure instance when
+//	                            converting to Go
+//	pointer                     the value it points to, or NIL for nil
+//	nil slice, map or interface NIL
+//
+// An empty list is NIL, so an empty slice that is not nil also converts to
+// NIL, and comes back as a nil slice. A value that contains itself, through
+// a pointer, map or slice, cannot be converted to Lisp, and is an error like
+// it is for encoding/json.
+//
+// Lisp values such as conses, characters and big numbers are passed through
+// unchanged, and an interface such as any receives the Lisp value itself.
+// Struct fields are named by a lisp:"name" tag, or by the field name in
+// lower case with hyphens between words; a lisp:"-" tag skips the field.
+
+// Marshal converts a Go value to a Lisp value. A struct with a Struct field
+// becomes an instance of a structure type made for its Go type; use
+// Interpreter.Marshal to make instances of a type defined with defstruct.
+func Marshal(v interface{}) (Value, error) {
+	return lispValue(reflect.ValueOf(v), nil)
+}
+
+// Unmarshal converts a Lisp value to a Go value and stores it in the value
+// ptr points to.
+func Unmarshal(x Value, ptr interface{}) error {
+	p := reflect.ValueOf(ptr)
+	if p.Kind() != reflect.Pointer || p.IsNil() {
+		return fmt.Errorf("Unmarshal needs a non-nil pointer, not a %T", ptr)
+	}
+	v, err := goValue(x, p.Elem().Type())
+	if err != nil {
+		return err
+	}
+	p.Elem().Set(v)
+	return nil
+}
+
+// A Struct field marks a Go struct that converts to a structure instance
+// rather than a plist. Its lisp tag names the structure type, which is
+// otherwise named after the Go type:
+//
+//	type Point struct {
+//		lisp.Struct `lisp:"point"`
+//		X, Y        int
+//	}
+type Struct struct{}
+
+// structMarker is the type of Struct fields.
+var structMarker = reflect.TypeOf(Struct{})
+
+// structName returns the name of the structure type a Go struct type
+// converts to, and false if it converts to a plist.
+func structName(t reflect.Type) (string, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Type == structMarker {
+			name, _, _ := strings.Cut(f.Tag.Get("lisp"), ",")
+			if name == "" {
+				name = lispFieldName(t.Name())
+			}
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// goStructTypes maps Go struct types to the structure types Marshal makes
+// for them.
+var goStructTypes sync.Map
+
+// goStructType returns the structure type Marshal makes for a Go struct
+// type, with one slot per field.
+func goStructType(t reflect.Type, name string, fields []structField) *structType {
+	if typ, ok := goStructTypes.Load(t); ok {
+		return typ.(*structType)
+	}
+	typ := &structType{name: name}
+	for _, f := range fields {
+		typ.slots = append(typ.slots, structSlot{name: f.name, init: constantAnalysis(nil)})
+	}
+	actual, _ := goStructTypes.LoadOrStore(t, typ)
+	return actual.(*structType)
+}
+
+// lispTypes are the Go types of Lisp values that are not converted.
+var lispTypes = map[reflect.Type]bool{
+	reflect.TypeOf((*big.Int)(nil)):          true,
+	reflect.TypeOf((*big.Rat)(nil)):          true,
+	reflect.TypeOf((*complexNum)(nil)):       true,
+	reflect.TypeOf(lispChar(0)):              true,
+	reflect.TypeOf((*lispString)(nil)):       true,
+	reflect.TypeOf((*lispArray)(nil)):        true,
+	reflect.TypeOf((*hashTable)(nil)):        true,
+	reflect.TypeOf((*cons)(nil)):             true,
+	reflect.TypeOf((*closure)(nil)):          true,
+	reflect.TypeOf((*structInstance)(nil)):   true,
+	reflect.TypeOf((*structFunction)(nil)):   true,
+	reflect.TypeOf((*builtin)(nil)):          true,
+	reflect.TypeOf((*continuation)(nil)):     true,
+	reflect.TypeOf((*generator)(nil)):        true,
+	reflect.TypeOf((*promise)(nil)):          true,
+	reflect.TypeOf((*compiledFunction)(nil)): true,
+}
+
+// lispValue converts a Go value to a Lisp value. Structs marked with a Struct
+// field become instances of the type of that name defined in the
+// interpreter in, if it is not nil and there is one.
+func lispValue(v reflect.Value, in *Interpreter) (interface{}, error) {
+	c := &marshaler{in: in, visiting: make(map[visit]bool)}
+	return c.lispValue(v)
+}
+
+// A marshaler converts Go values to Lisp values for the interpreter in,
+// which may be nil. visiting holds the pointers, maps and slices whose
+// values are being converted, so that a value that contains itself is an
+// error rather than endless recursion.
+type marshaler struct {
+	in       *Interpreter
+	visiting map[visit]bool
+}
+
+// A visit identifies a pointer, map or slice being converted. A slice is
+// told apart from a shorter one with the same start by its length.
+type visit struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// enter marks a pointer, map or slice as being converted, returning a
+// function that unmarks it, or an error if it is already being converted.
+func (c *marshaler) enter(v reflect.Value) (leave func(), err error) {
+	key := visit{typ: v.Type(), ptr: v.Pointer()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	if c.visiting[key] {
+		return nil, fmt.Errorf("cannot convert a Go %s that contains itself to a Lisp value", v.Type())
+	}
+	c.visiting[key] = true
+	return func() { delete(c.visiting, key) }, nil
+}
+
+// lispValue converts a Go value to a Lisp value.
+func (c *marshaler) lispValue(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	t := v.Type()
+	if lispTypes[t] {
+		return v.Interface(), nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return boolToT(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return normalizeBig(big.NewInt(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return normalizeBig(new(big.Int).SetUint64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return newLispString(v.String()), nil
+	case reflect.Slice, reflect.Array:
+		return c.lispSequence(v, false)
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		leave, err := c.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		return c.lispHashTable(v)
+	case reflect.Struct:
+		if name, ok := structName(t); ok {
+			return c.lispStructInstance(v, name)
+		}
+		return c.lispPlist(v)
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return c.lispValue(v.Elem())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil, nil
+		}
+		leave, err := c.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		return c.lispValue(v.Elem())
+	}
+	return nil, fmt.Errorf("cannot convert a Go %s to a Lisp value", t)
+}
+
+// lispSequence converts a Go slice or array to a list, or to a vector if
+// vector is true. A nil slice is NIL either way, and so is an empty slice
+// converted to a list.
+func (c *marshaler) lispSequence(v reflect.Value, vector bool) (interface{}, error) {
+	if v.Kind() == reflect.Slice {
+		if v.IsNil() {
+			return nil, nil
+		}
+		leave, err := c.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+	}
+	elems := make([]interface{}, v.Len())
+	for i := range elems {
+		e, err := c.lispValue(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = e
+	}
+	if vector {
+		return newVector(elems), nil
+	}
+	return makeList(elems...), nil
+}
+
+// lispHashTable converts a Go map to a hash table. The entries are added in
+// the order of their printed keys, so that maphash visits them predictably.
+func (c *marshaler) lispHashTable(v reflect.Value) (interface{}, error) {
+	type entry struct {
+		key, value interface{}
+		printed    string
+	}
+	var entries []entry
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := c.lispValue(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		value, err := c.lispValue(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key, value, toLispString(key)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].printed < entries[j].printed })
+	h := newHashTable("EQUAL")
+	for _, e := range entries {
+		h.put(e.key, e.value)
+	}
+	return h, nil
+}
+
+// lispPlist converts a Go struct to a plist of :field value pairs.
+func (c *marshaler) lispPlist(v reflect.Value) (interface{}, error) {
+	var plist []interface{}
+	for _, f := range structFields(v.Type()) {
+		value, err := f.lispValue(v, c)
+		if err != nil {
+			return nil, err
+		}
+		plist = append(plist, ":"+f.name, value)
+	}
+	return makeList(plist...), nil
+}
+
+// lispStructInstance converts a Go struct to an instance of the structure
+// type name defined in the marshaler's interpreter, or of a type made for the
+// Go type if there is none.
+// Slots with no field get the value of their initform.
+func (c *marshaler) lispStructInstance(v reflect.Value, name string) (interface{}, error) {
+	fields := structFields(v.Type())
+	var typ *structType
+	if c.in != nil {
+		typ = c.in.structs[strings.ToUpper(name)]
+	}
+	if typ == nil {
+		typ = goStructType(v.Type(), name, fields)
+	}
+	inst := &structInstance{typ: typ, values: make([]interface{}, len(typ.slots))}
+	set := make([]bool, len(typ.slots))
+	for _, f := range fields {
+		i := typ.slotIndex(f.name)
+		if i < 0 {
+			return nil, fmt.Errorf("structure %s has no slot %s", typ.name, f.name)
+		}
+		value, err := f.lispValue(v, c)
+		if err != nil {
+			return nil, err
+		}
+		inst.values[i], set[i] = value, true
+	}
+	for i, s := range typ.slots {
+		if !set[i] {
+			inst.values[i] = c.in.evalCode(s.init, nil)
+		}
+	}
+	return inst, nil
+}
+
+// goValue converts a Lisp value to a Go value of type t.
+func goValue(x interface{}, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if x != nil && reflect.TypeOf(x).AssignableTo(t) {
+		v.Set(reflect.ValueOf(x))
+		return v, nil
+	}
+	fail := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("cannot convert %s to a Go %s", toLispString(x), t)
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		if x != nil {
+			return fail()
+		}
+	case reflect.Bool:
+		v.SetBool(!isNil(x))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := goInt(x)
+		if !ok || !n.IsInt64() || v.OverflowInt(n.Int64()) {
+			return fail()
+		}
+		v.SetInt(n.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := goInt(x)
+		if !ok || !n.IsUint64() || v.OverflowUint(n.Uint64()) {
+			return fail()
+		}
+		v.SetUint(n.Uint64())
+	case reflect.Float32, reflect.Float64:
+		if !isReal(x) {
+			return fail()
+		}
+		f := toFloat(x)
+		if t.Kind() == reflect.Float32 && math.Abs(f) > math.MaxFloat32 {
+			return fail()
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		switch s := x.(type) {
+		case *lispString:
+			v.SetString(s.String())
+		case string:
+			v.SetString(s)
+		default:
+			return fail()
+		}
+	case reflect.Slice, reflect.Array:
+		if x == nil {
+			if t.Kind() == reflect.Slice {
+				return v, nil
+			}
+			return fail()
+		}
+		var elems []interface{}
+		switch s := x.(type) {
+		case *cons:
+			if !isProperList(s) {
+				return fail()
+			}
+			elems, _ = listElements(s)
+		case *lispArray:
+			if !s.isVector() {
+				return fail()
+			}
+			elems = s.elements()
+		default:
+			return fail()
+		}
+		if t.Kind() == reflect.Slice {
+			v = reflect.MakeSlice(t, len(elems), len(elems))
+		} else if len(elems) != t.Len() {
+			return fail()
+		}
+		for i, e := range elems {
+			ev, err := goValue(e, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Index(i).Set(ev)
+		}
+	case reflect.Map:
+		if x == nil {
+			return v, nil
+		}
+		h, ok := x.(*hashTable)
+		if !ok {
+			return fail()
+		}
+		v = reflect.MakeMapWithSize(t, len(h.entries))
+		for _, e := range h.order {
+			key, err := goValue(e.key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := goValue(e.value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		if err := setStructFields(v, x); err != nil {
+			if err == errNotStruct {
+				return fail()
+			}
+			return reflect.Value{}, err
+		}
+	case reflect.Pointer:
+		if x == nil {
+			return v, nil
+		}
+		elem, err := goValue(x, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.Set(reflect.New(t.Elem()))
+		v.Elem().Set(elem)
+	default:
+		return fail()
+	}
+	return v, nil
+}
+
+// goInt returns an integer as a big.Int, and false for any other value.
+func goInt(x interface{}) (*big.Int, bool) {
+	switch n := x.(type) {
+	case int:
+		return big.NewInt(int64(n)), true
+	case *big.Int:
+		return n, true
+	}
+	return nil, false
+}
+
+// errNotStruct reports a value that cannot be converted to a struct.
+var errNotStruct = errors.New("not a plist or structure")
+
+// setStructFields sets the fields of the struct v from a plist or a
+// structure instance. Fields with no value keep their zero value.
+func setStructFields(v reflect.Value, x interface{}) error {
+	var lookup func(name string) (interface{}, bool)
+	switch s := x.(type) {
+	case nil:
+		return nil
+	case *structInstance:
+		if name, ok := structName(v.Type()); ok && !s.typ.isNamed(name) {
+			return errNotStruct
+		}
+		lookup = func(name string) (interface{}, bool) {
+			if i := s.typ.slotIndex(name); i >= 0 {
+				return s.values[i], true
+			}
+			return nil, false
+		}
+	case *cons:
+		plist, _ := listElements(s)
+		if !isProperList(s) || len(plist)%2 != 0 {
+			return errNotStruct
+		}
+		lookup = func(name string) (interface{}, bool) {
+			for i := 0; i < len(plist); i += 2 {
+				if key, ok := plist[i].(string); ok && strings.EqualFold(strings.TrimPrefix(key, ":"), name) {
+					return plist[i+1], true
+				}
+			}
+			return nil, false
+		}
+	default:
+		return errNotStruct
+	}
+	for _, f := range structFields(v.Type()) {
+		value, ok := lookup(f.name)
+		if !ok {
+			continue
+		}
+		fv, err := goValue(value, f.typ)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+		v.FieldByIndex(f.index).Set(fv)
+	}
+	return nil
+}
+
+// A structField is an exported Go struct field and its Lisp name. A vector
+// field converts slices to vectors rather than lists.
+type structField struct {
+	name   string
+	index  []int
+	typ    reflect.Type
+	vector bool
+}
+
+// lispValue converts the field of the struct v to a Lisp value.
+func (f structField) lispValue(v reflect.Value, c *marshaler) (interface{}, error) {
+	fv := v.FieldByIndex(f.index)
+	if k := fv.Kind(); f.vector && (k == reflect.Slice || k == reflect.Array) {
+		return c.lispSequence(fv, true)
+	}
+	return c.lispValue(fv)
+}
+
+// structFields returns the fields of a struct type that convert to Lisp.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous || f.Type == structMarker {
+			continue
+		}
+		field := structField{name: lispFieldName(f.Name), index: f.Index, typ: f.Type}
+		if tag, ok := f.Tag.Lookup("lisp"); ok {
+			name, options, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				continue
+			}
+			if name != "" {
+				field.name = name
+			}
+			field.vector = slices.Contains(strings.Split(options, ","), "vector")
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// lispFieldName converts a Go field name such as UserID to a Lisp name such
+// as user-id.
+func lispFieldName(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
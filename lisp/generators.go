@@ -0,0 +1,125 @@
+package lisp
+
+// A generator runs a function as a coroutine: each (yield value) in it
+// suspends it and hands value to the caller of next, and the following call
+// to next resumes it where it left off. Suspending saves the frames of the
+// machine's run, so a generator costs no goroutine and no Go stack while it
+// waits. Because only the frames of the generator's own run are saved, yield
+// cannot be called from a callback inside a builtin that starts a nested
+// run, such as sort.
+type generator struct {
+	fn      interface{}
+	args    []interface{}
+	started bool
+	done    bool
+	running bool
+	// k and winds hold the frames and dynamic-wind entries of a suspended
+	// generator; k is nil while it is not suspended.
+	k     *frame
+	winds *wind
+	// A value produced ahead of time by generator-done-p, returned by the
+	// next call to next.
+	buffered bool
+	pending  interface{}
+}
+
+// generatorArg returns x as a generator, or panics with msg.
+func generatorArg(x interface{}, msg string) *generator {
+	g, ok := x.(*generator)
+	if !ok {
+		panic(msg)
+	}
+	return g
+}
+
+// resume runs the generator until it yields or returns, passing send to the
+// yield it is suspended at. It reports false once the generator has
+// returned. A generator that fails or is escaped from cannot be resumed.
+func (g *generator) resume(send interface{}, in *Interpreter) (interface{}, bool) {
+	if g.done {
+		return nil, false
+	}
+	if g.running {
+		panic("next: the generator is already running")
+	}
+	// The generator's dynamic-wind entries start from an empty stack, so
+	// they can be suspended and reentered wherever next is called from.
+	saved := in.winds
+	in.winds = nil
+	g.running = true
+	k, winds := g.k, g.winds
+	g.k, g.winds = nil, nil
+	defer func() {
+		in.winds = saved
+		g.running = false
+		g.done = g.k == nil
+	}()
+	v := in.execute(func(m *machine) {
+		m.run.generator = g
+		if !g.started {
+			g.started = true
+			m.apply(g.fn, g.args)
+			return
+		}
+		in.rewind(winds)
+		m.k = k
+		m.ret(send)
+	})
+	if g.k == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// next returns the generator's next value, and false when it has none.
+func (g *generator) next(send interface{}, in *Interpreter) (interface{}, bool) {
+	if g.buffered {
+		g.buffered = false
+		return g.pending, true
+	}
+	return g.resume(send, in)
+}
+
+// donep checks if the generator has no more values, running it ahead to its
+// next yield if needed to find out.
+func (g *generator) donep(in *Interpreter) bool {
+	if !g.buffered && !g.done {
+		g.pending, g.buffered = g.resume(nil, in)
+	}
+	return !g.buffered
+}
+
+// yield suspends the generator of the machine's run, making the run return
+// value to next.
+func (m *machine) yield(value interface{}) {
+	g := m.run.generator
+	if g == nil {
+		panic("yield: not called from the body of a generator")
+	}
+	g.k, g.winds = m.k, m.in.winds
+	// Leave the dynamic bindings and dynamic-wind extents of the generator,
+	// but not its unwind-protect forms, which have not been exited.
+	for m.in.winds != nil {
+		w := m.in.winds
+		m.in.winds = w.next
+		if w.before != nil {
+			w.after()
+		}
+	}
+	m.k = &frame{}
+	m.ret(value)
+}
+
+// doGenerator runs the body of a do-generator form once for each value of
+// g, with the variable of the frame local set to the value, then evaluates
+// the result forms.
+func (m *machine) doGenerator(g *generator, result, body []*analysis, local *environment) {
+	v, ok := g.next(nil, m.in)
+	local.values[0] = v
+	if !ok {
+		m.evalBody(result, local)
+		return
+	}
+	m.push(func(m *machine, _ interface{}) { m.doGenerator(g, result, body, local) })
+	m.evalBody(body, local)
+}
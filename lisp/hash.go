@@ -0,0 +1,246 @@
+package lisp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A hashTable is a Lisp hash table. Keys are compared with the table's test,
+// one of EQ, EQL, EQUAL or EQUALP, by reducing each key to a Go map key that
+// is equal exactly when the Lisp keys satisfy the test (see hashKey). Entries
+// remember their insertion order so that maphash visits them predictably.
+type hashTable struct {
+	test    string
+	entries map[interface{}]*hashEntry
+	order   []*hashEntry
+}
+
+// A hashEntry is one key/value pair of a hash table.
+type hashEntry struct {
+	key, value interface{}
+}
+
+// Go map keys for values that are not comparable, or that compare
+// differently in Lisp than in Go. The distinct types keep, say, the symbol
+// named "1/2" apart from the ratio 1/2.
+type (
+	symbolKey string
+	numberKey string
+)
+
+// newHashTable creates an empty hash table with the given test, which may be
+// a symbol or a function designator naming EQ, EQL, EQUAL or EQUALP.
+func newHashTable(test interface{}) *hashTable {
+	name := "EQL"
+	switch t := test.(type) {
+	case nil:
+	case string:
+		name = strings.ToUpper(t)
+	case *builtin:
+		name = strings.ToUpper(t.name)
+	default:
+		panic("make-hash-table: :test must be eq, eql, equal or equalp")
+	}
+	switch name {
+	case "EQ", "EQL", "EQUAL", "EQUALP":
+	default:
+		panic("make-hash-table: :test must be eq, eql, equal or equalp")
+	}
+	return &hashTable{test: name, entries: make(map[interface{}]*hashEntry)}
+}
+
+// hashTableArg checks that x is a hash table, panicking with msg otherwise.
+func hashTableArg(x interface{}, msg string) *hashTable {
+	h, ok := x.(*hashTable)
+	if !ok {
+		panic(msg)
+	}
+	return h
+}
+
+// get returns the value stored under key and whether it was present.
+func (h *hashTable) get(key interface{}) (interface{}, bool) {
+	if e, ok := h.entries[hashKey(key, h.test)]; ok {
+		return e.value, true
+	}
+	return nil, false
+}
+
+// put stores value under key, replacing any existing value.
+func (h *hashTable) put(key, value interface{}) {
+	k := hashKey(key, h.test)
+	if e, ok := h.entries[k]; ok {
+		e.value = value
+		return
+	}
+	e := &hashEntry{key: key, value: value}
+	h.entries[k] = e
+	h.order = append(h.order, e)
+}
+
+// remove deletes the entry for key, reporting whether there was one.
+func (h *hashTable) remove(key interface{}) bool {
+	k := hashKey(key, h.test)
+	e, ok := h.entries[k]
+	if !ok {
+		return false
+	}
+	delete(h.entries, k)
+	for i, o := range h.order {
+		if o == e {
+			h.order = append(h.order[:i], h.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// clear removes every entry.
+func (h *hashTable) clear() {
+	h.entries = make(map[interface{}]*hashEntry)
+	h.order = nil
+}
+
+// hashKey reduces a Lisp value to a Go map key such that two values get the
+// same key exactly when they satisfy test. A structural key cannot be written
+// for a value that contains a cycle, so such a value cannot be a key of an
+// EQUAL or EQUALP table.
+func hashKey(x interface{}, test string) interface{} {
+	if test == "EQ" || test == "EQL" {
+		return eqlKey(x)
+	}
+	if findCycles(x) != nil {
+		panic("a circular object cannot be a key of an " + test + " hash table")
+	}
+	var b strings.Builder
+	writeHashKey(&b, x, test == "EQUALP")
+	return b.String()
+}
+
+// eqlKey returns a map key that is the same for two values exactly when they are EQL.
+func eqlKey(x interface{}) interface{} {
+	if isNil(x) {
+		return nil
+	}
+	switch v := x.(type) {
+	case string:
+		return symbolKey(strings.ToUpper(v))
+	case int, float64, lispChar:
+		return v
+	}
+	if isNumber(x) {
+		return numberKey(numberTag(x) + toLispString(x))
+	}
+	return x
+}
+
+// numberTag distinguishes numbers of different types with the same printed digits.
+func numberTag(x interface{}) string {
+	return strconv.Itoa(numberRank(x)) + ":"
+}
+
+// writeHashKey writes a structural key for x that is the same for two values
+// exactly when they are EQUAL, or EQUALP when fold is true.
+func writeHashKey(b *strings.Builder, x interface{}, fold bool) {
+	if isNil(x) {
+		b.WriteString("()")
+		return
+	}
+	switch v := x.(type) {
+	case string:
+		b.WriteString("y" + strconv.Quote(strings.ToUpper(v)))
+	case lispChar:
+		if fold {
+			v = lispChar(unicode.ToUpper(rune(v)))
+		}
+		b.WriteString("h" + strconv.QuoteRune(rune(v)))
+	case *lispString:
+		s := v.String()
+		if fold {
+			s = strings.ToUpper(s)
+		}
+		b.WriteString("s" + strconv.Quote(s))
+	case *cons:
+		b.WriteString("(")
+		writeHashKey(b, v.car, fold)
+		b.WriteString(" . ")
+		writeHashKey(b, v.cdr, fold)
+		b.WriteString(")")
+	case *lispArray:
+		if !fold {
+			fmt.Fprintf(b, "p%p", v)
+			return
+		}
+		fmt.Fprintf(b, "#%v(", v.dims[1:])
+		elems := v.data
+		if v.isVector() {
+			elems = v.elements()
+		}
+		for _, e := range elems {
+			writeHashKey(b, e, fold)
+			b.WriteString(" ")
+		}
+		b.WriteString(")")
+	case *structInstance:
+		if !fold {
+			fmt.Fprintf(b, "p%p", v)
+			return
+		}
+		fmt.Fprintf(b, "S%p(", v.typ)
+		for _, e := range v.values {
+			writeHashKey(b, e, fold)
+			b.WriteString(" ")
+		}
+		b.WriteString(")")
+	default:
+		switch {
+		case isNumber(x) && fold:
+			// EQUALP compares numbers with =, so 1 and 1.0 share a key.
+			writeFoldedNumberKey(b, x)
+		case isNumber(x):
+			b.WriteString("n" + numberTag(x) + toLispString(x))
+		default:
+			fmt.Fprintf(b, "p%p", x)
+		}
+	}
+}
+
+// writeFoldedNumberKey writes a key for a number that is the same for two
+// numbers exactly when they are =.
+func writeFoldedNumberKey(b *strings.Builder, x interface{}) {
+	b.WriteString("n")
+	if numberRank(x) == rankComplex {
+		b.WriteString("c")
+		writeFoldedNumberKey(b, realPart(x))
+		writeFoldedNumberKey(b, imagPart(x))
+		return
+	}
+	if f, ok := x.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		b.WriteString(formatFloat(f))
+		return
+	}
+	b.WriteString(toRat(x).RatString())
+}
+
+// formatHashTable prints a hash table in unreadable #<...> syntax.
+func formatHashTable(h *hashTable) string {
+	return fmt.Sprintf("#<HASH-TABLE :TEST %s :COUNT %d>", h.test, len(h.order))
+}
+
+// equalpHashTables checks if two hash tables have the same test and the same
+// keys, with EQUALP values under each key.
+func equalpHashTables(a, b *hashTable) bool {
+	if a.test != b.test || len(a.order) != len(b.order) {
+		return false
+	}
+	for _, e := range a.order {
+		v, ok := b.get(e.key)
+		if !ok || !equalFold(e.value, v) {
+			return false
+		}
+	}
+	return true
+}
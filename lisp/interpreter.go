@@ -0,0 +1,236 @@
+package lisp
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+)
+
+// A Value is a Lisp value: an int, *big.Int, *big.Rat, float64, string
+// (a symbol), nil (NIL, the empty list) or one of the package's object types.
+type Value = interface{}
+
+// An Interpreter is an independent Lisp environment with its own global
+// variables, functions, special variables, structure types, setf expanders
+// and symbol property lists. The builtin functions are shared.
+//
+// Interpreters share no state, so different interpreters can run in
+// different goroutines at once and a Go function run by one may call into
+// another. An Interpreter must not be used by several goroutines at once,
+// but a Go function it runs may call back into it.
+type Interpreter struct {
+	globals   Alist
+	specials  map[string]bool
+	constants map[string]bool
+	expanders map[string]*setfExpander
+	structs   map[string]*structType
+	plists    map[string][]interface{}
+	// winds is the innermost wind of the current dynamic extent, and
+	// runDepth counts the runs of the machine in progress.
+	winds    *wind
+	runDepth int
+}
+
+// An Error is a Lisp error returned to Go. Value holds what the error
+// signaled, usually its message.
+type Error struct {
+	Value interface{}
+}
+
+// Error returns the error's message.
+func (e *Error) Error() string {
+	if s, ok := e.Value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(e.Value)
+}
+
+// Unwrap returns the Go error the Lisp error wraps, if any.
+func (e *Error) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// New returns an interpreter with an empty global environment.
+func New() *Interpreter {
+	return &Interpreter{
+		globals:   make(Alist),
+		specials:  make(map[string]bool),
+		constants: make(map[string]bool),
+		expanders: make(map[string]*setfExpander),
+		structs:   make(map[string]*structType),
+		plists:    make(map[string][]interface{}),
+	}
+}
+
+// do runs f, returning a Lisp error as an *Error.
+func (in *Interpreter) do(f func() interface{}) (v Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(*Error); ok {
+				err = e
+				return
+			}
+			err = &Error{Value: r}
+		}
+	}()
+	return f(), nil
+}
+
+// Eval evaluates a form and returns its primary value.
+func (in *Interpreter) Eval(form Value) (Value, error) {
+	return in.do(func() interface{} { return in.myEval(form) })
+}
+
+// EvalValues evaluates a form and returns all of its values.
+func (in *Interpreter) EvalValues(form Value) ([]Value, error) {
+	v, err := in.do(func() interface{} { return valuesOf(in.myEvalValues(form)) })
+	if err != nil {
+		return nil, err
+	}
+	return v.([]Value), nil
+}
+
+// EvalString reads the forms in src and evaluates them in order, returning
+// the primary value of the last one, or NIL if there are none.
+func (in *Interpreter) EvalString(src string) (Value, error) {
+	return in.do(func() interface{} {
+		var v interface{}
+		for _, form := range readAll(in, src) {
+			v = in.myEval(form)
+		}
+		return v
+	})
+}
+
+// Load reads the forms from r and evaluates them in order.
+func (in *Interpreter) Load(r io.Reader) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = in.EvalString(string(src))
+	return err
+}
+
+// Define gives the global variable name the value v. A function value, such
+// as a closure from Eval, makes name callable as a function.
+func (in *Interpreter) Define(name string, v Value) {
+	in.globals[name] = v
+}
+
+// Lookup returns the global value of name, and false if it is unbound.
+func (in *Interpreter) Lookup(name string) (Value, bool) {
+	v, ok := in.globals[name]
+	return v, ok
+}
+
+// errorType is the type of Go error values.
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterFunc defines name as a Lisp function that calls the Go function
+// fn. Arguments and results are converted between Lisp and Go values (see
+// convert.go), and an argument that cannot be converted is an error. A
+// variadic fn takes any number of extra arguments, and a fn with several
+// results returns them as multiple values. A final error result is not
+// returned: when it is not nil, the call signals a Lisp error that wraps it.
+// Lisp code can catch it with handler-case or ignore-errors; otherwise the
+// Eval method running the code returns it.
+func (in *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func || f.IsNil() {
+		return fmt.Errorf("RegisterFunc: %s is given a %T, not a function", name, fn)
+	}
+	t := f.Type()
+	minArgs, maxArgs := t.NumIn(), t.NumIn()
+	if t.IsVariadic() {
+		minArgs, maxArgs = t.NumIn()-1, many
+	}
+	results := t.NumOut()
+	returnsError := results > 0 && t.Out(results-1) == errorType
+	if returnsError {
+		results--
+	}
+	b := &builtin{
+		name:    name,
+		minArgs: minArgs,
+		maxArgs: maxArgs,
+		doc:     "Calls the Go function " + runtime.FuncForPC(f.Pointer()).Name() + ".",
+		pure:    impure,
+	}
+	b.fn = func(args []interface{}, in *Interpreter) interface{} {
+		goArgs := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			pt := t.In(min(i, t.NumIn()-1))
+			if t.IsVariadic() && i >= t.NumIn()-1 {
+				pt = pt.Elem()
+			}
+			v, err := goValue(arg, pt)
+			if err != nil {
+				panic(fmt.Sprintf("%s: argument %d: %v", name, i+1, err))
+			}
+			goArgs[i] = v
+		}
+		out := f.Call(goArgs)
+		if returnsError && !out[results].IsNil() {
+			panic(&Error{Value: fmt.Errorf("%s: %w", name, out[results].Interface().(error))})
+		}
+		vals := make([]interface{}, results)
+		for i := range vals {
+			v, err := lispValue(out[i], in)
+			if err != nil {
+				panic(name + ": " + err.Error())
+			}
+			vals[i] = v
+		}
+		switch results {
+		case 0:
+			return nil
+		case 1:
+			return vals[0]
+		}
+		return values(vals...)
+	}
+	in.Define(name, b)
+	return nil
+}
+
+// Marshal converts a Go value to a Lisp value like the package's Marshal,
+// but a struct with a Struct field becomes an instance of the structure type
+// of that name defined in the interpreter, if there is one.
+func (in *Interpreter) Marshal(v interface{}) (Value, error) {
+	var err error
+	x, lispErr := in.do(func() interface{} {
+		var x interface{}
+		x, err = lispValue(reflect.ValueOf(v), in)
+		return x
+	})
+	if lispErr != nil {
+		return nil, lispErr
+	}
+	return x, err
+}
+
+// Read parses the form in src. Structure literals (#S syntax) need the
+// structure types of an interpreter and can only be read by its Read method.
+func Read(src string) (form Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &Error{Value: r}
+		}
+	}()
+	return readSExpression(nil, src), nil
+}
+
+// Read parses the form in src like the package's Read, reading structure
+// literals as instances of the interpreter's structure types.
+func (in *Interpreter) Read(src string) (Value, error) {
+	return in.do(func() interface{} { return readSExpression(in, src) })
+}
+
+// Format prints a value the way the REPL does, in a form that read can
+// read back where there is one.
+func Format(v Value) string {
+	return toLispString(v)
+}
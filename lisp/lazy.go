@@ -0,0 +1,125 @@
+package lisp
+
+// A promise holds a computation that is run the first time it is forced.
+// Its value is remembered, so forcing it again returns the same value
+// without running the computation again.
+type promise struct {
+	forced bool
+	value  interface{}
+	thunk  func() interface{}
+}
+
+// delayed returns an unforced promise of the value of the analyzed form
+// code in env.
+func (in *Interpreter) delayed(code *analysis, env *environment) *promise {
+	return &promise{thunk: func() interface{} { return in.evalCode(code, env) }}
+}
+
+// analyzeDelay analyzes a (delay expr) form, which returns a promise to
+// evaluate expr when forced.
+func (sc *scope) analyzeDelay(args []interface{}) *analysis {
+	if len(args) != 1 {
+		panic("delay expects 1 argument")
+	}
+	code := sc.analyze(args[0])
+	return directAnalysis(func(m *machine, env *environment) interface{} { return m.in.delayed(code, env) })
+}
+
+// analyzeStreamCons analyzes a (stream-cons first rest) form, which
+// evaluates first and delays rest.
+func (sc *scope) analyzeStreamCons(args []interface{}) *analysis {
+	if len(args) != 2 {
+		panic("stream-cons expects 2 arguments")
+	}
+	first, rest := sc.analyze(args[0]), sc.analyze(args[1])
+	return &analysis{exec: func(m *machine, env *environment) {
+		m.push(func(m *machine, v interface{}) { m.ret(consValue(primary(v), m.in.delayed(rest, env))) })
+		m.exec(first, env)
+	}}
+}
+
+// force returns the value of a promise, running its computation if it has
+// not been forced yet. Any other value is returned as is.
+func force(x interface{}) interface{} {
+	p, ok := x.(*promise)
+	if !ok {
+		return x
+	}
+	if !p.forced {
+		v := p.thunk()
+		// Forcing the promise from its own computation may have forced it
+		// already, in which case the first value is kept.
+		if !p.forced {
+			p.value, p.forced, p.thunk = v, true, nil
+		}
+	}
+	return p.value
+}
+
+// formatPromise prints a promise in unreadable #<...> syntax.
+func formatPromise(p *promise) string {
+	if p.forced {
+		return "#<PROMISE forced>"
+	}
+	return "#<PROMISE unforced>"
+}
+
+// A stream is a lazy list: either NIL, the empty stream, or a cons whose car
+// is the first element and whose cdr is a promise of the rest of the stream.
+
+// streamCons returns a stream with first in front of the stream promised by rest.
+func streamCons(first interface{}, rest func() interface{}) interface{} {
+	return consValue(first, &promise{thunk: rest})
+}
+
+// streamCar returns the first element of a non-empty stream.
+func streamCar(s interface{}) interface{} {
+	return consArg(s, "stream-car expects a non-empty stream").car
+}
+
+// streamCdr returns the rest of a non-empty stream, forcing it if needed.
+func streamCdr(s interface{}) interface{} {
+	return force(consArg(s, "stream-cdr expects a non-empty stream").cdr)
+}
+
+// streamTake returns a list of the first n elements of a stream, or all of
+// them if it has fewer.
+func streamTake(s interface{}, n int) interface{} {
+	var elems []interface{}
+	for ; n > 0 && s != nil; n-- {
+		elems = append(elems, streamCar(s))
+		if n > 1 {
+			s = streamCdr(s)
+		}
+	}
+	return makeList(elems...)
+}
+
+// streamMap returns the stream of the results of calling fn on each element of s.
+func streamMap(fn, s interface{}, in *Interpreter) interface{} {
+	if s == nil {
+		return nil
+	}
+	return streamCons(in.applyFunction(fn, []interface{}{streamCar(s)}), func() interface{} {
+		return streamMap(fn, streamCdr(s), in)
+	})
+}
+
+// streamFilter returns the stream of the elements of s that satisfy pred.
+// It forces s up to the first such element.
+func streamFilter(pred, s interface{}, in *Interpreter) interface{} {
+	for s != nil && isNil(in.applyFunction(pred, []interface{}{streamCar(s)})) {
+		s = streamCdr(s)
+	}
+	if s == nil {
+		return nil
+	}
+	return streamCons(streamCar(s), func() interface{} {
+		return streamFilter(pred, streamCdr(s), in)
+	})
+}
+
+// integersFrom returns the infinite stream of integers n, n+1, n+2 and so on.
+func integersFrom(n interface{}) interface{} {
+	return streamCons(n, func() interface{} { return integersFrom(numAdd(n, 1)) })
+}
@@ -0,0 +1,1574 @@
+// Package lisp is a Lisp interpreter that Go programs can embed. New
+// returns an Interpreter, which reads and evaluates Lisp source and exchanges
+// values with Go.
+package lisp
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An Alist maps symbols (strings) to their corresponding values (interfaces).
+type Alist map[string]interface{}
+
+// An environment is a frame of lexical variable bindings, chained to the
+// frame of the enclosing scope; nil is the global environment. Frames are
+// shared rather than copied: a closure keeps the frame it was created in,
+// so an assignment to a variable is seen by every form and closure that can
+// see the binding.
+// The analyzer resolves each variable to a frame and an index in it (see
+// scope), so frames hold only values.
+type environment struct {
+	values []interface{}
+	parent *environment
+}
+
+// at returns the location of the value index of the frame depth levels up
+// from e.
+func (e *environment) at(depth, index int) *interface{} {
+	for ; depth > 0; depth-- {
+		e = e.parent
+	}
+	return &e.values[index]
+}
+
+// isNil checks if the given value is considered NIL in Lisp.
+// In Lisp, NIL represents both the empty list and the boolean false.
+func isNil(x interface{}) bool {
+	return x == nil || (isSymbol(x, "NIL"))
+}
+
+// isSymbol checks if x is a symbol matching the given string (case-insensitive).
+func isSymbol(x interface{}, s string) bool {
+	if str, ok := x.(string); ok && strings.ToUpper(str) == strings.ToUpper(s) {
+		return true
+	}
+	return false
+}
+
+// toLispString converts a Go value to its Lisp string representation, the
+// way prin1 prints it.
+func toLispString(obj interface{}) string {
+	return newPrinter(obj, true).printObject(obj)
+}
+
+// princToString converts a Go value to its Lisp string representation the way
+// princ prints it, without quotes around strings or #\ before characters.
+func princToString(obj interface{}) string {
+	return newPrinter(obj, false).printObject(obj)
+}
+
+// A printer prints one value. cycles holds the conses, arrays and structure
+// instances that a cycle in the value returns to, which are printed with a
+// #n= label the first time and as #n# after that; labels numbers the ones
+// printed so far.
+type printer struct {
+	escape bool
+	cycles map[interface{}]bool
+	labels map[interface{}]int
+}
+
+// newPrinter returns a printer for obj.
+func newPrinter(obj interface{}, escape bool) *printer {
+	return &printer{escape: escape, cycles: findCycles(obj)}
+}
+
+// labelled prints x with format, or as its label if a cycle returns to it.
+func (p *printer) labelled(x interface{}, format func() string) string {
+	if !p.cycles[x] {
+		return format()
+	}
+	if n, ok := p.labels[x]; ok {
+		return "#" + strconv.Itoa(n) + "#"
+	}
+	if p.labels == nil {
+		p.labels = make(map[interface{}]int)
+	}
+	n := len(p.labels)
+	p.labels[x] = n
+	return "#" + strconv.Itoa(n) + "=" + format()
+}
+
+// findCycles returns the conses, arrays and structure instances in x that a
+// cycle returns to: those reached again from inside themselves. Shared
+// structure that is not part of a cycle is printed in full each time.
+func findCycles(x interface{}) map[interface{}]bool {
+	switch x.(type) {
+	case *cons, *lispArray, *structInstance:
+	default:
+		return nil
+	}
+	var cycles map[interface{}]bool
+	visiting := make(map[interface{}]bool)
+	enter := func(x interface{}) bool {
+		if visiting[x] {
+			if cycles == nil {
+				cycles = make(map[interface{}]bool)
+			}
+			cycles[x] = true
+			return false
+		}
+		visiting[x] = true
+		return true
+	}
+	var walk func(x interface{})
+	walk = func(x interface{}) {
+		switch v := x.(type) {
+		case *cons:
+			// The cells of a list are walked in a loop rather than by recursion,
+			// and stay visited until the whole list is done.
+			var cells []*cons
+			for c, ok := v, true; ok && enter(c); c, ok = c.cdr.(*cons) {
+				cells = append(cells, c)
+				walk(c.car)
+				if _, more := c.cdr.(*cons); !more {
+					walk(c.cdr)
+				}
+			}
+			for _, c := range cells {
+				delete(visiting, c)
+			}
+		case *lispArray:
+			if enter(v) {
+				for _, e := range v.data {
+					walk(e)
+				}
+				delete(visiting, v)
+			}
+		case *structInstance:
+			if enter(v) {
+				for _, e := range v.values {
+					walk(e)
+				}
+				delete(visiting, v)
+			}
+		}
+	}
+	walk(x)
+	return cycles
+}
+
+// printObject converts a Go value to its Lisp string representation. When
+// p.escape is true, strings and characters are printed so they can be read
+// back.
+func (p *printer) printObject(obj interface{}) string {
+	switch v := obj.(type) {
+	case nil:
+		return "NIL"
+	case string:
+		if isSymbol(v, "T") {
+			return "T"
+		}
+		if isSymbol(v, "NIL") {
+			return "NIL"
+		}
+		return v
+	case int:
+		return fmt.Sprintf("%d", v)
+	case *big.Int:
+		return v.String()
+	case *big.Rat:
+		return v.String()
+	case float64:
+		return formatFloat(v)
+	case *complexNum:
+		return formatComplex(v)
+	case lispChar:
+		if p.escape {
+			return formatChar(v)
+		}
+		return string(rune(v))
+	case *lispString:
+		if p.escape {
+			return formatString(v)
+		}
+		return v.String()
+	case *lispArray:
+		return p.labelled(v, func() string { return p.formatArray(v) })
+	case *hashTable:
+		return formatHashTable(v)
+	case *closure:
+		return formatClosure(v)
+	case *structInstance:
+		return p.labelled(v, func() string { return p.formatStruct(v) })
+	case *structFunction:
+		return "#<FUNCTION " + v.name + ">"
+	case *builtin:
+		return formatBuiltin(v)
+	case *continuation:
+		return "#<CONTINUATION>"
+	case *generator:
+		return "#<GENERATOR>"
+	case *Error:
+		return "#<ERROR " + formatString(newLispString(v.Error())) + ">"
+	case *promise:
+		return formatPromise(v)
+	case *compiledFunction:
+		return formatCompiledFunction(v)
+	case *cons:
+		return p.labelled(v, func() string { return p.formatList(v) })
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// myEval evaluates a Lisp expression in the global environment, returning
+// its primary value.
+func (in *Interpreter) myEval(expr interface{}) interface{} {
+	return primary(in.myEvalValues(expr))
+}
+
+// myEvalValues evaluates a Lisp expression like myEval, but returns all of
+// its values when it returns more or fewer than one (see multipleValues).
+func (in *Interpreter) myEvalValues(expr interface{}) interface{} {
+	return in.execute(func(m *machine) { m.eval(expr) })
+}
+
+// evalCode evaluates the analyzed form code in env, returning its primary value.
+func (in *Interpreter) evalCode(code *analysis, env *environment) interface{} {
+	return primary(in.execute(func(m *machine) { m.exec(code, env) }))
+}
+
+// globalValue returns the global value of a variable. An unbound symbol
+// evaluates to itself.
+func (in *Interpreter) globalValue(name string) interface{} {
+	if val, ok := in.globals[name]; ok {
+		return val
+	}
+	return name
+}
+
+// setGlobal assigns a value to the global value of a variable.
+func (in *Interpreter) setGlobal(name string, value interface{}) interface{} {
+	if in.isConstant(name) {
+		panic("cannot assign to the constant " + name)
+	}
+	in.globals[name] = value
+	return value
+}
+
+// equalp checks if two Lisp values are equal, considering case-insensitivity for symbols.
+func equalp(x, y interface{}) bool {
+	switch xv := x.(type) {
+	case nil:
+		return y == nil
+	case string:
+		if yv, ok := y.(string); ok {
+			return strings.ToUpper(xv) == strings.ToUpper(yv)
+		}
+		return false
+	case int, *big.Int, *big.Rat, float64, *complexNum:
+		return eqlNumbers(xv, y)
+	case lispChar:
+		return xv == y
+	case *lispString:
+		yv, ok := y.(*lispString)
+		return ok && xv.String() == yv.String()
+	case *cons:
+		yv, ok := y.(*cons)
+		return ok && (&listComparison{same: equalp}).equal(xv, yv)
+	default:
+		// Other objects are only equal to themselves.
+		return x == y
+	}
+}
+
+// eqlp checks if two values are EQL: the same symbol (ignoring case), the same
+// list object, or numbers of the same type and value.
+func eqlp(x, y interface{}) bool {
+	if isNil(x) && isNil(y) {
+		return true
+	}
+	switch xv := x.(type) {
+	case string:
+		if yv, ok := y.(string); ok {
+			return strings.ToUpper(xv) == strings.ToUpper(yv)
+		}
+		return false
+	case int, *big.Int, *big.Rat, float64, *complexNum:
+		return eqlNumbers(xv, y)
+	}
+	return x == y
+}
+
+// equalFold checks if two values are EQUALP: like equal, but symbols and
+// strings compare without regard to case and numbers compare with =.
+func equalFold(x, y interface{}) bool {
+	switch xv := x.(type) {
+	case lispChar:
+		yv, ok := y.(lispChar)
+		return ok && charCompareChain("CHAR-EQUAL", []interface{}{xv, yv})
+	case *lispString:
+		yv, ok := y.(*lispString)
+		return ok && strings.EqualFold(xv.String(), yv.String())
+	case *lispArray:
+		yv, ok := y.(*lispArray)
+		return ok && equalpArrays(xv, yv)
+	case *hashTable:
+		yv, ok := y.(*hashTable)
+		return ok && equalpHashTables(xv, yv)
+	case *structInstance:
+		yv, ok := y.(*structInstance)
+		return ok && equalpStructs(xv, yv)
+	}
+	if isNumber(x) {
+		return isNumber(y) && numEqual(x, y)
+	}
+	if xv, ok := x.(*cons); ok {
+		yv, ok := y.(*cons)
+		return ok && (&listComparison{same: equalFold}).equal(xv, yv)
+	}
+	return equalp(x, y)
+}
+
+// A listComparison compares two lists cell by cell, with same comparing
+// the elements that are not conses: equalp for EQUAL, or equalFold for
+// EQUALP. After cycleCheckDepth cells it records the pairs of
+// cells it has compared, and takes a pair met again to be equal, so that
+// comparing circular lists finishes.
+type listComparison struct {
+	same  func(x, y interface{}) bool
+	cells int
+	seen  map[[2]*cons]bool
+}
+
+// cycleCheckDepth is the number of cells a listComparison compares before it
+// starts looking for cycles.
+const cycleCheckDepth = 1000
+
+// equal compares two lists.
+func (lc *listComparison) equal(x, y *cons) bool {
+	for x != y {
+		if lc.cells++; lc.cells > cycleCheckDepth {
+			pair := [2]*cons{x, y}
+			if lc.seen[pair] {
+				return true
+			}
+			if lc.seen == nil {
+				lc.seen = make(map[[2]*cons]bool)
+			}
+			lc.seen[pair] = true
+		}
+		if !lc.element(x.car, y.car) {
+			return false
+		}
+		xn, xok := x.cdr.(*cons)
+		yn, yok := y.cdr.(*cons)
+		if !xok || !yok {
+			return lc.element(x.cdr, y.cdr)
+		}
+		x, y = xn, yn
+	}
+	return true
+}
+
+// element compares two elements of the lists, comparing conses as lists
+// with the same record of the cells compared.
+func (lc *listComparison) element(x, y interface{}) bool {
+	xc, xok := x.(*cons)
+	yc, yok := y.(*cons)
+	switch {
+	case xok && yok:
+		return lc.equal(xc, yc)
+	case xok || yok:
+		return false
+	}
+	return lc.same(x, y)
+}
+
+// bindFormals binds formal parameters to actual arguments in a new frame
+// whose parent is env.
+func bindFormals(formals []interface{}, actuals []interface{}, env *environment) *environment {
+	if len(formals) != len(actuals) {
+		panic("Lambda argument count mismatch")
+	}
+	// Arguments are already evaluated before the function is applied. They
+	// are copied, as the caller may reuse its slice.
+	return &environment{values: append([]interface{}(nil), actuals...), parent: env}
+}
+
+// A closure is a function created by evaluating a lambda expression. It keeps
+// the environment it was created in, so its body can use the variables
+// visible there, and the interpreter it was created by, whose global
+// environment it uses wherever it is called. A function defined by defun is
+// a closure over the environment of the defun with a name.
+type closure struct {
+	name    string
+	formals []interface{}
+	body    []interface{}
+	env     *environment
+	in      *Interpreter
+	code    *bodyCode
+}
+
+// makeClosure creates a closure in the global environment from the rest of
+// a (lambda (formals...) body...) form.
+func (in *Interpreter) makeClosure(lambda []interface{}) *closure {
+	return in.globalScope().analyzeLambda(lambda)(nil)
+}
+
+// applyFunction calls a function value with already evaluated arguments and
+// returns its primary value. The function is either a symbol naming a builtin
+// or user-defined function, or a closure.
+func (in *Interpreter) applyFunction(fn interface{}, args []interface{}) interface{} {
+	return primary(in.applyFunctionValues(fn, args))
+}
+
+// applyFunctionValues calls a function like applyFunction, returning all of its values.
+func (in *Interpreter) applyFunctionValues(fn interface{}, args []interface{}) interface{} {
+	return in.execute(func(m *machine) { m.apply(fn, args) })
+}
+
+// formatClosure prints a closure in unreadable #<...> syntax.
+func formatClosure(c *closure) string {
+	if c.name != "" {
+		return "#<FUNCTION " + c.name + ">"
+	}
+	formals := "()"
+	if len(c.formals) > 0 {
+		formals = toLispString(makeList(c.formals...))
+	}
+	return "#<FUNCTION (LAMBDA " + formals + ")>"
+}
+
+// toList returns the elements of a list, wrapping any other value in a
+// one-element slice.
+func toList(x interface{}) []interface{} {
+	if l, ok := listElements(x); ok {
+		return l
+	}
+	return []interface{}{x}
+}
+
+// isKeyword checks if x is a keyword symbol, such as :test.
+func isKeyword(x interface{}) bool {
+	sym, ok := x.(string)
+	return ok && strings.HasPrefix(sym, ":")
+}
+
+// keywordArgs parses keyword arguments (:name value pairs) for the function
+// called name. The result maps the upper-case keyword names, without the
+// colon, to their values. Keywords not listed in allowed are an error.
+func keywordArgs(name string, args []interface{}, allowed ...string) map[string]interface{} {
+	if len(args)%2 != 0 {
+		panic(name + ": odd number of keyword arguments")
+	}
+	kwargs := make(map[string]interface{})
+	for i := 0; i < len(args); i += 2 {
+		if !isKeyword(args[i]) {
+			panic(name + ": expected a keyword but got " + toLispString(args[i]))
+		}
+		key := strings.ToUpper(args[i].(string)[1:])
+		known := false
+		for _, a := range allowed {
+			known = known || a == key
+		}
+		if !known {
+			panic(name + ": unknown keyword " + toLispString(args[i]))
+		}
+		// The leftmost occurrence of a keyword wins.
+		if _, dup := kwargs[key]; !dup {
+			kwargs[key] = args[i+1]
+		}
+	}
+	return kwargs
+}
+
+// appendHelp recursively appends two lists.
+// Note: This function is defined but not used in the current implementation.
+func appendHelp(x, y []interface{}) []interface{} {
+	if len(x) == 0 {
+		return y
+	}
+	return append([]interface{}{x[0]}, appendHelp(x[1:], y)...)
+}
+
+// boolToT converts a boolean value to Lisp's "T" or NIL.
+func boolToT(b bool) interface{} {
+	if b {
+		return "T"
+	}
+	return nil
+}
+
+// The builtin functions.
+func init() {
+	defBuiltins([]string{"CAR", "FIRST"}, 1, 1, pure, "Return the first element of a list.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		return lispCar(args[0])
+	})
+	defBuiltins([]string{"CDR", "REST"}, 1, 1, pure, "Return the rest of the list after the first element.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		return lispCdr(args[0])
+	})
+	defBuiltin("CONS", 2, 2, pure, "Construct a new list by prepending an element.", func(args []interface{}, in *Interpreter) interface{} {
+		return consValue(args[0], args[1])
+	})
+	defBuiltin("VALUES", 0, many, pure, "Return each argument as a separate value.", func(args []interface{}, in *Interpreter) interface{} {
+		return values(args...)
+	})
+	defBuiltin("VALUES-LIST", 1, 1, pure, "Return the elements of a list as separate values.", func(args []interface{}, in *Interpreter) interface{} {
+		return values(toList(listArg(args[0], "values-list expects a list"))...)
+	})
+	defBuiltin("CONSP", 1, 1, pure, "Check if the argument is a cons cell.", func(args []interface{}, in *Interpreter) interface{} {
+		_, ok := args[0].(*cons)
+		return boolToT(ok)
+	})
+	defBuiltins([]string{"RPLACA", "RPLACD"}, 2, 2, impure, "Destructively replace the car or cdr of a cons, returning the cons.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		c := consArg(args[0], strings.ToLower(up)+" expects a cons")
+		if up == "RPLACA" {
+			c.car = args[1]
+		} else {
+			c.cdr = args[1]
+		}
+		return c
+	})
+	defBuiltin("NCONC", 0, many, impure, "Destructively concatenate lists.", func(args []interface{}, in *Interpreter) interface{} {
+		return nconc(args)
+	})
+	defBuiltin("NREVERSE", 1, 1, impure, "Reverse a list in place, or a vector or string in place.", func(args []interface{}, in *Interpreter) interface{} {
+		switch v := args[0].(type) {
+		case *lispArray:
+			elems := vectorArg(v, "nreverse expects a sequence").elements()
+			for i, j := 0, len(elems)-1; i < j; i, j = i+1, j-1 {
+				elems[i], elems[j] = elems[j], elems[i]
+			}
+			return v
+		case *lispString:
+			for i, j := 0, len(v.runes)-1; i < j; i, j = i+1, j-1 {
+				v.runes[i], v.runes[j] = v.runes[j], v.runes[i]
+			}
+			return v
+		}
+		return nreverse(args[0])
+	})
+	defBuiltin("DELETE", 2, 2, impure, "Destructively remove the elements of a list that are eql to an item.", func(args []interface{}, in *Interpreter) interface{} {
+		if !isList(args[1]) {
+			panic("delete expects a list")
+		}
+		return deleteItem(args[0], args[1])
+	})
+	defBuiltin("NTH", 2, 2, pure, "Return the element of a list at an index, or NIL past its end.", func(args []interface{}, in *Interpreter) interface{} {
+		return nthElement(args[0], args[1])
+	})
+	defBuiltin("NTHCDR", 2, 2, pure, "Return the tail of a list after n cdrs.", func(args []interface{}, in *Interpreter) interface{} {
+		return nthcdr(args[0], args[1])
+	})
+	defBuiltin("APPEND", 0, many, pure, "Concatenate lists; the result shares the last list.", func(args []interface{}, in *Interpreter) interface{} {
+		return appendLists(args)
+	})
+	defBuiltin("REVERSE", 1, 1, pure, "Return a fresh sequence with the elements in reverse order.", func(args []interface{}, in *Interpreter) interface{} {
+		if isList(args[0]) {
+			return reverseList(args[0])
+		}
+		elems := sequenceElements(args[0], "reverse expects a sequence")
+		for i, j := 0, len(elems)-1; i < j; i, j = i+1, j-1 {
+			elems[i], elems[j] = elems[j], elems[i]
+		}
+		return makeSequenceLike(args[0], elems)
+	})
+	defBuiltins([]string{"LAST", "BUTLAST"}, 1, 2, pure, "Return the last n conses of a list, or a copy without them.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		n := 1
+		if len(args) == 2 {
+			n = nthIndex(args[1])
+		}
+		lst := listArg(args[0], strings.ToLower(up)+" expects a list")
+		if up == "LAST" {
+			return lastConses(lst, n)
+		}
+		return butlast(lst, n)
+	})
+	defBuiltin("MEMBER", 2, many, impure, "Return the tail of a list starting with a matching element.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("member", args[2:], "TEST", "TEST-NOT", "KEY")
+		return memberTail(args[0], listArg(args[1], "member expects a list"), newMatcher(kwargs, in))
+	})
+	defBuiltins([]string{"ASSOC", "RASSOC"}, 2, many, impure, "Return the first pair of an association list whose car (or cdr) matches.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		kwargs := keywordArgs(name, args[2:], "TEST", "TEST-NOT", "KEY")
+		lst := listArg(args[1], name+" expects an association list")
+		return assocPair(args[0], lst, newMatcher(kwargs, in), up == "RASSOC")
+	})
+	defMachineBuiltins([]string{"MAPCAR", "MAPC", "MAPCAN", "MAPLIST", "MAPL"}, 2, many, "Apply a function to successive elements (or tails) of one or more lists.", func(up string, m *machine, args []interface{}) {
+		name := strings.ToLower(up)
+		lists := make([]interface{}, len(args)-1)
+		for i, l := range args[1:] {
+			lists[i] = listArg(l, name+" expects lists")
+		}
+		m.callEach(args[0], mapArguments(lists, up == "MAPLIST" || up == "MAPL"), func(m *machine, results []interface{}) {
+			switch up {
+			case "MAPC", "MAPL":
+				m.ret(args[1])
+			case "MAPCAN":
+				m.ret(nconc(results))
+			default:
+				m.ret(makeList(results...))
+			}
+		})
+	})
+	// NOT, EVAL, FUNCALL and APPLY are also special forms, which the
+	// analyzer handles directly; these builtins are their function values.
+	defBuiltin("NOT", 1, 1, pure, "(not x) returns T if x is NIL, and NIL otherwise.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(isNil(args[0]))
+	})
+	defMachineBuiltins([]string{"EVAL"}, 1, 1, "(eval form) evaluates form in the global environment.", func(_ string, m *machine, args []interface{}) {
+		m.eval(args[0])
+	})
+	defMachineBuiltins([]string{"FUNCALL"}, 1, many, "(funcall f arg...) calls f with the args.", func(_ string, m *machine, args []interface{}) {
+		m.apply(args[0], args[1:])
+	})
+	defMachineBuiltins([]string{"APPLY"}, 2, many, "(apply f arg... list) calls f with the args followed by the elements of list.", func(_ string, m *machine, args []interface{}) {
+		m.apply(args[0], append(args[1:len(args)-1:len(args)-1], toList(args[len(args)-1])...))
+	})
+	defMachineBuiltins([]string{"REDUCE"}, 2, many, "Combine the elements of a sequence with a function.", func(_ string, m *machine, args []interface{}) {
+		kwargs := keywordArgs("reduce", args[2:], "INITIAL-VALUE", "FROM-END", "KEY")
+		elems := sequenceElements(args[1], "reduce expects a sequence")
+		if isNil(kwargs["KEY"]) {
+			m.reduceSequence(args[0], elems, kwargs)
+			return
+		}
+		keyArgs := make([][]interface{}, len(elems))
+		for i, e := range elems {
+			keyArgs[i] = []interface{}{e}
+		}
+		m.callEach(kwargs["KEY"], keyArgs, func(m *machine, keys []interface{}) {
+			m.reduceSequence(args[0], keys, kwargs)
+		})
+	})
+	defBuiltins([]string{"REMOVE", "REMOVE-IF", "REMOVE-IF-NOT"}, 2, many, impure, "Return a copy of a sequence without the matching elements.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		kwargs := keywordArgs(name, args[2:], seqKeywords(up, "COUNT")...)
+		return removeMatching(up, args[1], seqMatcher(up, args[0], kwargs, in), kwargs)
+	})
+	defBuiltins([]string{"FIND", "FIND-IF", "FIND-IF-NOT", "POSITION", "POSITION-IF", "POSITION-IF-NOT"}, 2, many, impure, "Return the first matching element of a sequence, or its index.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		kwargs := keywordArgs(name, args[2:], seqKeywords(up)...)
+		elems := sequenceElements(args[1], name+" expects a sequence")
+		i := findPosition(up, elems, seqMatcher(up, args[0], kwargs, in), kwargs)
+		switch {
+		case i < 0:
+			return nil
+		case strings.HasPrefix(up, "POSITION"):
+			return i
+		}
+		return elems[i]
+	})
+	defBuiltins([]string{"COUNT", "COUNT-IF", "COUNT-IF-NOT"}, 2, many, impure, "Count the matching elements of a sequence.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		kwargs := keywordArgs(name, args[2:], seqKeywords(up)...)
+		return countMatching(up, args[1], seqMatcher(up, args[0], kwargs, in), kwargs)
+	})
+	defBuiltins([]string{"SOME", "EVERY", "NOTANY", "NOTEVERY"}, 2, many, impure, "Check a predicate against the elements of one or more sequences.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		return quantify(up, args[0], args[1:], in)
+	})
+	defBuiltins([]string{"SORT", "STABLE-SORT"}, 2, many, impure, "Sort a sequence in place by a predicate.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		kwargs := keywordArgs(name, args[2:], "KEY")
+		return sortSequence(args[0], args[1], kwargs["KEY"], in)
+	})
+	defBuiltin("MERGE", 4, many, impure, "Merge two sorted sequences into a new sequence of the given type.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("merge", args[4:], "KEY")
+		return mergeSequences(args[0], args[1], args[2], args[3], kwargs["KEY"], in)
+	})
+	defBuiltin("REMOVE-DUPLICATES", 1, many, impure, "Return a copy of a sequence without duplicate elements.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("remove-duplicates", args[1:], "TEST", "TEST-NOT", "KEY", "FROM-END")
+		return removeDuplicates(args[0], kwargs, in)
+	})
+	defBuiltin("COPY-SEQ", 1, 1, pure, "Return a fresh copy of a sequence.", func(args []interface{}, in *Interpreter) interface{} {
+		return subseq(args[0], nil, nil)
+	})
+	defBuiltin("FILL", 2, many, impure, "Store an item in each element of a sequence.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("fill", args[2:], "START", "END")
+		return fillSequence(args[0], args[1], kwargs)
+	})
+	defBuiltin("REPLACE", 2, many, impure, "Copy elements of one sequence into another.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("replace", args[2:], "START1", "END1", "START2", "END2")
+		return replaceSequence(args[0], args[1], kwargs)
+	})
+	defBuiltin("MAP", 3, many, impure, "Apply a function to successive elements of sequences, collecting the results in a sequence of the given type, or discarding them for NIL.", func(args []interface{}, in *Interpreter) interface{} {
+		results := mapSequences("map", args[1], args[2:], in)
+		if isNil(args[0]) {
+			return nil
+		}
+		return concatenate(args[0], []interface{}{newVector(results)})
+	})
+	defBuiltin("GET", 2, 3, pure, "Return the value of an indicator on a symbol's property list.", func(args []interface{}, in *Interpreter) interface{} {
+		sym := symbolArg(args[0], "get expects a symbol")
+		if v, found := in.getProperty(sym, args[1]); found || len(args) == 2 {
+			return v
+		}
+		return args[2]
+	})
+	defBuiltin("REMPROP", 2, 2, impure, "Remove an indicator from a symbol's property list.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(in.removeProperty(symbolArg(args[0], "remprop expects a symbol"), args[1]))
+	})
+	defBuiltin("SYMBOL-PLIST", 1, 1, pure, "Return a copy of a symbol's property list.", func(args []interface{}, in *Interpreter) interface{} {
+		plist := in.plists[strings.ToUpper(symbolArg(args[0], "symbol-plist expects a symbol"))]
+		return listOrNil(plist)
+	})
+	defBuiltin("SYMBOL-VALUE", 1, 1, pure, "Return the global value of a symbol.", func(args []interface{}, in *Interpreter) interface{} {
+		return in.symbolValue(symbolArg(args[0], "symbol-value expects a symbol"))
+	})
+	defBuiltin("EQ", 2, 2, pure, "Check if two symbols or numbers are the same.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(eqlp(args[0], args[1]))
+	})
+	defBuiltin("EQL", 2, 2, pure, "Check if two values are EQ, or numbers of the same type and value.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(eqlp(args[0], args[1]))
+	})
+	defBuiltin("EQUAL", 2, 2, pure, "Check if two values are structurally equal.", func(args []interface{}, in *Interpreter) interface{} {
+		if equalp(args[0], args[1]) {
+			return "T"
+		}
+		return nil
+	})
+	defBuiltin("EQUALP", 2, 2, pure, "Check if two values are equal, ignoring case and comparing numbers with =.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(equalFold(args[0], args[1]))
+	})
+	defBuiltin("ATOM", 1, 1, pure, "Check if the argument is an atom (not a list).", func(args []interface{}, in *Interpreter) interface{} {
+		_, ok := args[0].(*cons)
+		return boolToT(!ok)
+	})
+	defBuiltin("MAKE-GENERATOR", 1, many, impure, "(make-generator function arg...) returns a generator that calls function with the args when it is first resumed.", func(args []interface{}, in *Interpreter) interface{} {
+		return &generator{fn: args[0], args: args[1:]}
+	})
+	defBuiltin("NEXT", 1, 2, impure, "(next generator [send]) resumes the generator, sending a value to the yield it is suspended at, and returns the next value and T, or NIL and NIL when it is done.", func(args []interface{}, in *Interpreter) interface{} {
+		g := generatorArg(args[0], "next expects a generator")
+		v, ok := g.next(append(args[1:], nil)[0], in)
+		return values(v, boolToT(ok))
+	})
+	defBuiltin("GENERATOR-DONE-P", 1, 1, impure, "Check if a generator has no more values, running it ahead if needed.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(generatorArg(args[0], "generator-done-p expects a generator").donep(in))
+	})
+	defBuiltin("COMPILE", 1, 2, impure, "(compile name) compiles the function named name in place. (compile name lambda) compiles a lambda expression or closure and defines name as the result, or returns it when name is NIL.", func(args []interface{}, in *Interpreter) interface{} {
+		if len(args) == 1 {
+			name := symbolArg(args[0], "compile expects a function name")
+			in.globals[name] = in.compileFunction(name)
+			return name
+		}
+		name := "LAMBDA"
+		if !isNil(args[0]) {
+			name = symbolArg(args[0], "compile expects a function name")
+		}
+		var fn *compiledFunction
+		if lambda, ok := listElements(args[1]); ok && len(lambda) > 1 && isSymbol(lambda[0], "LAMBDA") {
+			fn = in.compileClosure(name, in.makeClosure(lambda[1:]))
+		} else if c, ok := args[1].(*closure); ok {
+			fn = in.compileClosure(name, c)
+		} else {
+			fn = in.compileFunction(args[1])
+		}
+		if isNil(args[0]) {
+			return fn
+		}
+		in.globals[name] = fn
+		return name
+	})
+	defBuiltin("DISASSEMBLE", 1, 1, impure, "(disassemble function) prints the bytecode of a function, compiling it first if needed.", func(args []interface{}, in *Interpreter) interface{} {
+		fmt.Print(in.compileFunction(args[0]).disassemble())
+		return nil
+	})
+	defBuiltin("ERROR", 1, many, impure, "(error message arg...) signals an error whose message is the message and args printed as if by princ, separated by spaces. (error condition) signals a caught condition again.", func(args []interface{}, in *Interpreter) interface{} {
+		signalError(args)
+		return nil
+	})
+	defBuiltin("ERROR-MESSAGE", 1, 1, pure, "Return the message of a condition as a string.", func(args []interface{}, in *Interpreter) interface{} {
+		e, ok := args[0].(*Error)
+		if !ok {
+			panic("error-message expects a condition")
+		}
+		return newLispString(e.Error())
+	})
+	defBuiltin("FORCE", 1, 1, impure, "Return the value of a promise, computing it the first time.", func(args []interface{}, in *Interpreter) interface{} {
+		return force(args[0])
+	})
+	defBuiltin("MAKE-PROMISE", 1, 1, pure, "(make-promise value) returns a promise already forced to value.", func(args []interface{}, in *Interpreter) interface{} {
+		if p, ok := args[0].(*promise); ok {
+			return p
+		}
+		return &promise{forced: true, value: args[0]}
+	})
+	defBuiltin("PROMISEP", 1, 1, pure, "Check if the argument is a promise.", func(args []interface{}, in *Interpreter) interface{} {
+		_, ok := args[0].(*promise)
+		return boolToT(ok)
+	})
+	defBuiltin("STREAM-CAR", 1, 1, pure, "Return the first element of a stream.", func(args []interface{}, in *Interpreter) interface{} {
+		return streamCar(args[0])
+	})
+	defBuiltin("STREAM-CDR", 1, 1, impure, "Return the rest of a stream, forcing it if needed.", func(args []interface{}, in *Interpreter) interface{} {
+		return streamCdr(args[0])
+	})
+	defBuiltin("STREAM-TAKE", 2, 2, impure, "(stream-take stream n) returns a list of the first n elements.", func(args []interface{}, in *Interpreter) interface{} {
+		return streamTake(args[0], nthIndex(args[1]))
+	})
+	defBuiltin("STREAM-MAP", 2, 2, impure, "(stream-map fn stream) returns the stream of fn applied to each element.", func(args []interface{}, in *Interpreter) interface{} {
+		return streamMap(args[0], args[1], in)
+	})
+	defBuiltin("STREAM-FILTER", 2, 2, impure, "(stream-filter pred stream) returns the stream of the elements satisfying pred.", func(args []interface{}, in *Interpreter) interface{} {
+		return streamFilter(args[0], args[1], in)
+	})
+	defBuiltin("INTEGERS-FROM", 1, 1, pure, "(integers-from n) returns the infinite stream of integers from n.", func(args []interface{}, in *Interpreter) interface{} {
+		return integersFrom(integerArg(args[0], "integers-from expects an integer"))
+	})
+	defBuiltin("NULL", 1, 1, pure, "Check if the argument is NIL.", func(args []interface{}, in *Interpreter) interface{} {
+		if isNil(args[0]) {
+			return "T"
+		}
+		return nil
+	})
+	defBuiltin("LISTP", 1, 1, pure, "Check if the argument is a list.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(isList(args[0]))
+	})
+	defBuiltin("SYMBOLP", 1, 1, pure, "Check if the argument is a symbol.", func(args []interface{}, in *Interpreter) interface{} {
+		_, isStr := args[0].(string)
+		return boolToT(isStr)
+	})
+	defBuiltin("STRINGP", 1, 1, pure, "Check if the argument is a string.", func(args []interface{}, in *Interpreter) interface{} {
+		_, isStr := args[0].(*lispString)
+		return boolToT(isStr)
+	})
+	defBuiltin("CHARACTERP", 1, 1, pure, "Check if the argument is a character.", func(args []interface{}, in *Interpreter) interface{} {
+		_, isChar := args[0].(lispChar)
+		return boolToT(isChar)
+	})
+	defBuiltin("NUMBERP", 1, 1, pure, "Check if the argument is a number.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(isNumber(args[0]))
+	})
+	defBuiltin("PRINT", 1, 1, impure, "Print the argument to the console.", func(args []interface{}, in *Interpreter) interface{} {
+		fmt.Println(toLispString(args[0]))
+		return args[0]
+	})
+	defBuiltins([]string{"PRIN1", "PRINC"}, 1, 1, impure, "Print the argument without a newline, readably for prin1.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		if up == "PRIN1" {
+			fmt.Print(toLispString(args[0]))
+		} else {
+			fmt.Print(princToString(args[0]))
+		}
+		return args[0]
+	})
+	defBuiltin("TERPRI", 0, 0, impure, "Print a newline.", func(args []interface{}, in *Interpreter) interface{} {
+		fmt.Println()
+		return nil
+	})
+	defBuiltins([]string{"CHAR=", "CHAR/=", "CHAR<", "CHAR>", "CHAR<=", "CHAR>=", "CHAR-EQUAL"}, 0, many, pure, "Chained character comparisons by character code.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		return boolToT(charCompareChain(up, args))
+	})
+	defBuiltins([]string{"CHAR-UPCASE", "CHAR-DOWNCASE"}, 1, 1, pure, "Convert a character to upper or lower case.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		c := charArg(args[0], name+" expects a character")
+		if up == "CHAR-UPCASE" {
+			return lispChar(unicode.ToUpper(rune(c)))
+		}
+		return lispChar(unicode.ToLower(rune(c)))
+	})
+	defBuiltin("CHAR-CODE", 1, 1, pure, "Code point of a character.", func(args []interface{}, in *Interpreter) interface{} {
+		return int(charArg(args[0], "char-code expects a character"))
+	})
+	defBuiltin("CODE-CHAR", 1, 1, pure, "Character with the given code point.", func(args []interface{}, in *Interpreter) interface{} {
+		code, ok := args[0].(int)
+		if !ok || !utf8.ValidRune(rune(code)) {
+			panic("code-char expects a valid character code")
+		}
+		return lispChar(code)
+	})
+	defBuiltin("ALPHA-CHAR-P", 1, 1, pure, "Check if a character is alphabetic.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(unicode.IsLetter(rune(charArg(args[0], "alpha-char-p expects a character"))))
+	})
+	defBuiltin("DIGIT-CHAR-P", 1, 2, pure, "Weight of a character as a digit in the given radix (default 10), or NIL.", func(args []interface{}, in *Interpreter) interface{} {
+		radix := 10
+		if len(args) == 2 {
+			r, ok := args[1].(int)
+			if !ok || r < 2 || r > 36 {
+				panic("digit-char-p expects a radix between 2 and 36")
+			}
+			radix = r
+		}
+		w := digitWeight(charArg(args[0], "digit-char-p expects a character"), radix)
+		if w < 0 {
+			return nil
+		}
+		return w
+	})
+	defBuiltin("CHAR", 2, 2, pure, "Character at an index of a string.", func(args []interface{}, in *Interpreter) interface{} {
+		str := stringArg(args[0], "char expects a string")
+		i, ok := args[1].(int)
+		if !ok || i < 0 || i >= len(str.runes) {
+			panic("char: index out of bounds")
+		}
+		return lispChar(str.runes[i])
+	})
+	defBuiltin("STRING", 1, 1, pure, "Coerce a string, symbol or character to a string.", func(args []interface{}, in *Interpreter) interface{} {
+		if str, ok := args[0].(*lispString); ok {
+			return str
+		}
+		return newLispString(stringDesignator(args[0], "string expects a string, symbol or character"))
+	})
+	defBuiltins([]string{"STRING-UPCASE", "STRING-DOWNCASE"}, 1, 1, pure, "Convert a string to upper or lower case.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		str := stringDesignator(args[0], name+" expects a string designator")
+		if up == "STRING-UPCASE" {
+			return newLispString(strings.ToUpper(str))
+		}
+		return newLispString(strings.ToLower(str))
+	})
+	defBuiltin("SUBSEQ", 2, 3, pure, "Copy of part of a string or list.", func(args []interface{}, in *Interpreter) interface{} {
+		var end interface{}
+		if len(args) == 3 {
+			end = args[2]
+		}
+		return subseq(args[0], args[1], end)
+	})
+	defBuiltin("CONCATENATE", 1, many, pure, "Join sequences into a new sequence of the given type.", func(args []interface{}, in *Interpreter) interface{} {
+		return concatenate(args[0], args[1:])
+	})
+	defBuiltins([]string{"STRING-TRIM", "STRING-LEFT-TRIM", "STRING-RIGHT-TRIM"}, 2, 2, pure, "Remove the characters in a bag from the ends of a string.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		str := stringDesignator(args[1], name+" expects a string designator")
+		return stringTrim(args[0], str, up != "STRING-RIGHT-TRIM", up != "STRING-LEFT-TRIM")
+	})
+	defBuiltins([]string{"STRING=", "STRING/=", "STRING<", "STRING>", "STRING<=", "STRING>=", "STRING-EQUAL", "STRING-LESSP"}, 2, 2, pure, "Compare two strings, case-insensitively for string-equal and string-lessp.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		a := stringDesignator(args[0], name+" expects string designators")
+		b := stringDesignator(args[1], name+" expects string designators")
+		return stringCompare(up, a, b)
+	})
+	defBuiltin("SEARCH", 2, 2, pure, "Index of the first occurrence of one sequence in another.", func(args []interface{}, in *Interpreter) interface{} {
+		return searchSequence(args[0], args[1])
+	})
+	defBuiltin("STRING-SPLIT", 1, 2, pure, "Split a string at a separator, or at whitespace when none is given.", func(args []interface{}, in *Interpreter) interface{} {
+		str := stringDesignator(args[0], "string-split expects a string")
+		sep := ""
+		if len(args) == 2 {
+			sep = stringDesignator(args[1], "string-split expects a string or character separator")
+		}
+		return splitString(str, sep)
+	})
+	defBuiltin("STRING-JOIN", 1, 2, pure, "Join a list of strings with an optional separator.", func(args []interface{}, in *Interpreter) interface{} {
+		sep := ""
+		if len(args) == 2 {
+			sep = stringDesignator(args[1], "string-join expects a string or character separator")
+		}
+		var parts []string
+		for _, e := range toList(args[0]) {
+			parts = append(parts, stringDesignator(e, "string-join expects a list of strings"))
+		}
+		return newLispString(strings.Join(parts, sep))
+	})
+	defBuiltin("PARSE-INTEGER", 1, many, pure, "Parse an integer from a string.", func(args []interface{}, in *Interpreter) interface{} {
+		str := stringArg(args[0], "parse-integer expects a string")
+		kwargs := keywordArgs("parse-integer", args[1:], "START", "END", "RADIX", "JUNK-ALLOWED")
+		radix := 10
+		if r, ok := kwargs["RADIX"]; ok {
+			radix, ok = r.(int)
+			if !ok || radix < 2 || radix > 36 {
+				panic("parse-integer: radix must be an integer between 2 and 36")
+			}
+		}
+		n, end := parseIntegerString(str.String(), kwargs["START"], kwargs["END"], radix, !isNil(kwargs["JUNK-ALLOWED"]))
+		return values(n, end)
+	})
+	defBuiltins([]string{"WRITE-TO-STRING", "PRIN1-TO-STRING"}, 1, 1, pure, "Printed representation of a value, readable by the reader.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		return newLispString(toLispString(args[0]))
+	})
+	defBuiltin("PRINC-TO-STRING", 1, 1, pure, "Printed representation of a value without escape characters.", func(args []interface{}, in *Interpreter) interface{} {
+		return newLispString(princToString(args[0]))
+	})
+	defBuiltin("MAKE-ARRAY", 1, many, pure, "Create an array with the given dimensions.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("make-array", args[1:], "INITIAL-ELEMENT", "INITIAL-CONTENTS", "ADJUSTABLE", "FILL-POINTER", "ELEMENT-TYPE")
+		return makeArray(arrayDimensions(args[0]), kwargs)
+	})
+	defBuiltin("VECTOR", 0, many, pure, "Create a simple vector holding the arguments.", func(args []interface{}, in *Interpreter) interface{} {
+		return newVector(append([]interface{}(nil), args...))
+	})
+	defBuiltin("AREF", 1, many, pure, "Element of an array at the given subscripts.", func(args []interface{}, in *Interpreter) interface{} {
+		return aref(args[0], args[1:])
+	})
+	defBuiltin("LENGTH", 1, 1, pure, "Number of elements in a list, string or vector.", func(args []interface{}, in *Interpreter) interface{} {
+		switch v := args[0].(type) {
+		case *lispString:
+			return len(v.runes)
+		case *lispArray:
+			return vectorArg(v, "length expects a sequence").length()
+		case *cons, nil:
+			return len(toList(v))
+		}
+		panic("length expects a sequence")
+	})
+	defBuiltins([]string{"VECTOR-PUSH", "VECTOR-PUSH-EXTEND"}, 2, 3, impure, "Store an element at the fill pointer of a vector and advance it.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		if up == "VECTOR-PUSH" && len(args) > 2 {
+			panic(name + " expects an element and a vector")
+		}
+		extension := 0
+		if len(args) == 3 {
+			n, ok := args[2].(int)
+			if !ok || n < 0 {
+				panic(name + ": extension must be a non-negative integer")
+			}
+			extension = n
+		}
+		return vectorPush(args[0], vectorArg(args[1], name+" expects a vector"), up == "VECTOR-PUSH-EXTEND", extension)
+	})
+	defBuiltin("VECTOR-POP", 1, 1, impure, "Remove and return the last active element of a vector.", func(args []interface{}, in *Interpreter) interface{} {
+		v := vectorArg(args[0], "vector-pop expects a vector")
+		if v.fillPointer <= 0 {
+			panic("vector-pop: vector has no fill pointer or is empty")
+		}
+		v.fillPointer--
+		return v.data[v.fillPointer]
+	})
+	defBuiltin("FILL-POINTER", 1, 1, pure, "Fill pointer of a vector.", func(args []interface{}, in *Interpreter) interface{} {
+		v := vectorArg(args[0], "fill-pointer expects a vector")
+		if v.fillPointer < 0 {
+			panic("fill-pointer: vector has no fill pointer")
+		}
+		return v.fillPointer
+	})
+	defBuiltin("ARRAY-DIMENSIONS", 1, 1, pure, "List of the dimensions of an array.", func(args []interface{}, in *Interpreter) interface{} {
+		a := arrayArg(args[0], "array-dimensions expects an array")
+		dims := make([]interface{}, len(a.dims))
+		for i, d := range a.dims {
+			dims[i] = d
+		}
+		return listOrNil(dims)
+	})
+	defBuiltin("ARRAY-DIMENSION", 2, 2, pure, "Size of one dimension of an array.", func(args []interface{}, in *Interpreter) interface{} {
+		a := arrayArg(args[0], "array-dimension expects an array")
+		axis, ok := args[1].(int)
+		if !ok || axis < 0 || axis >= len(a.dims) {
+			panic("array-dimension: axis out of range")
+		}
+		return a.dims[axis]
+	})
+	defBuiltin("ARRAY-RANK", 1, 1, pure, "Number of dimensions of an array.", func(args []interface{}, in *Interpreter) interface{} {
+		return len(arrayArg(args[0], "array-rank expects an array").dims)
+	})
+	defBuiltin("ARRAY-TOTAL-SIZE", 1, 1, pure, "Total number of elements of an array.", func(args []interface{}, in *Interpreter) interface{} {
+		return len(arrayArg(args[0], "array-total-size expects an array").data)
+	})
+	defBuiltin("ADJUSTABLE-ARRAY-P", 1, 1, pure, "Check if an array is adjustable.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(arrayArg(args[0], "adjustable-array-p expects an array").adjustable)
+	})
+	defBuiltin("MAKE-HASH-TABLE", 0, many, pure, "Create an empty hash table comparing keys with :test (eql by default).", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("make-hash-table", args, "TEST", "SIZE")
+		return newHashTable(kwargs["TEST"])
+	})
+	defBuiltin("GETHASH", 2, 3, pure, "Value stored under a key, or the default (NIL) when there is none, and whether the key was present.", func(args []interface{}, in *Interpreter) interface{} {
+		value, found := hashTableArg(args[1], "gethash expects a hash table").get(args[0])
+		if !found && len(args) == 3 {
+			value = args[2]
+		}
+		return values(value, boolToT(found))
+	})
+	defBuiltin("REMHASH", 2, 2, impure, "Remove the entry for a key, returning T if there was one.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(hashTableArg(args[1], "remhash expects a hash table").remove(args[0]))
+	})
+	defBuiltin("MAPHASH", 2, 2, impure, "Call a function with each key and value of a hash table.", func(args []interface{}, in *Interpreter) interface{} {
+		table := hashTableArg(args[1], "maphash expects a hash table")
+		for _, e := range append([]*hashEntry(nil), table.order...) {
+			in.applyFunction(args[0], []interface{}{e.key, e.value})
+		}
+		return nil
+	})
+	defBuiltin("HASH-TABLE-COUNT", 1, 1, pure, "Number of entries in a hash table.", func(args []interface{}, in *Interpreter) interface{} {
+		return len(hashTableArg(args[0], "hash-table-count expects a hash table").order)
+	})
+	defBuiltin("HASH-TABLE-TEST", 1, 1, pure, "Name of the test a hash table compares keys with.", func(args []interface{}, in *Interpreter) interface{} {
+		return hashTableArg(args[0], "hash-table-test expects a hash table").test
+	})
+	defBuiltin("CLRHASH", 1, 1, impure, "Remove every entry from a hash table.", func(args []interface{}, in *Interpreter) interface{} {
+		table := hashTableArg(args[0], "clrhash expects a hash table")
+		table.clear()
+		return table
+	})
+	defBuiltin("COPY-STRUCTURE", 1, 1, pure, "Shallow copy of a structure instance.", func(args []interface{}, in *Interpreter) interface{} {
+		inst, ok := args[0].(*structInstance)
+		if !ok {
+			panic("copy-structure expects a structure")
+		}
+		return copyStruct(inst)
+	})
+	defBuiltin("HASH-TABLE-P", 1, 1, pure, "Check if the argument is a hash table.", func(args []interface{}, in *Interpreter) interface{} {
+		_, ok := args[0].(*hashTable)
+		return boolToT(ok)
+	})
+	defBuiltins([]string{"ARRAYP", "VECTORP"}, 1, 1, pure, "Check if the argument is an array, or a one-dimensional array.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		a, ok := args[0].(*lispArray)
+		_, isStr := args[0].(*lispString)
+		return boolToT(isStr || (ok && (up == "ARRAYP" || a.isVector())))
+	})
+	defBuiltin("+", 0, many, pure, "Addition of numbers.", func(args []interface{}, in *Interpreter) interface{} {
+		var sum interface{} = 0
+		for _, a := range args {
+			sum = numAdd(sum, numberArg(a, "+ expects numbers"))
+		}
+		return sum
+	})
+	defBuiltin("-", 1, many, pure, "Subtraction of numbers.", func(args []interface{}, in *Interpreter) interface{} {
+		first := numberArg(args[0], "- expects numbers")
+		if len(args) == 1 {
+			// Unary negation.
+			return numNeg(first)
+		}
+		result := first
+		for _, a := range args[1:] {
+			result = numSub(result, numberArg(a, "- expects numbers"))
+		}
+		return result
+	})
+	defBuiltin("*", 0, many, pure, "Multiplication of numbers.", func(args []interface{}, in *Interpreter) interface{} {
+		var prod interface{} = 1
+		for _, a := range args {
+			prod = numMul(prod, numberArg(a, "* expects numbers"))
+		}
+		return prod
+	})
+	defBuiltin("/", 1, many, pure, "Division of numbers. Dividing rationals gives an exact ratio.", func(args []interface{}, in *Interpreter) interface{} {
+		first := numberArg(args[0], "/ expects numbers")
+		if len(args) == 1 {
+			// Unary reciprocal.
+			return numDiv(1, first)
+		}
+		result := first
+		for _, a := range args[1:] {
+			result = numDiv(result, numberArg(a, "/ expects numbers"))
+		}
+		return result
+	})
+	defBuiltins([]string{"=", "/=", "<", ">", "<=", ">="}, 0, many, pure, "Chained numeric comparisons, e.g. (< 1 2 3).", func(up string, args []interface{}, in *Interpreter) interface{} {
+		return boolToT(numCompareChain(up, args))
+	})
+	defBuiltin("1+", 1, 1, pure, "Increment a number by one.", func(args []interface{}, in *Interpreter) interface{} {
+		return numAdd(numberArg(args[0], "1+ expects a number"), 1)
+	})
+	defBuiltin("1-", 1, 1, pure, "Decrement a number by one.", func(args []interface{}, in *Interpreter) interface{} {
+		return numSub(numberArg(args[0], "1- expects a number"), 1)
+	})
+	defBuiltins([]string{"MOD", "REM"}, 2, 2, pure, "Modulus (sign of the divisor) or remainder (sign of the dividend).", func(up string, args []interface{}, in *Interpreter) interface{} {
+		if !isReal(args[0]) || !isReal(args[1]) {
+			panic(strings.ToLower(up) + " expects real numbers")
+		}
+		if numSign(args[1]) == 0 {
+			panic(strings.ToLower(up) + " by zero")
+		}
+		mode := "FLOOR"
+		if up == "REM" {
+			mode = "TRUNCATE"
+		}
+		_, r := numRound(args[0], args[1], mode)
+		return r
+	})
+	defBuiltins([]string{"FLOOR", "CEILING", "TRUNCATE", "ROUND"}, 1, 2, pure, "Round a number, or the quotient of two numbers, to an integer.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		var divisor interface{} = 1
+		if len(args) == 2 {
+			divisor = realArg(args[1], name+" expects real numbers")
+		}
+		q, r := numRound(realArg(args[0], name+" expects real numbers"), divisor, up)
+		return values(q, r)
+	})
+	defBuiltin("LIST", 0, many, pure, "Create a list from the provided arguments.", func(args []interface{}, in *Interpreter) interface{} {
+		return makeList(args...)
+	})
+	defBuiltin("ZEROP", 1, 1, pure, "Check if a number is zero.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(numZerop(numberArg(args[0], "zerop expects a number")))
+	})
+	defBuiltins([]string{"PLUSP", "MINUSP"}, 1, 1, pure, "Check if a real number is strictly positive or strictly negative.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		sign := numSign(realArg(args[0], name+" expects a real number"))
+		return boolToT((up == "PLUSP" && sign > 0) || (up == "MINUSP" && sign < 0))
+	})
+	defBuiltins([]string{"EVENP", "ODDP"}, 1, 1, pure, "Check if an integer is even or odd.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		_, r := intFloor(integerArg(args[0], name+" expects an integer"), 2)
+		return boolToT((up == "EVENP") == (intSign(r) == 0))
+	})
+	defBuiltin("EXPT", 2, 2, pure, "Raise a number to a power.", func(args []interface{}, in *Interpreter) interface{} {
+		base := numberArg(args[0], "expt expects numbers")
+		return numExpt(base, numberArg(args[1], "expt expects numbers"))
+	})
+	defBuiltin("GCD", 0, many, pure, "Greatest common divisor of any number of integers.", func(args []interface{}, in *Interpreter) interface{} {
+		var result interface{} = 0
+		for _, a := range args {
+			result = intGcd(result, integerArg(a, "gcd expects integers"))
+		}
+		return result
+	})
+	defBuiltin("LCM", 0, many, pure, "Least common multiple of any number of integers.", func(args []interface{}, in *Interpreter) interface{} {
+		var result interface{} = 1
+		for _, a := range args {
+			result = intLcm(result, integerArg(a, "lcm expects integers"))
+		}
+		return result
+	})
+	defBuiltin("ISQRT", 1, 1, pure, "Integer square root of a non-negative integer.", func(args []interface{}, in *Interpreter) interface{} {
+		return intIsqrt(integerArg(args[0], "isqrt expects an integer"))
+	})
+	defBuiltin("NUMERATOR", 1, 1, pure, "Numerator of a rational in lowest terms.", func(args []interface{}, in *Interpreter) interface{} {
+		if !isRational(args[0]) {
+			panic("numerator expects a rational")
+		}
+		return numerator(args[0])
+	})
+	defBuiltin("DENOMINATOR", 1, 1, pure, "Denominator of a rational in lowest terms.", func(args []interface{}, in *Interpreter) interface{} {
+		if !isRational(args[0]) {
+			panic("denominator expects a rational")
+		}
+		return denominator(args[0])
+	})
+	defBuiltin("RATIONAL", 1, 1, pure, "Convert a number to the rational with exactly the same value.", func(args []interface{}, in *Interpreter) interface{} {
+		return normalizeRat(toRat(realArg(args[0], "rational expects a real number")))
+	})
+	defBuiltin("RATIONALIZE", 1, 1, pure, "Convert a number to the simplest rational that reads back as the same float.", func(args []interface{}, in *Interpreter) interface{} {
+		if f, ok := realArg(args[0], "rationalize expects a real number").(float64); ok {
+			return rationalizeFloat(f)
+		}
+		return args[0]
+	})
+	defBuiltin("FLOAT", 1, 2, pure, "(float number [prototype]) converts a number to a float in the format of prototype, which must be a float. There is only one float format.", func(args []interface{}, in *Interpreter) interface{} {
+		if len(args) == 2 && numberRank(args[1]) != rankFloat {
+			panic("float expects a float prototype")
+		}
+		return toFloat(realArg(args[0], "float expects a real number"))
+	})
+	defBuiltin("INTEGERP", 1, 1, pure, "Check if the argument is an integer.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(isInteger(args[0]))
+	})
+	defBuiltin("RATIONALP", 1, 1, pure, "Check if the argument is an integer or a ratio.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(isRational(args[0]))
+	})
+	defBuiltin("FLOATP", 1, 1, pure, "Check if the argument is a float.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(numberRank(args[0]) == rankFloat)
+	})
+	defBuiltin("REALP", 1, 1, pure, "Check if the argument is a real number.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(isReal(args[0]))
+	})
+	defBuiltin("COMPLEXP", 1, 1, pure, "Check if the argument is a complex number.", func(args []interface{}, in *Interpreter) interface{} {
+		return boolToT(numberRank(args[0]) == rankComplex)
+	})
+	defBuiltin("COMPLEX", 1, 2, pure, "Build a complex number from its real and imaginary parts.", func(args []interface{}, in *Interpreter) interface{} {
+		re := realArg(args[0], "complex expects real numbers")
+		if len(args) == 1 {
+			return makeComplex(re, imagPart(re))
+		}
+		return makeComplex(re, realArg(args[1], "complex expects real numbers"))
+	})
+	defBuiltin("REALPART", 1, 1, pure, "Real part of a number.", func(args []interface{}, in *Interpreter) interface{} {
+		return realPart(numberArg(args[0], "realpart expects a number"))
+	})
+	defBuiltin("IMAGPART", 1, 1, pure, "Imaginary part of a number.", func(args []interface{}, in *Interpreter) interface{} {
+		return imagPart(numberArg(args[0], "imagpart expects a number"))
+	})
+	defBuiltin("CONJUGATE", 1, 1, pure, "Complex conjugate of a number.", func(args []interface{}, in *Interpreter) interface{} {
+		return conjugate(numberArg(args[0], "conjugate expects a number"))
+	})
+	defBuiltin("PHASE", 1, 1, pure, "Angle of a number in the complex plane.", func(args []interface{}, in *Interpreter) interface{} {
+		return phase(numberArg(args[0], "phase expects a number"))
+	})
+	defBuiltin("SQRT", 1, 1, pure, "Principal square root, complex for negative arguments.", func(args []interface{}, in *Interpreter) interface{} {
+		return numSqrt(numberArg(args[0], "sqrt expects a number"))
+	})
+	defBuiltin("EXP", 1, 1, pure, "e raised to a power.", func(args []interface{}, in *Interpreter) interface{} {
+		return numExp(numberArg(args[0], "exp expects a number"))
+	})
+	defBuiltin("LOG", 1, 2, pure, "Natural logarithm, or logarithm in the given base.", func(args []interface{}, in *Interpreter) interface{} {
+		result := numLog(numberArg(args[0], "log expects numbers"))
+		if len(args) == 2 {
+			result = numDiv(result, numLog(numberArg(args[1], "log expects numbers")))
+		}
+		return result
+	})
+	defBuiltins([]string{"SIN", "COS", "TAN", "ASIN", "ACOS"}, 1, 1, pure, "Trigonometric functions and their inverses.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		return numTrig(up, numberArg(args[0], strings.ToLower(up)+" expects a number"))
+	})
+	defBuiltin("ATAN", 1, 2, pure, "Arc tangent of y, or of y/x in the correct quadrant.", func(args []interface{}, in *Interpreter) interface{} {
+		if len(args) == 1 {
+			return numAtan(numberArg(args[0], "atan expects a number"), nil)
+		}
+		return numAtan(realArg(args[0], "atan expects real numbers"), realArg(args[1], "atan expects real numbers"))
+	})
+	defBuiltin("ABS", 1, 1, pure, "Absolute value of a real, or magnitude of a complex.", func(args []interface{}, in *Interpreter) interface{} {
+		return numAbs(numberArg(args[0], "abs expects a number"))
+	})
+	defBuiltin("SIGNUM", 1, 1, pure, "Sign of a number.", func(args []interface{}, in *Interpreter) interface{} {
+		return numSignum(numberArg(args[0], "signum expects a number"))
+	})
+	defBuiltins([]string{"MIN", "MAX"}, 1, many, pure, "Smallest or largest of one or more real numbers.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		result := realArg(args[0], name+" expects real numbers")
+		for _, a := range args[1:] {
+			c := numCmp(realArg(a, name+" expects real numbers"), result)
+			if (up == "MIN" && c < 0) || (up == "MAX" && c > 0) {
+				result = a
+			}
+		}
+		return result
+	})
+	defBuiltin("ELEM", 2, many, impure, "Check if the first argument is an element of the second argument (a list). It takes the same keyword arguments as member, but compares with equal by default and returns T rather than the tail.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("elem", args[2:], "TEST", "TEST-NOT", "KEY")
+		if _, ok := kwargs["TEST"]; !ok && isNil(kwargs["TEST-NOT"]) {
+			kwargs["TEST"] = "EQUAL"
+		}
+		if !isList(args[1]) {
+			return nil
+		}
+		return boolToT(memberTail(args[0], args[1], newMatcher(kwargs, in)) != nil)
+	})
+	defBuiltin("ADJOIN", 2, many, impure, "Add an item to a list unless a matching element is already present.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("adjoin", args[2:], "TEST", "TEST-NOT", "KEY")
+		return adjoin(args[0], listArg(args[1], "adjoin expects a list"), newMatcher(kwargs, in))
+	})
+	defBuiltins([]string{"UNION", "INTERSECTION", "SET-DIFFERENCE", "SET-EXCLUSIVE-OR", "SUBSETP"}, 2, many, impure, "Set operations on lists, comparing elements by :test of their :key.", func(up string, args []interface{}, in *Interpreter) interface{} {
+		name := strings.ToLower(up)
+		kwargs := keywordArgs(name, args[2:], "TEST", "TEST-NOT", "KEY")
+		a, b := listArg(args[0], name+" expects lists"), listArg(args[1], name+" expects lists")
+		if up == "SUBSETP" {
+			return boolToT(subsetp(a, b, newMatcher(kwargs, in)))
+		}
+		return setOperation(up, a, b, newMatcher(kwargs, in))
+	})
+	defBuiltin("TREE-EQUAL", 2, many, impure, "Check if two trees have the same shape and matching leaves.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("tree-equal", args[2:], "TEST", "TEST-NOT")
+		return boolToT(treeEqual(args[0], args[1], newMatcher(kwargs, in)))
+	})
+	defBuiltin("SUBST", 3, many, impure, "Substitute new for each subtree of a tree that matches old.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("subst", args[3:], "TEST", "TEST-NOT", "KEY")
+		m := newMatcher(kwargs, in)
+		return substTree(args[2], func(x interface{}) (interface{}, bool) {
+			return args[0], m.matches(args[1], x)
+		})
+	})
+	defBuiltin("SUBLIS", 2, many, impure, "Substitute according to an association list for matching subtrees.", func(args []interface{}, in *Interpreter) interface{} {
+		kwargs := keywordArgs("sublis", args[2:], "TEST", "TEST-NOT", "KEY")
+		m := newMatcher(kwargs, in)
+		// The key applies to the subtrees, not to the keys of the pairs.
+		plain := &matcher{test: m.test, testNot: m.testNot, in: in}
+		pairs := listArg(args[0], "sublis expects an association list")
+		return substTree(args[1], func(x interface{}) (interface{}, bool) {
+			pair := assocPair(m.keyOf(x), pairs, plain, false)
+			if pair == nil {
+				return nil, false
+			}
+			return pair.(*cons).cdr, true
+		})
+	})
+	defBuiltin("COPY-TREE", 1, 1, pure, "Copy a tree of conses.", func(args []interface{}, in *Interpreter) interface{} {
+		return copyTree(args[0])
+	})
+}
+
+// tokenize splits the input string into Lisp tokens.
+func tokenize(input string) []string {
+	input = strings.TrimSpace(input)
+	var tokens []string
+	var token strings.Builder
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+		switch ch {
+		case '(':
+			tokens = appendToken(tokens, token)
+			token.Reset()
+			tokens = append(tokens, "(")
+		case ')':
+			tokens = appendToken(tokens, token)
+			token.Reset()
+			tokens = append(tokens, ")")
+		case '\'':
+			tokens = appendToken(tokens, token)
+			token.Reset()
+			tokens = append(tokens, "'")
+		case '"':
+			// A string literal is kept as one token, quotes included, so the
+			// parser can tell it apart from a symbol.
+			tokens = appendToken(tokens, token)
+			token.Reset()
+			end := i + 1
+			for end < len(input) && input[end] != '"' {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				panic("unterminated string")
+			}
+			tokens = append(tokens, input[i:end+1])
+			i = end
+		case '#':
+			if token.Len() == 0 && i+1 < len(input) && input[i+1] == '\\' {
+				// A character literal is #\ followed by any one character and
+				// then the rest of a character name, if there is one.
+				_, size := utf8.DecodeRuneInString(input[i+2:])
+				end := i + 2 + size
+				for end < len(input) && !isDelimiter(input[end]) {
+					end++
+				}
+				tokens = append(tokens, input[i:end])
+				i = end - 1
+			} else {
+				token.WriteByte(ch)
+			}
+		case ' ', '\t', '\n', '\r':
+			if token.Len() > 0 {
+				tokens = appendToken(tokens, token)
+				token.Reset()
+			}
+		default:
+			token.WriteByte(ch)
+		}
+	}
+	tokens = appendToken(tokens, token)
+	return tokens
+}
+
+// isDelimiter checks if ch ends a token.
+func isDelimiter(ch byte) bool {
+	switch ch {
+	case '(', ')', '\'', '"', ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+// appendToken appends the current token to tokens if it's not empty.
+func appendToken(tokens []string, token strings.Builder) []string {
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// parser struct keeps track of the list of tokens and the current position.
+type parser struct {
+	tokens []string
+	pos    int
+	in     *Interpreter
+}
+
+// next returns the next token and advances the position.
+func (p *parser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+// peek returns the next token without advancing the position.
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// parseSExpression parses a single S-expression from the parser.
+func parseSExpression(p *parser) interface{} {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	t := p.next()
+	switch t {
+	case "'":
+		// Handle quoted expressions by converting 'expr to (quote expr).
+		expr := parseSExpression(p)
+		return makeList("quote", expr)
+	case "(":
+		// Parse a list until the corresponding closing parenthesis. A dot
+		// before the last element makes it the cdr of the final cons.
+		var lst []interface{}
+		var tail interface{}
+		for {
+			if p.pos >= len(p.tokens) {
+				panic("unmatched parenthesis")
+			}
+			if p.peek() == ")" {
+				p.next()
+				break
+			}
+			if p.peek() == "." && len(lst) > 0 {
+				p.next()
+				tail = parseSExpression(p)
+				if p.next() != ")" {
+					panic("expected ) after the cdr of a dotted list")
+				}
+				break
+			}
+			lst = append(lst, parseSExpression(p))
+		}
+		return makeDottedList(lst, tail)
+	case ")":
+		// Unexpected closing parenthesis.
+		panic("unexpected )")
+	case "#":
+		switch p.peek() {
+		case "(":
+			// Vector syntax: #(elements...).
+			return readArrayLiteral(1, parseSExpression(p))
+		case "'":
+			// Function syntax: #'f is (function f).
+			p.next()
+			return makeList("function", parseSExpression(p))
+		}
+		panic("# must be followed by ( or '")
+	case "#S", "#s":
+		// Structure syntax: #S(name :slot value...).
+		return readStructLiteral(p.in, parseSExpression(p))
+	case "#c", "#C":
+		// Complex number syntax: #c(real imag).
+		parts, ok := listElements(parseSExpression(p))
+		if !ok || len(parts) != 2 || !isReal(parts[0]) || !isReal(parts[1]) {
+			panic("#c expects a list of two real numbers")
+		}
+		return makeComplex(parts[0], parts[1])
+	default:
+		if strings.HasPrefix(t, "\"") {
+			return parseStringLiteral(t)
+		}
+		if strings.HasPrefix(t, "#\\") {
+			return parseCharacter(t[2:])
+		}
+		// Array syntax: #nA followed by nested lists of contents.
+		if len(t) > 2 && t[0] == '#' && (t[len(t)-1] == 'A' || t[len(t)-1] == 'a') {
+			if rank, err := strconv.Atoi(t[1 : len(t)-1]); err == nil && rank >= 0 {
+				return readArrayLiteral(rank, parseSExpression(p))
+			}
+		}
+		// Try to parse the token as an integer; if it fails, try the other kinds
+		// of numbers, and otherwise treat it as a symbol.
+		if num, err := strconv.Atoi(t); err == nil {
+			return num
+		}
+		if num, ok := parseNumber(t); ok {
+			return num
+		}
+		return t
+	}
+}
+
+// readSExpression tokenizes and parses the input string into an
+// S-expression. Structure literals are read as instances of the structure
+// types of in, which may be nil if there are none.
+func readSExpression(in *Interpreter, input string) interface{} {
+	tokens := tokenize(input)
+	if len(tokens) == 0 {
+		return nil
+	}
+	p := &parser{tokens: tokens, in: in}
+	expr := parseSExpression(p)
+	if p.pos != len(p.tokens) {
+		panic("extra tokens after parse")
+	}
+	return expr
+}
+
+// readAll tokenizes and parses every S-expression in the input string.
+func readAll(in *Interpreter, input string) []interface{} {
+	p := &parser{tokens: tokenize(input), in: in}
+	var forms []interface{}
+	for p.pos < len(p.tokens) {
+		forms = append(forms, parseSExpression(p))
+	}
+	return forms
+}
@@ -0,0 +1,2540 @@
+package lisp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLispFunctions(t *testing.T) {
+	// Start from an empty interpreter
+	interp := New()
+
+	// Define rev
+	evalAndIgnoreError(interp, "(defun rev (L R) (cond ((null L) R) (t (rev (cdr L) (cons (car L) R)))))")
+	// Define my-append
+	evalAndIgnoreError(interp, "(defun my-append (L1 L2) (cond ((null L1) L2) (t (cons (car L1) (my-append (cdr L1) L2)))))")
+	// Define my-attach
+	evalAndIgnoreError(interp, "(defun my-attach (X Y) (my-append Y (cons X nil)))")
+	// Define my-length
+	evalAndIgnoreError(interp, "(defun my-length (l) (cond ((null l) 0) (t (1+ (my-length (cdr l))))))")
+	// Define my-memq
+	evalAndIgnoreError(interp, "(defun my-memq (a l) (cond ((null l) nil) ((eq a (car l)) l) (t (my-memq a (cdr l)))))")
+	// Define my-mapcar
+	evalAndIgnoreError(interp, "(defun my-mapcar (f l) (cond ((null l) nil) (t (cons (apply f (list (car l))) (my-mapcar f (cdr l))))))")
+	// Define my-copy
+	evalAndIgnoreError(interp, "(defun my-copy (l) (cond ((null l) nil) ((atom l) l) (t (cons (my-copy (car l)) (my-copy (cdr l))))))")
+	// Define my-nth
+	evalAndIgnoreError(interp, "(defun my-nth (l n) (cond ((or (null l) (< n 0)) nil) ((= n 0) l)(t (my-nth (cdr l) (1- n)))))")
+	// Define my-remove
+	evalAndIgnoreError(interp, "(defun my-remove (x l) (cond ((null l) nil) ((equal x (car l)) (my-remove x (cdr l))) (t (cons (car l) (my-remove x (cdr l))))))")
+	// Define my-subset
+	evalAndIgnoreError(interp, "(defun my-subset (fn l) (cond ((null l) nil) ((apply fn (list (car l))) (cons (car l) (my-subset fn (cdr l)))) (t (my-subset fn (cdr l)))))")
+	// Define my-add
+	evalAndIgnoreError(interp, "(defun my-add (n1 n2) (cond ((and (null n1) (null n2)) nil) ((null n1) n2) ((null n2) n1) (t (let* ((sum (+ (car n1) (car n2))) (digit (mod sum 10)) (carry (floor sum 10))) (if (or (cdr n1) (cdr n2) (not (zerop carry))) (cons digit (my-add (my-add (cdr n1) (cdr n2)) (list carry))) (cons digit nil))))))")
+	// Define my-merge
+	evalAndIgnoreError(interp, "(defun my-merge (l1 l2) (cond ((null l1) l2) ((null l2) l1) ((< (car l1) (car l2)) (cons (car l1) (my-merge (cdr l1) l2))) (t (cons (car l2) (my-merge l1 (cdr l2))))))")
+	// Define my-sublist with helper function starts-with
+	evalAndIgnoreError(interp, "(defun starts-with (l1 l2) (cond ((null l1) t) ((null l2) nil) ((equal (car l1) (car l2)) (starts-with (cdr l1) (cdr l2))) (t nil)))")
+	evalAndIgnoreError(interp, "(defun my-sublist (l1 l2) (cond ((null l2) nil) ((starts-with l1 l2) t) (t (my-sublist l1 (cdr l2)))))")
+	// Define my-assoc
+	evalAndIgnoreError(interp, "(defun my-assoc (a alist) (cond ((null alist) nil) ((eq a (car (car alist))) (car alist)) (t (my-assoc a (cdr alist)))))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		// HW5 tests
+		{"Testing t", "T", "T"},
+		{"Testing nil", "NIL", "NIL"},
+		{"Testing String", "Hello", "Hello"},
+		{"Testing Number", "10", "10"},
+		{"Testing List", "'(A B C)", "(A B C)"},
+		{"Testing (eq t t)", "(eq t t)", "T"},
+		{"Testing (eq nil nil)", "(eq nil nil)", "T"},
+		{"Testing (eq t nil)", "(eq t nil)", "NIL"},
+		{"Testing (null nil)", "(null nil)", "T"},
+		{"Testing (eq 'a 'a)", "(eq 'a 'a)", "T"},
+		{"Testing (eq '(a b) '(a b))", "(eq '(a b) '(a b))", "NIL"},
+		{"Testing (car '(a b c))", "(car '(a b c))", "a"},
+		{"Testing (cdr '(a b c))", "(cdr '(a b c))", "(b c)"},
+		{"Testing (cons 'd '(a b c))", "(cons 'd '(a b c))", "(d a b c)"},
+		{"Testing (setq a '(a b c))", "(setq a '(a b c))", "(a b c)"},
+		{"Testing (rev '(A B C D E) nil)", "(rev '(A B C D E) nil)", "(E D C B A)"},
+		{"Testing (rev a nil)", "(rev a nil)", "(c b a)"},
+		{"Testing (my-append '((a) (b) (c)) '((d) (e) (f)))", "(my-append '((a) (b) (c)) '((d) (e) (f)))", "((a) (b) (c) (d) (e) (f))"},
+		{"Testing (my-append nil '(d e f))", "(my-append nil '(d e f))", "(d e f)"},
+		{"Testing (my-attach 'd '(a b c))", "(my-attach 'd '(a b c))", "(a b c d)"},
+		{"Testing (my-attach '(a) '(b c))", "(my-attach '(a) '(b c))", "(b c (a))"},
+		{"Testing (cond (nil 1)(t 2)(t 3))", "(cond (nil 1)(t 2)(t 3))", "2"},
+		{"Testing HIDDEN COND", "(cond (nil 1)(t 2)(t 3))", "2"},
+		// The hidden function test just prints a hard-coded list
+		{"Testing HIDDEN FUNCTION", "", "(A B C A B C A B C A B C)"},
+
+		// HW4 tests
+		{"Testing (my-length nil)", "(my-length nil)", "0"},
+		{"Testing (my-length '(a b c))", "(my-length '(a b c))", "3"},
+		{"Testing (my-length '(B (A B C)))", "(my-length '(B (A B C)))", "2"},
+		{"Testing (my-length '(A (((B))) C))", "(my-length '(A (((B))) C))", "3"},
+		{"Testing (my-memq 'A nil)", "(my-memq 'A nil)", "NIL"},
+		{"Testing (my-memq 'B '(A B C))", "(my-memq 'B '(A B C))", "(B C)"},
+		{"Testing (my-memq 'D '(A B C D E F G))", "(my-memq 'D '(A B C D E F G))", "(D E F G)"},
+		{"Testing (my-memq 'D '(A B C D))", "(my-memq 'D '(A B C D))", "(D)"},
+		{"Testing (my-memq 'D '(A B C))", "(my-memq 'D '(A B C))", "NIL"},
+		{"Testing (my-mapcar 'car '((A B C) (X Y Z) (1 2 3)))", "(my-mapcar 'car '((A B C) (X Y Z) (1 2 3)))", "(A X 1)"},
+		{"Testing (my-mapcar 'cdr '((A B C) (X Y Z) (1 2 3)))", "(my-mapcar 'cdr '((A B C) (X Y Z) (1 2 3)))", "((B C) (Y Z) (2 3))"},
+		{"Testing (my-mapcar '1+ '(1 3 5 7))", "(my-mapcar '1+ '(1 3 5 7))", "(2 4 6 8)"},
+		{"Testing (my-mapcar 'atom '(A (B) C (D) E))", "(my-mapcar 'atom '(A (B) C (D) E))", "(T NIL T NIL T)"},
+		{"Testing (my-copy '(A B ((C 1)) 2 3))", "(my-copy '(A B ((C 1)) 2 3))", "(A B ((C 1)) 2 3)"},
+		{"Testing (my-copy '(1 2 3))", "(my-copy '(1 2 3))", "(1 2 3)"},
+		{"Testing (my-copy '(A B . C))", "(my-copy '(A B . C))", "(A B . C)"},
+		{"Testing (eq (setq l '(A (B) C)) (my-copy l))", "(eq (setq l '(A (B) C)) (my-copy l))", "NIL"},
+		{"Testing (my-nth '(A B C D E) 1)", "(my-nth '(A B C D E) 1)", "(B C D E)"},
+		{"Testing (my-nth '(A B C D E) 3)", "(my-nth '(A B C D E) 3)", "(D E)"},
+		{"Testing (my-nth '(A B C D E) 30)", "(my-nth '(A B C D E) 30)", "NIL"},
+		{"Testing (my-nth '(A B C D E) 0)", "(my-nth '(A B C D E) 0)", "(A B C D E)"},
+		{"Testing (my-remove '(A B) '(A B (A B) A A B (A B)))", "(my-remove '(A B) '(A B (A B) A A B (A B)))", "(A B A A B)"},
+		{"Testing (my-remove 'A '(A B (A B) A B))", "(my-remove 'A '(A B (A B) A B))", "(B (A B) B)"},
+		{"Testing (my-subset 'atom '(A (B) (C D) E F G))", "(my-subset 'atom '(A (B) (C D) E F G))", "(A E F G)"},
+		{"Testing (my-subset 'listp '(A (B) (C D) E F G))", "(my-subset 'listp '(A (B) (C D) E F G))", "((B) (C D))"},
+		{"Testing (my-add '(0) '(0))", "(my-add '(0) '(0))", "(0)"},
+		{"Testing (my-add '(1) '(1))", "(my-add '(1) '(1))", "(2)"},
+		{"Testing (my-add '(9) '(9))", "(my-add '(9) '(9))", "(8 1)"},
+		{"Testing (my-add '(1 1 1 1 1 1 1 1 1 1) '(9 9 9 9 9 9 9 9 9 9))", "(my-add '(1 1 1 1 1 1 1 1 1 1) '(9 9 9 9 9 9 9 9 9 9))", "(0 1 1 1 1 1 1 1 1 1 1)"},
+		{"Testing (my-add '(1) '(9 9 9 9 9 9 9 9 9 9))", "(my-add '(1) '(9 9 9 9 9 9 9 9 9 9))", "(0 0 0 0 0 0 0 0 0 0 1)"},
+		{"Testing (my-merge '(1 3 5 7 9) '(2 4 6 8 10))", "(my-merge '(1 3 5 7 9) '(2 4 6 8 10))", "(1 2 3 4 5 6 7 8 9 10)"},
+		{"Testing (my-merge '(1 2 3 7 8 9) '(4 5 6 10))", "(my-merge '(1 2 3 7 8 9) '(4 5 6 10))", "(1 2 3 4 5 6 7 8 9 10)"},
+		{"Testing (my-merge '(1 2 3) '(4 5 6 7 8 9 10))", "(my-merge '(1 2 3) '(4 5 6 7 8 9 10))", "(1 2 3 4 5 6 7 8 9 10)"},
+		{"Testing (my-merge '(1 3 5 6 7 8 9 10) '(2 4))", "(my-merge '(1 3 5 6 7 8 9 10) '(2 4))", "(1 2 3 4 5 6 7 8 9 10)"},
+		{"Testing (my-merge NIL '(1 2 3 4 5 6 7 8 9 10))", "(my-merge NIL '(1 2 3 4 5 6 7 8 9 10))", "(1 2 3 4 5 6 7 8 9 10)"},
+		{"Testing (my-sublist '(1 2 3) '(1 2 3 4 5))", "(my-sublist '(1 2 3) '(1 2 3 4 5))", "T"},
+		{"Testing (my-sublist '(3 4 5) '(1 2 3 4 5))", "(my-sublist '(3 4 5) '(1 2 3 4 5))", "T"},
+		{"Testing (my-sublist '(C D) '(A B C D E))", "(my-sublist '(C D) '(A B C D E))", "T"},
+		{"Testing (my-sublist '(3 4) '(1 2 3 5 6))", "(my-sublist '(3 4) '(1 2 3 5 6))", "NIL"},
+		{"Testing (my-sublist '(1 2 3 4 5) '(3 4 5))", "(my-sublist '(1 2 3 4 5) '(3 4 5))", "NIL"},
+		{"Testing (my-sublist '(2 4) '(1 2 3 4 5))", "(my-sublist '(2 4) '(1 2 3 4 5))", "NIL"},
+		{"Testing (my-sublist '(1 3 5) '(1 2 3 4 5))", "(my-sublist '(1 3 5) '(1 2 3 4 5))", "NIL"},
+		{"Testing (my-assoc 'a nil)", "(my-assoc 'a nil)", "NIL"},
+		{"Testing (my-assoc 'a '((a . b) (c e f) (b)))", "(my-assoc 'a '((a . b) (c e f) (b)))", "(a . b)"},
+		{"Testing (my-assoc 'c '((a . b) (c e f) (b)))", "(my-assoc 'c '((a . b) (c e f) (b)))", "(c e f)"},
+		{"Testing (my-assoc 'b '((a . b) (c e f) (b)))", "(my-assoc 'b '((a . b) (c e f) (b)))", "(b)"},
+		{"Testing (my-assoc 'f '((a . b) (c e f) (b)))", "(my-assoc 'f '((a . b) (c e f) (b)))", "NIL"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			var result string
+			if tc.input != "" {
+				result = evalToString(t, interp, tc.input)
+			} else {
+				// For the HIDDEN FUNCTION test, we just display a hardcoded list
+				result = toLispString(makeList("A", "B", "C", "A", "B", "C", "A", "B", "C", "A", "B", "C"))
+			}
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+// evalAndIgnoreError defines a function but ignores errors
+// to avoid crashing the test if a definition fails.
+func evalAndIgnoreError(interp *Interpreter, expr string) {
+	if _, err := interp.EvalString(expr); err != nil {
+		fmt.Printf("Error defining function with %s: %v\n", expr, err)
+	}
+}
+
+// evalToString evaluates expr and prints its value, failing the test on an error.
+func evalToString(t *testing.T, interp *Interpreter, expr string) string {
+	t.Helper()
+	v, err := interp.EvalString(expr)
+	if err != nil {
+		t.Fatalf("Error evaluating %s: %v", expr, err)
+	}
+	return Format(v)
+}
+
+func TestBignums(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(defun factorial (n) (cond ((= n 0) 1) (t (* n (factorial (1- n))))))")
+	evalAndIgnoreError(interp, "(setq big 123456789012345678901234567890)")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Factorial overflows into a bignum", "(factorial 30)", "265252859812191058636308480000000"},
+		{"Factorial of 20 still fits in a fixnum", "(factorial 20)", "2432902008176640000"},
+		{"Reading a large literal", "big", "123456789012345678901234567890"},
+		{"Addition overflow", "(+ 9223372036854775807 1)", "9223372036854775808"},
+		{"Subtraction overflow", "(- -9223372036854775808 1)", "-9223372036854775809"},
+		{"Negating the smallest fixnum", "(- -9223372036854775808)", "9223372036854775808"},
+		{"Demotion after subtraction", "(- (+ 9223372036854775807 1) 1)", "9223372036854775807"},
+		{"Demoted result is a fixnum", "(eq (- (+ 9223372036854775807 1) 1) 9223372036854775807)", "T"},
+		{"Bignum equality", "(= big 123456789012345678901234567890)", "T"},
+		{"Bignum comparison", "(< 9223372036854775807 big)", "T"},
+		{"Bignum division", "(/ big 10)", "12345678901234567890123456789"},
+		{"Bignum mod", "(mod big 11)", "7"},
+		{"Floor rounds toward negative infinity", "(floor -7 2)", "-4"},
+		{"Mod takes the sign of the divisor", "(mod -7 2)", "1"},
+		{"Bignum equal", "(equal (list big) (list 123456789012345678901234567890))", "T"},
+		{"Bignum numberp", "(numberp big)", "T"},
+		{"Expt", "(expt 2 100)", "1267650600228229401496703205376"},
+		{"Expt with zero exponent", "(expt 5 0)", "1"},
+		{"Gcd", "(gcd 12 18)", "6"},
+		{"Gcd of negatives", "(gcd -12 -18)", "6"},
+		{"Gcd with no arguments", "(gcd)", "0"},
+		{"Gcd of bignums", "(gcd (expt 2 100) (expt 6 50))", "1125899906842624"},
+		{"Lcm", "(lcm 4 6)", "12"},
+		{"Lcm with no arguments", "(lcm)", "1"},
+		{"Lcm of several integers", "(lcm 2 3 4 5)", "60"},
+		{"Isqrt", "(isqrt 17)", "4"},
+		{"Isqrt of a bignum", "(isqrt (expt 10 40))", "100000000000000000000"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestRationalsAndFloats(t *testing.T) {
+	interp := New()
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Division gives an exact ratio", "(/ 1 3)", "1/3"},
+		{"Exact division gives an integer", "(/ 6 3)", "2"},
+		{"Unary division is the reciprocal", "(/ 4)", "1/4"},
+		{"Reading a ratio normalizes it", "'2/4", "1/2"},
+		{"Reading a ratio with denominator one", "'4/2", "2"},
+		{"Reading a negative ratio", "'-6/8", "-3/4"},
+		{"Adding ratios", "(+ 1/3 1/6)", "1/2"},
+		{"Adding ratios back to an integer", "(+ 1/3 2/3)", "1"},
+		{"Multiplying a ratio by an integer", "(* 2/3 3)", "2"},
+		{"Subtracting ratios", "(- 1/2 3/4)", "-1/4"},
+		{"Negating a ratio", "(- 1/2)", "-1/2"},
+		{"Ratio with bignum parts", "(/ (expt 2 70) 3)", "1180591620717411303424/3"},
+		{"Comparing ratios", "(< 1/3 1/2)", "T"},
+		{"Comparing a ratio and an integer", "(> 7/2 3)", "T"},
+		{"Ratio equality", "(= 1/2 2/4)", "T"},
+		{"Numerator", "(numerator 6/4)", "3"},
+		{"Denominator", "(denominator 6/4)", "2"},
+		{"Numerator of an integer", "(numerator 5)", "5"},
+		{"Denominator of an integer", "(denominator 5)", "1"},
+		{"Denominator is always positive", "(denominator -1/3)", "3"},
+		{"Reading a float", "1.5", "1.5"},
+		{"Integral float keeps its point", "2.0", "2.0"},
+		{"Float exponent syntax", "1e3", "1000.0"},
+		{"Large float", "1.5e300", "1.5e300"},
+		{"Float and integer contagion", "(+ 1 0.5)", "1.5"},
+		{"Float and ratio contagion", "(* 1/2 3.0)", "1.5"},
+		{"Float division", "(/ 1.0 4)", "0.25"},
+		{"Float comparison", "(< 0.5 1/2)", "NIL"},
+		{"Float equals ratio numerically", "(= 0.5 1/2)", "T"},
+		{"Float and integer are not eq", "(eq 1.0 1)", "NIL"},
+		{"Float and ratio are not equal", "(equal 0.5 1/2)", "NIL"},
+		{"Rational of a float is exact", "(rational 0.5)", "1/2"},
+		{"Rational of an inexact float", "(rational 0.1)", "3602879701896397/36028797018963968"},
+		{"Rationalize finds the simplest ratio", "(rationalize 0.1)", "1/10"},
+		{"Rationalize a negative float", "(rationalize -0.75)", "-3/4"},
+		{"Rationalize an integral float", "(rationalize 3.0)", "3"},
+		{"Float of a ratio", "(float 1/4)", "0.25"},
+		{"Float with a prototype", "(float 3 1.0)", "3.0"},
+		{"Floor of a ratio", "(floor 7/2)", "3"},
+		{"Floor of a negative float", "(floor -2.5)", "-3"},
+		{"Ceiling of a ratio", "(ceiling 7/2)", "4"},
+		{"Truncate toward zero", "(truncate -7 2)", "-3"},
+		{"Round to even", "(round 5/2)", "2"},
+		{"Round to even from a float", "(round 3.5)", "4"},
+		{"Mod of ratios", "(mod 7/2 1)", "1/2"},
+		{"Mod of floats", "(mod 5.5 2)", "1.5"},
+		{"Rem takes the sign of the dividend", "(rem -7 2)", "-1"},
+		{"Expt with a negative exponent", "(expt 2 -3)", "1/8"},
+		{"Expt of a ratio", "(expt 2/3 3)", "8/27"},
+		{"Expt of a float", "(expt 2.0 3)", "8.0"},
+		{"Zerop of a float", "(zerop 0.0)", "T"},
+		{"1+ of a ratio", "(1+ 1/2)", "3/2"},
+		{"Integerp", "(integerp 4/2)", "T"},
+		{"Rationalp", "(rationalp 1/2)", "T"},
+		{"Floatp", "(floatp 1/2)", "NIL"},
+		{"Dot is still a symbol", "'(a . b)", "(a . b)"},
+		{"Plus sign is still a symbol", "'+", "+"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	for _, input := range []string{"(float 1 2)", "(float 1 'a)", "(float 1 1.0 2.0)"} {
+		if _, err := interp.EvalString(input); err == nil {
+			t.Errorf("Expected an error from %s", input)
+		}
+	}
+}
+
+func TestComplexAndMathFunctions(t *testing.T) {
+	interp := New()
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Square root of -1", "(sqrt -1)", "#c(0 1)"},
+		{"Square root of a negative perfect square", "(sqrt -4)", "#c(0 2)"},
+		{"Square root of a negative float", "(sqrt -4.0)", "#c(0.0 2.0)"},
+		{"Square root of a perfect square", "(sqrt 16)", "4"},
+		{"Square root of a ratio", "(sqrt 9/4)", "3/2"},
+		{"Square root of a non-square", "(sqrt 2)", "1.4142135623730951"},
+		{"Reading a complex", "#c(1 2)", "#c(1 2)"},
+		{"Reading a complex with uppercase syntax", "#C(1/2 -3)", "#c(1/2 -3)"},
+		{"Complex with zero imaginary part is rational", "#c(5 0)", "5"},
+		{"Complex float contagion", "#c(1 2.5)", "#c(1.0 2.5)"},
+		{"Adding complexes", "(+ #c(1 2) #c(3 -2))", "4"},
+		{"Multiplying by i", "(* #c(0 1) #c(0 1))", "-1"},
+		{"Dividing complexes", "(/ #c(1 1) #c(1 -1))", "#c(0 1)"},
+		{"Complex and real contagion", "(+ #c(1 2) 1/2)", "#c(3/2 2)"},
+		{"Complex equality", "(= #c(1 2) #c(1 2))", "T"},
+		{"Complex eql", "(eq #c(1 2) #c(1 2))", "T"},
+		{"Expt of i", "(expt #c(0 1) 3)", "#c(0 -1)"},
+		{"Complex building", "(complex 1 2)", "#c(1 2)"},
+		{"Realpart", "(realpart #c(3 4))", "3"},
+		{"Imagpart", "(imagpart #c(3 4))", "4"},
+		{"Imagpart of a real", "(imagpart 5)", "0"},
+		{"Conjugate", "(conjugate #c(3 4))", "#c(3 -4)"},
+		{"Abs of an exact complex", "(abs #c(3 4))", "5"},
+		{"Abs of a negative ratio", "(abs -1/2)", "1/2"},
+		{"Abs of a negative float", "(abs -2.5)", "2.5"},
+		{"Signum of an integer", "(signum -5)", "-1"},
+		{"Signum of a float", "(signum 2.5)", "1.0"},
+		{"Signum of zero", "(signum 0)", "0"},
+		{"Signum of a complex", "(signum #c(0 2))", "#c(0 1)"},
+		{"Min", "(min 3 1 2)", "1"},
+		{"Max across types", "(max 1 5/2 2.0)", "5/2"},
+		{"Exp of zero", "(exp 0)", "1.0"},
+		{"Natural log of one", "(log 1)", "0.0"},
+		{"Log with a base", "(log 100 10)", "2.0"},
+		{"Log of a negative number is complex", "(realpart (log -1))", "0.0"},
+		{"Sin of zero", "(sin 0)", "0.0"},
+		{"Cos of zero", "(cos 0)", "1.0"},
+		{"Tan of zero", "(tan 0)", "0.0"},
+		{"Asin of one", "(= (asin 1) (/ (atan 1 0) 1))", "T"},
+		{"Acos of one", "(acos 1)", "0.0"},
+		{"Asin outside the real domain is complex", "(complexp (asin 2))", "T"},
+		{"Atan of one argument", "(atan 0)", "0.0"},
+		{"Atan of two arguments", "(atan 1 1)", "0.7853981633974483"},
+		{"Fractional expt", "(expt 4 1/2)", "2.0"},
+		{"Float expt of a float", "(expt 9.0 0.5)", "3.0"},
+		{"Fractional expt of a negative base is complex", "(complexp (expt -8 1/3))", "T"},
+		{"Phase of i", "(= (phase #c(0 1)) (atan 1 0))", "T"},
+		{"Complexp", "(complexp #c(1 1))", "T"},
+		{"Realp of a complex", "(realp #c(1 1))", "NIL"},
+		{"Realp of a ratio", "(realp 1/2)", "T"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestComparisonsAndEquality(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq lst '(1 2 3))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Chained less than", "(< 1 2 3)", "T"},
+		{"Chained less than fails", "(< 1 3 2)", "NIL"},
+		{"Single argument comparison", "(< 5)", "T"},
+		{"Chained greater than", "(> 3 2 1)", "T"},
+		{"Less or equal with ties", "(<= 1 1 2)", "T"},
+		{"Less or equal fails", "(<= 2 1)", "NIL"},
+		{"Greater or equal with ties", "(>= 3 3 1)", "T"},
+		{"Chained equality", "(= 1 1 1)", "T"},
+		{"Chained equality fails", "(= 1 1 2)", "NIL"},
+		{"Not equal for distinct numbers", "(/= 1 2 3)", "T"},
+		{"Not equal checks every pair", "(/= 1 2 1)", "NIL"},
+		{"Comparison across the numeric tower", "(< 1/2 0.75 1 (expt 2 100))", "T"},
+		{"Equality across the numeric tower", "(= 1 1.0 2/2)", "T"},
+		{"Equality of complexes", "(= #c(1 2) #c(1.0 2.0))", "T"},
+		{"Eql of the same fixnum", "(eql 3 3)", "T"},
+		{"Eql of different number types", "(eql 1 1.0)", "NIL"},
+		{"Eql of ratios", "(eql 1/2 2/4)", "T"},
+		{"Eql of bignums", "(eql (expt 2 100) (expt 2 100))", "T"},
+		{"Eql of symbols", "(eql 'a 'A)", "T"},
+		{"Eql of the same list", "(eql lst lst)", "T"},
+		{"Eql of equal lists", "(eql lst '(1 2 3))", "NIL"},
+		{"Eq of the same list", "(eq lst lst)", "T"},
+		{"Equalp compares numbers with =", "(equalp 1 1.0)", "T"},
+		{"Equalp ignores case", "(equalp '(a B) '(A b))", "T"},
+		{"Equalp of nested lists", "(equalp '(1 (2 3/2)) '(1.0 (2 1.5)))", "T"},
+		{"Equalp of different lists", "(equalp '(1 2) '(1 2 3))", "NIL"},
+		{"Equal still distinguishes number types", "(equal '(1) '(1.0))", "NIL"},
+		{"Plusp", "(plusp 1/2)", "T"},
+		{"Plusp of zero", "(plusp 0)", "NIL"},
+		{"Minusp", "(minusp -0.5)", "T"},
+		{"Evenp", "(evenp 4)", "T"},
+		{"Evenp of a negative odd", "(evenp -3)", "NIL"},
+		{"Oddp", "(oddp -3)", "T"},
+		{"Oddp of a bignum", "(oddp (+ (expt 2 100) 1))", "T"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestCharacters(t *testing.T) {
+	interp := New()
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Reading a character", `#\a`, `#\a`},
+		{"Reading an uppercase character", `#\A`, `#\A`},
+		{"Reading Space", `#\Space`, `#\Space`},
+		{"Character names ignore case", `#\space`, `#\Space`},
+		{"Reading Newline", `#\Newline`, `#\Newline`},
+		{"Reading Tab", `#\Tab`, `#\Tab`},
+		{"Reading a code point", `(char-code #\U+03BB)`, "955"},
+		{"Printing a non-ASCII character", `#\U+03BB`, `#\U+03BB`},
+		{"Reading a parenthesis character", `(char-code #\()`, "40"},
+		{"Characters inside a list", `'(#\a #\Space #\))`, `(#\a #\Space #\))`},
+		{"Characters evaluate to themselves", `(list #\x)`, `(#\x)`},
+		{"Char=", `(char= #\a #\a #\a)`, "T"},
+		{"Char= is case-sensitive", `(char= #\a #\A)`, "NIL"},
+		{"Char-equal ignores case", `(char-equal #\a #\A)`, "T"},
+		{"Char<", `(char< #\a #\b #\c)`, "T"},
+		{"Char< fails", `(char< #\b #\a)`, "NIL"},
+		{"Char>", `(char> #\b #\a)`, "T"},
+		{"Char/=", `(char/= #\a #\b)`, "T"},
+		{"Char-upcase", `(char-upcase #\a)`, `#\A`},
+		{"Char-downcase", `(char-downcase #\A)`, `#\a`},
+		{"Char-upcase of a non-letter", `(char-upcase #\1)`, `#\1`},
+		{"Char-code", `(char-code #\A)`, "65"},
+		{"Code-char", "(code-char 97)", `#\a`},
+		{"Code-char of a named character", "(code-char 32)", `#\Space`},
+		{"Alpha-char-p", `(alpha-char-p #\z)`, "T"},
+		{"Alpha-char-p of a digit", `(alpha-char-p #\5)`, "NIL"},
+		{"Digit-char-p", `(digit-char-p #\7)`, "7"},
+		{"Digit-char-p of a letter", `(digit-char-p #\a)`, "NIL"},
+		{"Digit-char-p with a radix", `(digit-char-p #\f 16)`, "15"},
+		{"Characterp", `(characterp #\a)`, "T"},
+		{"Characterp of a symbol", "(characterp 'a)", "NIL"},
+		{"Eql of characters", `(eql #\a #\a)`, "T"},
+		{"Equal of different characters", `(equal #\a #\A)`, "NIL"},
+		{"Equalp of characters ignores case", `(equalp #\a #\A)`, "T"},
+		{"Reading a string", `"hello world"`, `"hello world"`},
+		{"Reading a string with escapes", `"say \"hi\""`, `"say \"hi\""`},
+		{"Stringp", `(stringp "abc")`, "T"},
+		{"Stringp of a symbol", "(stringp 'abc)", "NIL"},
+		{"Char indexes into a string", `(char "hello" 1)`, `#\e`},
+		{"Char of a space", `(char "a b" 1)`, `#\Space`},
+		{"Equal strings", `(equal "abc" "abc")`, "T"},
+		{"Equal is case-sensitive for strings", `(equal "abc" "ABC")`, "NIL"},
+		{"Equalp is case-insensitive for strings", `(equalp "abc" "ABC")`, "T"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	if got := princToString(readSExpression(nil, `("a" #\b)`)); got != "(a b)" {
+		t.Errorf("Expected princ output (a b), got %s", got)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	interp := New()
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"String-upcase", `(string-upcase "Hello")`, `"HELLO"`},
+		{"String-downcase", `(string-downcase "Hello")`, `"hello"`},
+		{"String-upcase of a symbol", "(string-upcase 'abc)", `"ABC"`},
+		{"Subseq of a string", `(subseq "hello world" 6)`, `"world"`},
+		{"Subseq with an end", `(subseq "hello world" 0 5)`, `"hello"`},
+		{"Subseq of a list", "(subseq '(a b c d) 1 3)", "(b c)"},
+		{"Concatenate strings", `(concatenate 'string "foo" "bar" "baz")`, `"foobarbaz"`},
+		{"Concatenate a list of characters into a string", `(concatenate 'string "ab" (list #\c))`, `"abc"`},
+		{"Concatenate into a list", `(concatenate 'list "ab" '(1))`, `(#\a #\b 1)`},
+		{"String-trim", `(string-trim " " "  padded  ")`, `"padded"`},
+		{"String-trim with a list bag", `(string-trim (list #\- #\*) "-*-x-*-")`, `"x"`},
+		{"String-left-trim", `(string-left-trim " " "  x  ")`, `"x  "`},
+		{"String-right-trim", `(string-right-trim " " "  x  ")`, `"  x"`},
+		{"String=", `(string= "abc" "abc")`, "T"},
+		{"String= is case-sensitive", `(string= "abc" "ABC")`, "NIL"},
+		{"String-equal ignores case", `(string-equal "abc" "ABC")`, "T"},
+		{"String= with a symbol", `(string= 'abc "abc")`, "T"},
+		{"String< returns the mismatch index", `(string< "apple" "apricot")`, "2"},
+		{"String< of a prefix", `(string< "ab" "abc")`, "2"},
+		{"String< fails", `(string< "b" "a")`, "NIL"},
+		{"String< of equal strings", `(string< "a" "a")`, "NIL"},
+		{"String>", `(string> "b" "a")`, "0"},
+		{"String<= of equal strings", `(string<= "abc" "abc")`, "3"},
+		{"Search in a string", `(search "lo" "hello")`, "3"},
+		{"Search for a missing substring", `(search "xyz" "hello")`, "NIL"},
+		{"Search in a list", "(search '(c d) '(a b c d e))", "2"},
+		{"String-split on a character", `(string-split "a,b,,c" #\,)`, `("a" "b" "" "c")`},
+		{"String-split on whitespace", `(string-split "  one two   three ")`, `("one" "two" "three")`},
+		{"String-split on a string", `(string-split "a::b" "::")`, `("a" "b")`},
+		{"String-join", `(string-join (list "a" "b" "c") ", ")`, `"a, b, c"`},
+		{"String-join without a separator", `(string-join (list "a" "b"))`, `"ab"`},
+		{"Parse-integer", `(parse-integer "123")`, "123"},
+		{"Parse-integer with whitespace and sign", `(parse-integer "  -42 ")`, "-42"},
+		{"Parse-integer of a bignum", `(parse-integer "123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{"Parse-integer with a radix", `(parse-integer "ff" :radix 16)`, "255"},
+		{"Parse-integer with bounds", `(parse-integer "abc123def" :start 3 :end 6)`, "123"},
+		{"Parse-integer with junk allowed", `(parse-integer "12abc" :junk-allowed t)`, "12"},
+		{"Parse-integer of junk", `(parse-integer "abc" :junk-allowed t)`, "NIL"},
+		{"Write-to-string", `(write-to-string '(a "b" #\c 1/2))`, `"(a \"b\" #\\c 1/2)"`},
+		{"Prin1-to-string of a string", `(prin1-to-string "hi")`, `"\"hi\""`},
+		{"Princ-to-string of a string", `(princ-to-string "hi")`, `"hi"`},
+		{"String of a symbol", "(string 'foo)", `"foo"`},
+		{"String of a character", `(string #\a)`, `"a"`},
+		{"String of a string", `(string "x")`, `"x"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestArrays(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq v #(1 2 3))")
+	evalAndIgnoreError(interp, "(setq grid (make-array '(2 3) :initial-element 0))")
+	evalAndIgnoreError(interp, "(setq stack (make-array 2 :fill-pointer 0 :adjustable t))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Reading a vector", "#(1 2 3)", "#(1 2 3)"},
+		{"Vector elements are not evaluated", "#(a (b c) \"d\")", `#(a (b c) "d")`},
+		{"Empty vector", "#()", "#()"},
+		{"Vector function", "(vector 1 (+ 1 1) 'c)", "#(1 2 c)"},
+		{"Make-array with an initial element", "(make-array 3 :initial-element 'x)", "#(x x x)"},
+		{"Make-array with initial contents", "(make-array 3 :initial-contents '(a b c))", "#(a b c)"},
+		{"Aref", "(aref v 1)", "2"},
+		{"Aref of a string", `(aref "abc" 2)`, `#\c`},
+		{"Setf aref", "(setf (aref v 0) 'first)", "first"},
+		{"Setf aref is visible through the variable", "v", "#(first 2 3)"},
+		{"Length of a vector", "(length v)", "3"},
+		{"Length of a list", "(length '(a b c d))", "4"},
+		{"Length of a string", `(length "hello")`, "5"},
+		{"Length of nil", "(length nil)", "0"},
+		{"Two-dimensional array prints with #2A", "grid", "#2A((0 0 0) (0 0 0))"},
+		{"Setf of a two-dimensional aref", "(setf (aref grid 1 2) 5)", "5"},
+		{"Aref of a two-dimensional array", "(aref grid 1 2)", "5"},
+		{"Array-dimensions", "(array-dimensions grid)", "(2 3)"},
+		{"Array-dimension", "(array-dimension grid 1)", "3"},
+		{"Array-rank", "(array-rank grid)", "2"},
+		{"Array-total-size", "(array-total-size grid)", "6"},
+		{"Reading a two-dimensional array", "#2A((1 2) (3 4))", "#2A((1 2) (3 4))"},
+		{"Aref of a read two-dimensional array", "(aref #2A((1 2) (3 4)) 1 0)", "3"},
+		{"Make-array with nested initial contents", "(make-array '(2 2) :initial-contents '((a b) (c d)))", "#2A((a b) (c d))"},
+		{"Empty vector with a fill pointer", "stack", "#()"},
+		{"Vector-push-extend returns the index", "(vector-push-extend 'a stack)", "0"},
+		{"Vector-push-extend again", "(vector-push-extend 'b stack)", "1"},
+		{"Vector-push-extend grows the vector", "(vector-push-extend 'c stack)", "2"},
+		{"Vector with a fill pointer prints active elements", "stack", "#(a b c)"},
+		{"Fill-pointer", "(fill-pointer stack)", "3"},
+		{"Length respects the fill pointer", "(length stack)", "3"},
+		{"Vector-pop", "(vector-pop stack)", "c"},
+		{"Vector-push into spare room", "(vector-push 'd stack)", "2"},
+		{"Array-dimensions of a grown vector", "(>= (car (array-dimensions stack)) 3)", "T"},
+		{"Vector-push onto a full vector", "(vector-push 1 (make-array 1 :fill-pointer 1))", "NIL"},
+		{"Adjustable-array-p", "(adjustable-array-p stack)", "T"},
+		{"Vectorp", "(vectorp v)", "T"},
+		{"Vectorp of a two-dimensional array", "(vectorp grid)", "NIL"},
+		{"Arrayp of a two-dimensional array", "(arrayp grid)", "T"},
+		{"Vectorp of a list", "(vectorp '(1 2))", "NIL"},
+		{"Equalp compares vector elements", "(equalp #(1 2) (vector 1.0 2))", "T"},
+		{"Equal compares vectors by identity", "(equal #(1 2) #(1 2))", "NIL"},
+		{"Eq of the same vector", "(eq v v)", "T"},
+		{"Subseq of a vector", "(subseq #(a b c d) 1 3)", "#(b c)"},
+		{"Concatenate into a vector", "(concatenate 'vector #(1 2) '(3))", "#(1 2 3)"},
+		{"Vectors inside lists", "(list #(1) #(2))", "(#(1) #(2))"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestHashTables(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq h (make-hash-table))")
+	evalAndIgnoreError(interp, "(setq he (make-hash-table :test 'equal))")
+	evalAndIgnoreError(interp, "(setq hp (make-hash-table :test #'equalp))")
+	evalAndIgnoreError(interp, "(setq key '(1 2))")
+	evalAndIgnoreError(interp, "(setq seen nil)")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Empty hash table count", "(hash-table-count h)", "0"},
+		{"Setf gethash returns the value", "(setf (gethash 'a h) 1)", "1"},
+		{"Gethash of a stored key", "(gethash 'a h)", "1"},
+		{"Symbol keys ignore case", "(gethash 'A h)", "1"},
+		{"Gethash of a missing key", "(gethash 'b h)", "NIL"},
+		{"Gethash with a default", "(gethash 'b h 'none)", "none"},
+		{"Setf gethash replaces a value", "(setf (gethash 'a h) 2)", "2"},
+		{"Gethash of a replaced value", "(gethash 'a h)", "2"},
+		{"Setf gethash with a list key", "(setf (gethash key h) 'list)", "list"},
+		{"Eql table uses list identity", "(gethash key h)", "list"},
+		{"Eql table does not match an equal list", "(gethash '(1 2) h)", "NIL"},
+		{"Setf gethash with a number key", "(setf (gethash 1 h) 'int)", "int"},
+		{"Eql table distinguishes number types", "(gethash 1.0 h)", "NIL"},
+		{"Setf gethash with a bignum key", "(setf (gethash (expt 2 100) h) 'big)", "big"},
+		{"Eql table matches bignums by value", "(gethash (expt 2 100) h)", "big"},
+		{"Hash-table-count", "(hash-table-count h)", "4"},
+		{"Remhash of a present key", "(remhash 'a h)", "T"},
+		{"Remhash of a missing key", "(remhash 'a h)", "NIL"},
+		{"Count after remhash", "(hash-table-count h)", "3"},
+		{"Setf gethash in an equal table", "(setf (gethash '(1 2) he) 'found)", "found"},
+		{"Equal table matches equal lists", "(gethash (list 1 2) he)", "found"},
+		{"Setf gethash with a string key", `(setf (gethash "key" he) 'str)`, "str"},
+		{"Equal table matches equal strings", `(gethash "key" he)`, "str"},
+		{"Equal table is case-sensitive for strings", `(gethash "KEY" he)`, "NIL"},
+		{"Equal table distinguishes a symbol from a string", `(gethash 'key he)`, "NIL"},
+		{"Setf gethash in an equalp table", `(setf (gethash "Key" hp) 'x)`, "x"},
+		{"Equalp table ignores string case", `(gethash "KEY" hp)`, "x"},
+		{"Setf gethash with a number key in an equalp table", "(setf (gethash 1 hp) 'one)", "one"},
+		{"Equalp table compares numbers with =", "(gethash 1.0 hp)", "one"},
+		{"Setf gethash with a vector key", "(setf (gethash #(1 2) hp) 'vec)", "vec"},
+		{"Equalp table compares vectors by elements", "(gethash (vector 1 2) hp)", "vec"},
+		{"Maphash returns nil", "(maphash #'(lambda (k v) (setq seen (cons k seen))) he)", "NIL"},
+		{"Maphash visits every entry", "seen", `("key" (1 2))`},
+		{"Maphash with a named function", "(maphash 'list he)", "NIL"},
+		{"Clrhash empties the table", "(hash-table-count (clrhash he))", "0"},
+		{"Hash-table-p", "(hash-table-p h)", "T"},
+		{"Hash-table-p of a list", "(hash-table-p '(a))", "NIL"},
+		{"Hash-table-test", "(hash-table-test hp)", "EQUALP"},
+		{"Printing a hash table", "(make-hash-table :test 'equal)", "#<HASH-TABLE :TEST EQUAL :COUNT 0>"},
+		{"Lambda evaluates to a closure", "(funcall (lambda (x) (* x x)) 4)", "16"},
+		{"Closures capture their environment", "(let ((n 10)) (funcall (lambda (x) (+ x n)) 1))", "11"},
+		{"Lambda in function position", "((lambda (x y) (list y x)) 1 2)", "(2 1)"},
+		{"Function of a builtin", "(funcall #'car '(a b))", "a"},
+		{"Apply with spread arguments", "(apply #'+ 1 2 '(3 4))", "10"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestDefstruct(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(defstruct point x y)")
+	evalAndIgnoreError(interp, "(defstruct (point3 (:include point)) (z 0))")
+	evalAndIgnoreError(interp, "(defstruct (account (:conc-name acct-) (:constructor new-account)) (owner \"nobody\") (balance 0 :read-only t))")
+	evalAndIgnoreError(interp, "(setq p (make-point :x 1 :y 2))")
+	evalAndIgnoreError(interp, "(setq q (make-point3 :x 1 :z 3))")
+	evalAndIgnoreError(interp, "(defstruct (vec (:constructor make-vec) (:constructor vec (x y &optional (z 0) &rest more))) x y z more (w 'none))")
+	evalAndIgnoreError(interp, "(defstruct (opt (:constructor make-opt (a &key (b 2) c &aux (d 'aux)))) a (b 0) (c 'init) d)")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Defstruct returns the name", "(defstruct thing a)", "thing"},
+		{"Constructor with keyword arguments", "p", "#S(point :x 1 :y 2)"},
+		{"Constructor in any keyword order", "(make-point :y 5 :x 4)", "#S(point :x 4 :y 5)"},
+		{"Unsupplied slots default to nil", "(make-point :x 1)", "#S(point :x 1 :y NIL)"},
+		{"Accessor", "(point-x p)", "1"},
+		{"Second accessor", "(point-y p)", "2"},
+		{"Predicate", "(point-p p)", "T"},
+		{"Predicate of a non-structure", "(point-p '(1 2))", "NIL"},
+		{"Setf of an accessor", "(setf (point-x p) 10)", "10"},
+		{"Setf is visible through the accessor", "(point-x p)", "10"},
+		{"Copier makes a fresh copy", "(let ((c (copy-point p))) (setf (point-x c) 99) (list (point-x p) (point-x c)))", "(10 99)"},
+		{"Copy-structure", "(copy-structure p)", "#S(point :x 10 :y 2)"},
+		{"Included slots come first", "q", "#S(point3 :x 1 :y NIL :z 3)"},
+		{"Slot initform of a subtype", "(point3-z (make-point3))", "0"},
+		{"Parent accessor works on a subtype", "(point-x q)", "1"},
+		{"Subtype accessor of an inherited slot", "(point3-x q)", "1"},
+		{"Parent predicate accepts a subtype", "(point-p q)", "T"},
+		{"Subtype predicate rejects the parent", "(point3-p p)", "NIL"},
+		{"Conc-name and constructor options", "(new-account :owner \"ann\")", `#S(account :owner "ann" :balance 0)`},
+		{"Accessor with a conc-name", "(acct-owner (new-account))", `"nobody"`},
+		{"Reading #S syntax", "#S(point :x 3 :y 4)", "#S(point :x 3 :y 4)"},
+		{"Accessor of a read structure", "(point-y #S(point :x 3 :y 4))", "4"},
+		{"Equalp compares slots", "(equalp (make-point :x 1 :y 2) #S(point :x 1.0 :y 2))", "T"},
+		{"Equal compares structures by identity", "(equal (make-point :x 1) (make-point :x 1))", "NIL"},
+		{"Structures inside lists", "(list (make-point :x 1 :y 2))", "(#S(point :x 1 :y 2))"},
+		{"Accessors can be passed as functions", "(funcall #'point-y p)", "2"},
+		{"A BOA constructor", "(vec 1 2)", "#S(vec :x 1 :y 2 :z 0 :more NIL :w none)"},
+		{"A BOA constructor's optional and rest arguments", "(vec 1 2 3 4 5)", "#S(vec :x 1 :y 2 :z 3 :more (4 5) :w none)"},
+		{"A keyword constructor alongside a BOA one", "(make-vec :y 2 :w 'given)", "#S(vec :x NIL :y 2 :z NIL :more NIL :w given)"},
+		{"BOA keyword arguments", "(make-opt 1 :c 3)", "#S(opt :a 1 :b 2 :c 3 :d aux)"},
+		{"BOA keyword defaults", "(make-opt 1)", "#S(opt :a 1 :b 2 :c init :d aux)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Too few BOA arguments", "(vec 1)"},
+		{"Too many BOA arguments", "(make-opt 1 2)"},
+		{"An unknown BOA keyword", "(make-opt 1 :z 2)"},
+		{"A BOA argument that names no slot", "(defstruct (bad (:constructor make-bad (q))) a)"},
+		{"A constructor option with extra elements", "(defstruct (bad (:constructor make-bad (a) extra)) a)"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+}
+
+func TestPlaces(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(defstruct point x y)")
+	evalAndIgnoreError(interp, "(setq p (make-point :x 1 :y 2))")
+	evalAndIgnoreError(interp, "(setq v (vector 1 2 3))")
+	evalAndIgnoreError(interp, "(setq h (make-hash-table))")
+	evalAndIgnoreError(interp, "(setq n 0)")
+	evalAndIgnoreError(interp, "(defun next-index () (setq n (1+ n)))")
+	evalAndIgnoreError(interp, "(defun middle (l) (car (cdr l)))")
+	evalAndIgnoreError(interp, "(defun set-middle (l v) (setf (car (cdr l)) v))")
+	evalAndIgnoreError(interp, "(defsetf middle set-middle)")
+	evalAndIgnoreError(interp, "(defun second-of (l) (nth 1 l))")
+	evalAndIgnoreError(interp, "(defsetf second-of (l) (store) (list 'setf (list 'nth 1 l) store))")
+	evalAndIgnoreError(interp, "(defun my-first (l) (car l))")
+	evalAndIgnoreError(interp, "(defsetf my-first (l) (v) (list 'rplaca l v))")
+	evalAndIgnoreError(interp, "(define-setf-expander last-of (l) (values '(tmp) (list l) '(store) '(setf (nth (- (length tmp) 1) tmp) store) '(nth (- (length tmp) 1) tmp)))")
+	evalAndIgnoreError(interp, "(defconstant limit 10)")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Setf of a variable", "(setf l (list 1 2 3))", "(1 2 3)"},
+		{"Setf with several pairs returns the last value", "(setf a 1 b 2)", "2"},
+		{"Setf of car", "(setf (car l) 10)", "10"},
+		{"Car place is updated", "l", "(10 2 3)"},
+		{"Setf of cdr", "(setf (cdr l) '(20 30))", "(20 30)"},
+		{"Cdr place is updated", "l", "(10 20 30)"},
+		{"Setf of nth", "(setf (nth 2 l) 99)", "99"},
+		{"Nth place is updated", "l", "(10 20 99)"},
+		{"Setf of aref", "(setf (aref v 0) 'x)", "x"},
+		{"Aref place is updated", "v", "#(x 2 3)"},
+		{"Setf of gethash", "(setf (gethash 'k h) 5)", "5"},
+		{"Setf of get", "(setf (get 'sym 'color) 'red)", "red"},
+		{"Get reads the property", "(get 'sym 'color)", "red"},
+		{"Get with a default", "(get 'sym 'size 'none)", "none"},
+		{"Symbol-plist", "(symbol-plist 'sym)", "(color red)"},
+		{"Remprop", "(remprop 'sym 'color)", "T"},
+		{"Property is removed", "(get 'sym 'color)", "NIL"},
+		{"Setf of symbol-value", "(setf (symbol-value 'gv) 7)", "7"},
+		{"Symbol-value reads the global value", "(symbol-value 'gv)", "7"},
+		{"Setf of a struct accessor", "(setf (point-y p) 8)", "8"},
+		{"Incf a variable", "(incf a)", "2"},
+		{"Incf with a delta", "(incf a 10)", "12"},
+		{"Decf a variable", "(decf a 2)", "10"},
+		{"Incf a hash entry with a default", "(incf (gethash 'c h 0))", "1"},
+		{"Incf a struct slot", "(incf (point-x p) 5)", "6"},
+		{"Incf of aref with a side-effecting index", "(incf (aref v (next-index)))", "3"},
+		{"The index was computed once", "n", "1"},
+		{"Push onto a variable", "(setq s nil)", "NIL"},
+		{"Push returns the new list", "(push 1 s)", "(1)"},
+		{"Push again", "(push 2 s)", "(2 1)"},
+		{"Pop returns the first element", "(pop s)", "2"},
+		{"Pop updates the place", "s", "(1)"},
+		{"Pushnew adds a new element", "(pushnew 3 s)", "(3 1)"},
+		{"Pushnew skips an existing element", "(pushnew 1 s)", "(3 1)"},
+		{"Pushnew with :test", "(pushnew \"a\" s :test #'equal)", "(\"a\" 3 1)"},
+		{"Pushnew with :test finds the element", "(pushnew \"a\" s :test #'equal)", "(\"a\" 3 1)"},
+		{"Clear a struct slot", "(setf (point-y p) nil)", "NIL"},
+		{"Push onto a struct slot", "(push 'z (point-y p))", "(z)"},
+		{"Setup rotatef", "(setq r (list 1 2 3))", "(1 2 3)"},
+		{"Rotatef returns nil", "(rotatef (car r) (nth 1 r) (nth 2 r))", "NIL"},
+		{"Rotatef rotates the places", "r", "(2 3 1)"},
+		{"Shiftf returns the old first value", "(shiftf (car r) (nth 1 r) 'new)", "2"},
+		{"Shiftf shifts the places", "r", "(3 new 1)"},
+		{"Defsetf short form", "(setf (middle r) 'm)", "m"},
+		{"Short form updates the place", "r", "(3 m 1)"},
+		{"Defsetf long form", "(setf (second-of r) 'long)", "long"},
+		{"Long form updates the place", "r", "(3 long 1)"},
+		{"Incf through a defsetf place", "(setf (second-of r) 41)", "41"},
+		{"Incf of a user place", "(incf (second-of r))", "42"},
+		{"Define-setf-expander", "(setf (last-of r) 'end)", "end"},
+		{"Expander updates the place", "r", "(3 42 end)"},
+		{"Reading through the expander", "(shiftf (last-of r) 'fin)", "end"},
+		{"Shiftf through the expander", "r", "(3 42 fin)"},
+		{"A defsetf storing form is evaluated", "(let ((l (list 1 2))) (setf (my-first l) 99) l)", "(99 2)"},
+		{"The storing form sees the place's arguments evaluated once", "(progn (setq n 0) (let ((ls (list (list 1) (list 2)))) (setf (my-first (nth (next-index) ls)) 'x) (list n ls)))", "(1 ((1) (x)))"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Setf of symbol-value on a constant", "(setf (symbol-value 'limit) 3)"},
+		{"A setf expander that returns a list", "(progn (define-setf-expander listed (x) (list '(tmp) (list x) '(store) 'store 'tmp)) (setf (listed 1) 2))"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+	t.Run("The constant keeps its value", func(t *testing.T) {
+		if result := evalToString(t, interp, "limit"); result != "10" {
+			t.Errorf("Expected 10, got %s", result)
+		}
+	})
+}
+
+func TestDestructiveListOperations(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq l '(A (B) C))")
+	evalAndIgnoreError(interp, "(setq m (cdr l))")
+	evalAndIgnoreError(interp, "(setq x (list 1 2 3))")
+	evalAndIgnoreError(interp, "(setq y (list 4 5))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Setq returns the very list it stored", "(eq (setq k '(A (B) C)) k)", "T"},
+		{"Cdr shares structure with the list", "(eq (cdr l) m)", "T"},
+		{"Car of a shared tail is the same object", "(eq (car (cdr l)) (car m))", "T"},
+		{"Cons shares its tail", "(eq (cdr (cons 'z l)) l)", "T"},
+		{"Dotted pair", "(cons 'a 'b)", "(a . b)"},
+		{"Consp", "(list (consp l) (consp nil) (consp 'a))", "(T NIL NIL)"},
+		{"Rplaca returns the cons", "(rplaca m 'X)", "(X C)"},
+		{"Rplaca is visible through the other reference", "l", "(A X C)"},
+		{"Rplacd", "(rplacd m '(D E))", "(X D E)"},
+		{"Rplacd is visible through the other reference", "l", "(A X D E)"},
+		{"Setf of car on a shared tail", "(setf (car (cdr m)) 'Q)", "Q"},
+		{"Setf of car is visible through the other reference", "l", "(A X Q E)"},
+		{"Setf of cdr", "(setf (cdr (cdr m)) nil)", "NIL"},
+		{"Setf of cdr is visible through the other reference", "l", "(A X Q)"},
+		{"Setf of cdr makes a dotted list", "(setf (cdr (cdr m)) 'end)", "end"},
+		{"Dotted list prints with a dot", "l", "(A X Q . end)"},
+		{"Nconc returns the first list", "(setq z (nconc x y))", "(1 2 3 4 5)"},
+		{"Nconc modifies the first list", "x", "(1 2 3 4 5)"},
+		{"Nconc shares the last list", "(eq (cdr (cdr (cdr x))) y)", "T"},
+		{"Changing the shared list is visible in the result", "(rplaca y 40)", "(40 5)"},
+		{"The nconc result sees the change", "z", "(1 2 3 40 5)"},
+		{"Nconc skips empty lists", "(nconc nil (list 1) nil (list 2))", "(1 2)"},
+		{"Nconc with a non-list last argument", "(nconc (list 1 2) 3)", "(1 2 . 3)"},
+		{"Nconc of nothing", "(nconc)", "NIL"},
+		{"Nreverse", "(setq r (nreverse x))", "(5 40 3 2 1)"},
+		{"Nreverse reuses the cells", "(eq (cdr (cdr (cdr (cdr r)))) x)", "T"},
+		{"Old head is now the last cell", "x", "(1)"},
+		{"Nreverse of a vector", "(nreverse (vector 1 2 3))", "#(3 2 1)"},
+		{"Nreverse of a string", "(nreverse (string-upcase \"abc\"))", "\"CBA\""},
+		{"Delete", "(setq d (list 'a 'b 'a 'c))", "(a b a c)"},
+		{"Delete removes matching elements", "(delete 'a d)", "(b c)"},
+		{"Delete unlinks cells in place", "d", "(a b c)"},
+		{"Delete keeps unmatched cells", "(let ((e (list 1 2 3))) (eq (cdr (delete 1 e)) (cdr (cdr e))))", "T"},
+		{"Delete from an empty list", "(delete 'a nil)", "NIL"},
+		{"A variable is eq to itself", "(let ((f (list 1 2))) (eq f f))", "T"},
+		{"Copy via cons is not eq", "(eq l (cons (car l) (cdr l)))", "NIL"},
+		{"Copy via cons is equal", "(equal l (cons (car l) (cdr l)))", "T"},
+		{"Eql on lists is identity", "(eql (list 1) (list 1))", "NIL"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	evalAndIgnoreError(interp, "(setq ring (list 1 2 3))")
+	evalAndIgnoreError(interp, "(rplacd (cdr (cdr ring)) ring)")
+	evalAndIgnoreError(interp, "(setq twin (list 1 2 3))")
+	evalAndIgnoreError(interp, "(rplacd (cdr (cdr twin)) twin)")
+	evalAndIgnoreError(interp, "(setq self (list 1 2))")
+	circularTests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Printing a circular list", "ring", "#0=(1 2 3 . #0#)"},
+		{"Printing a list that contains itself", "(let ((c (list 1 2))) (rplaca (cdr c) c) c)", "#0=(1 #0#)"},
+		{"Printing a vector that contains itself", "(let ((v (vector 1 nil))) (setf (aref v 1) v) v)", "#0=#(1 #0#)"},
+		{"Shared structure without a cycle prints in full", "(let ((s (list 1))) (list s s))", "((1) (1))"},
+		{"Nconc a list with itself", "(progn (nconc self self) 'ok)", "ok"},
+		{"The list now loops back to itself", "(eq (cdr (cdr self)) self)", "T"},
+		{"Equal on the same circular list", "(equal ring ring)", "T"},
+		{"Equal on alike circular lists", "(equal ring twin)", "T"},
+		{"Equal on different circular lists", "(equal ring self)", "NIL"},
+		{"Equalp on circular lists", "(equalp ring twin)", "T"},
+	}
+	for _, tc := range circularTests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+		message     string
+	}{
+		{"Length of a dotted pair", "(length '(a . b))", "(a . b) is not a proper list"},
+		{"Reverse of a dotted list", "(reverse '(a b . c))", "(a b . c) is not a proper list"},
+		{"Apply with a dotted argument list", "(apply #'list 1 '(2 . 3))", "(2 . 3) is not a proper list"},
+		{"Length of a circular list", "(length ring)", "a circular list is not a proper list"},
+		{"Reverse of a circular list", "(reverse ring)", "a circular list is not a proper list"},
+		{"Nreverse of a circular list", "(nreverse ring)", "nreverse expects a proper list, not a circular one"},
+		{"Nconc onto a circular list", "(nconc ring (list 4))", "nconc: only the last argument can be a circular list"},
+		{"A circular key of an EQUAL hash table", "(gethash ring (make-hash-table :test 'equal))", "a circular object cannot be a key of an EQUAL hash table"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil || err.Error() != tc.message {
+				t.Errorf("Expected the error %q from %s, got %v", tc.message, tc.input, err)
+			}
+		})
+	}
+}
+
+func TestListLibrary(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq l (list 1 2 3 4))")
+	evalAndIgnoreError(interp, "(setq pairs '((a . 1) (b . 2) (\"c\" . 3)))")
+	evalAndIgnoreError(interp, "(defun add (x y) (+ x y))")
+
+	// A long list checks that the builtins do not recurse on the list length.
+	elems := make([]interface{}, 100000)
+	for i := range elems {
+		elems[i] = i
+	}
+	interp.Define("big", makeList(elems...))
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Append", "(append '(1 2) '(3) nil '(4 5))", "(1 2 3 4 5)"},
+		{"Append with no arguments", "(append)", "NIL"},
+		{"Append shares the last list", "(eq (cdr (append '(0) l)) l)", "T"},
+		{"Append copies the other lists", "(eq (append l nil) l)", "NIL"},
+		{"Append with an atom last", "(append '(1) 2)", "(1 . 2)"},
+		{"Reverse", "(reverse l)", "(4 3 2 1)"},
+		{"Reverse leaves the list alone", "l", "(1 2 3 4)"},
+		{"Reverse a string", "(reverse \"abc\")", "\"cba\""},
+		{"Reverse a vector", "(reverse #(1 2 3))", "#(3 2 1)"},
+		{"Length", "(length l)", "4"},
+		{"Nth", "(nth 2 l)", "3"},
+		{"Nth past the end", "(nth 10 l)", "NIL"},
+		{"Nthcdr", "(nthcdr 2 l)", "(3 4)"},
+		{"Nthcdr shares structure", "(eq (nthcdr 1 l) (cdr l))", "T"},
+		{"Nthcdr past the end", "(nthcdr 10 l)", "NIL"},
+		{"Last", "(last l)", "(4)"},
+		{"Last with a count", "(last l 2)", "(3 4)"},
+		{"Last of a dotted list", "(last '(1 2 . 3))", "(2 . 3)"},
+		{"Butlast", "(butlast l)", "(1 2 3)"},
+		{"Butlast with a count", "(butlast l 3)", "(1)"},
+		{"Butlast of too short a list", "(butlast l 9)", "NIL"},
+		{"Member", "(member 3 l)", "(3 4)"},
+		{"Member not found", "(member 9 l)", "NIL"},
+		{"Member uses eql by default", "(member \"b\" '(\"a\" \"b\"))", "NIL"},
+		{"Member with :test", "(member \"b\" '(\"a\" \"b\") :test #'equal)", "(\"b\")"},
+		{"Member with :key", "(member 2 '((1) (2) (3)) :key #'car)", "((2) (3))"},
+		{"Member with :test-not", "(member 1 l :test-not #'eql)", "(2 3 4)"},
+		{"Assoc", "(assoc 'b pairs)", "(b . 2)"},
+		{"Assoc not found", "(assoc 'z pairs)", "NIL"},
+		{"Assoc with :test", "(assoc \"c\" pairs :test #'equal)", "(\"c\" . 3)"},
+		{"Assoc skips nil elements", "(assoc 'a '(nil (a . 1)))", "(a . 1)"},
+		{"Rassoc", "(rassoc 2 pairs)", "(b . 2)"},
+		{"Rassoc with :key", "(rassoc 4 pairs :key #'1+)", "(\"c\" . 3)"},
+		{"Remove", "(remove 2 '(1 2 3 2))", "(1 3)"},
+		{"Remove with :test", "(remove 2 l :test #'<)", "(1 2)"},
+		{"Remove with :key", "(remove 'a '((a 1) (b 2)) :key #'car)", "((b 2))"},
+		{"Remove leaves the list alone", "l", "(1 2 3 4)"},
+		{"Mapcar", "(mapcar #'1+ l)", "(2 3 4 5)"},
+		{"Mapcar with several lists", "(mapcar #'+ '(1 2 3) '(10 20 30))", "(11 22 33)"},
+		{"Mapcar stops at the shortest list", "(mapcar #'list '(a b c) '(1 2))", "((a 1) (b 2))"},
+		{"Mapcar with a lambda", "(mapcar (lambda (x) (* x x)) l)", "(1 4 9 16)"},
+		{"Mapcar with a user function", "(mapcar 'add '(1 2) '(3 4))", "(4 6)"},
+		{"Mapc returns its first list", "(mapc #'1+ l)", "(1 2 3 4)"},
+		{"Mapcan", "(mapcan (lambda (x) (if (oddp x) (list x x) nil)) l)", "(1 1 3 3)"},
+		{"Maplist", "(maplist #'length l)", "(4 3 2 1)"},
+		{"Maplist with several lists", "(maplist #'append '(1 2) '(3 4))", "((1 2 3 4) (2 4))"},
+		{"Reduce", "(reduce #'+ l)", "10"},
+		{"Reduce is left-associative", "(reduce #'list l)", "(((1 2) 3) 4)"},
+		{"Reduce from the end", "(reduce #'list l :from-end t)", "(1 (2 (3 4)))"},
+		{"Reduce with an initial value", "(reduce #'+ l :initial-value 100)", "110"},
+		{"Reduce with :key", "(reduce #'+ '((1) (2)) :key #'car)", "3"},
+		{"Reduce of an empty list calls the function", "(reduce #'+ nil)", "0"},
+		{"Reduce of one element", "(reduce #'+ '(5))", "5"},
+		{"Reduce a vector", "(reduce #'* #(1 2 3 4))", "24"},
+		{"Length of a long list", "(length big)", "100000"},
+		{"Last of a long list", "(last big)", "(99999)"},
+		{"Reduce a long list", "(reduce #'+ big)", "4999950000"},
+		{"Mapcar over a long list", "(length (mapcar #'1+ big))", "100000"},
+		{"Append a long list", "(length (append big big))", "200000"},
+		{"Reverse a long list", "(car (reverse big))", "99999"},
+		{"Member in a long list", "(member 99999 big)", "(99999)"},
+		{"Remove from a long list", "(length (remove 5 big))", "99999"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestSequenceFunctions(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq l (list 3 1 4 1 5 9 2 6))")
+	evalAndIgnoreError(interp, "(setq v (vector 3 1 4 1 5))")
+	evalAndIgnoreError(interp, "(setq s (copy-seq \"hello\"))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Remove-if on a list", "(remove-if #'evenp l)", "(3 1 1 5 9)"},
+		{"Remove-if-not on a vector", "(remove-if-not #'oddp v)", "#(3 1 1 5)"},
+		{"Remove-if on a string", "(remove-if #'alpha-char-p \"a1b2\")", "\"12\""},
+		{"Remove on a vector", "(remove 1 v)", "#(3 4 5)"},
+		{"Remove with :count", "(remove 1 l :count 1)", "(3 4 1 5 9 2 6)"},
+		{"Remove with :count from the end", "(remove 1 l :count 1 :from-end t)", "(3 1 4 5 9 2 6)"},
+		{"Remove with :start", "(remove 1 '(1 1 1) :start 1)", "(1)"},
+		{"Remove-if with :key", "(remove-if #'zerop '((0) (1)) :key #'car)", "((1))"},
+		{"Find", "(find 4 v)", "4"},
+		{"Find not found", "(find 7 l)", "NIL"},
+		{"Find in a string", "(find #\\l s)", "#\\l"},
+		{"Find with :test", "(find \"b\" '(\"a\" \"b\") :test #'string=)", "\"b\""},
+		{"Find-if", "(find-if #'evenp l)", "4"},
+		{"Find-if from the end", "(find-if #'evenp l :from-end t)", "6"},
+		{"Find-if with :key", "(find-if #'plusp '((-1 a) (2 b)) :key #'car)", "(2 b)"},
+		{"Position", "(position 1 l)", "1"},
+		{"Position from the end", "(position 1 l :from-end t)", "3"},
+		{"Position in a string", "(position #\\l s)", "2"},
+		{"Position not found", "(position 7 v)", "NIL"},
+		{"Position-if", "(position-if #'evenp v)", "2"},
+		{"Count", "(count 1 l)", "2"},
+		{"Count-if", "(count-if #'oddp l)", "5"},
+		{"Count-if on a string", "(count-if #'alpha-char-p \"a1b2c\")", "3"},
+		{"Count-if-not", "(count-if-not #'oddp v)", "1"},
+		{"Some returns the predicate value", "(some #'evenp l)", "T"},
+		{"Some with several sequences", "(some #'> '(1 2 3) '(3 2 1))", "T"},
+		{"Some returns nil", "(some #'zerop v)", "NIL"},
+		{"Every", "(every #'plusp l)", "T"},
+		{"Every fails", "(every #'oddp v)", "NIL"},
+		{"Every on a string", "(every #'alpha-char-p \"abc\")", "T"},
+		{"Every of an empty sequence", "(every #'oddp nil)", "T"},
+		{"Notany", "(notany #'minusp l)", "T"},
+		{"Notany fails", "(notany #'evenp v)", "NIL"},
+		{"Notevery", "(notevery #'oddp v)", "T"},
+		{"Sort a list", "(sort (list 3 1 2) #'<)", "(1 2 3)"},
+		{"Sort a vector in place", "(sort v #'<)", "#(1 1 3 4 5)"},
+		{"The vector is sorted", "v", "#(1 1 3 4 5)"},
+		{"Sort a string", "(sort s #'char<)", "\"ehllo\""},
+		{"Sort with :key", "(sort (list '(b 2) '(a 1) '(c 3)) #'string< :key #'car)", "((a 1) (b 2) (c 3))"},
+		{"Stable-sort keeps equal elements in order", "(stable-sort (list '(1 a) '(0 b) '(1 c) '(0 d)) #'< :key #'car)", "((0 b) (0 d) (1 a) (1 c))"},
+		{"Merge lists", "(merge 'list '(1 3 5 7 9) '(2 4 6 8 10) #'<)", "(1 2 3 4 5 6 7 8 9 10)"},
+		{"Merge with an empty list", "(merge 'list nil '(1 2 3) #'<)", "(1 2 3)"},
+		{"Merge into a vector", "(merge 'vector #(1 4) '(2 3) #'<)", "#(1 2 3 4)"},
+		{"Merge with :key", "(merge 'list '((1 a) (3 b)) '((2 c)) #'< :key #'car)", "((1 a) (2 c) (3 b))"},
+		{"Merge prefers the first sequence on ties", "(merge 'list '((1 a)) '((1 b)) #'< :key #'car)", "((1 a) (1 b))"},
+		{"Remove-duplicates keeps the last occurrence", "(remove-duplicates '(a b a c b))", "(a c b)"},
+		{"Remove-duplicates from the end", "(remove-duplicates '(a b a c b) :from-end t)", "(a b c)"},
+		{"Remove-duplicates with :test", "(remove-duplicates '(\"a\" \"A\" \"b\") :test #'string-equal)", "(\"A\" \"b\")"},
+		{"Remove-duplicates with :key", "(remove-duplicates '((1 a) (2 b) (1 c)) :key #'car)", "((2 b) (1 c))"},
+		{"Remove-duplicates on a string", "(remove-duplicates \"abracadabra\")", "\"cdbra\""},
+		{"Subseq of a list", "(subseq l 2 4)", "(4 1)"},
+		{"Subseq of a vector", "(subseq #(1 2 3 4) 1)", "#(2 3 4)"},
+		{"Copy-seq of a list", "(let ((c (copy-seq l))) (list (equal c l) (eq c l)))", "(T NIL)"},
+		{"Copy-seq of a vector", "(copy-seq #(1 2))", "#(1 2)"},
+		{"Fill a list", "(fill (list 1 2 3) 0)", "(0 0 0)"},
+		{"Fill with bounds", "(fill (vector 1 2 3 4) 'x :start 1 :end 3)", "#(1 x x 4)"},
+		{"Fill a string", "(fill (copy-seq \"abc\") #\\z)", "\"zzz\""},
+		{"Replace", "(replace (list 1 2 3 4) '(a b))", "(a b 3 4)"},
+		{"Replace with bounds", "(replace (vector 1 2 3 4) #(a b c) :start1 1 :start2 1)", "#(1 b c 4)"},
+		{"Replace into a string", "(replace (copy-seq \"hello\") \"J\")", "\"Jello\""},
+		{"Map to a list", "(map 'list #'1+ #(1 2 3))", "(2 3 4)"},
+		{"Map to a vector", "(map 'vector #'+ '(1 2) #(10 20 30))", "#(11 22)"},
+		{"Map to a string", "(map 'string #'char-upcase \"abc\")", "\"ABC\""},
+		{"Map with a nil result type", "(map nil #'1+ '(1 2))", "NIL"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq tree '(a (b c) (d (b c))))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Union", "(union '(a b c) '(b d))", "(a b c d)"},
+		{"Union with :test", "(union '(\"a\") '(\"A\" \"b\") :test #'string-equal)", "(\"a\" \"b\")"},
+		{"Union with :key", "(union '((1 a)) '((1 b) (2 c)) :key #'car)", "((1 a) (2 c))"},
+		{"Intersection", "(intersection '(a b c) '(c a d))", "(a c)"},
+		{"Intersection with :test", "(intersection '(\"a\" \"b\") '(\"b\") :test #'equal)", "(\"b\")"},
+		{"Intersection of disjoint lists", "(intersection '(1 2) '(3))", "NIL"},
+		{"Set-difference", "(set-difference '(1 2 3 4) '(2 4))", "(1 3)"},
+		{"Set-difference with :key", "(set-difference '((1 a) (2 b)) '((2 z)) :key #'car)", "((1 a))"},
+		{"Set-exclusive-or", "(set-exclusive-or '(1 2 3) '(3 4))", "(1 2 4)"},
+		{"Subsetp", "(subsetp '(1 3) '(1 2 3))", "T"},
+		{"Subsetp fails", "(subsetp '(1 5) '(1 2 3))", "NIL"},
+		{"Subsetp of nil", "(subsetp nil '(1))", "T"},
+		{"Subsetp with :test", "(subsetp '(\"a\") '(\"a\" \"b\") :test #'equal)", "T"},
+		{"Adjoin a new item", "(adjoin 'x '(a b))", "(x a b)"},
+		{"Adjoin an existing item", "(adjoin 'a '(a b))", "(a b)"},
+		{"Adjoin applies the key to the item", "(adjoin '(1 new) '((1 old)) :key #'car)", "((1 old))"},
+		{"Setup pushnew", "(setq s (list 1 2))", "(1 2)"},
+		{"Pushnew with :key", "(pushnew '(2 x) s :key (lambda (e) (if (consp e) (car e) e)))", "(1 2)"},
+		{"Tree-equal", "(tree-equal '(a (b 1)) '(a (b 1)))", "T"},
+		{"Tree-equal uses eql by default", "(tree-equal '(\"a\") '(\"a\"))", "NIL"},
+		{"Tree-equal with :test", "(tree-equal '(\"a\") '(\"a\") :test #'equal)", "T"},
+		{"Tree-equal with different shapes", "(tree-equal '(a b) '(a (b)))", "NIL"},
+		{"Subst", "(subst 'x 'b tree)", "(a (x c) (d (x c)))"},
+		{"Subst of a subtree", "(subst 'x '(b c) tree :test #'equal)", "(a x (d x))"},
+		{"Subst leaves the tree alone", "tree", "(a (b c) (d (b c)))"},
+		{"Subst shares unchanged subtrees", "(eq (car (cdr (subst 'z 'd tree))) (car (cdr tree)))", "T"},
+		{"Sublis", "(sublis '((b . 1) (c . 2)) tree)", "(a (1 2) (d (1 2)))"},
+		{"Sublis with :test", "(sublis '(((b c) . bc)) tree :test #'equal)", "(a bc (d bc))"},
+		{"Copy-tree is equal", "(equal (copy-tree tree) tree)", "T"},
+		{"Copy-tree copies nested conses", "(eq (car (cdr (copy-tree tree))) (car (cdr tree)))", "NIL"},
+		{"Elem", "(elem '(b c) '(a (b c)))", "T"},
+		{"Elem not found", "(elem 'z '(a b))", "NIL"},
+		{"Elem with :test", "(elem \"A\" '(\"a\") :test #'string-equal)", "T"},
+		{"Elem with :key", "(elem 2 '((1) (2)) :key #'car)", "T"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestMultipleValues(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq h (make-hash-table))")
+	evalAndIgnoreError(interp, "(setf (gethash 'a h) 1)")
+	evalAndIgnoreError(interp, "(setf (gethash 'n h) nil)")
+	evalAndIgnoreError(interp, "(defun two () (values 'x 'y))")
+	evalAndIgnoreError(interp, "(defun pick (flag) (if flag (values 1 2) (values 3 4 5)))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Primary value of values", "(values 1 2 3)", "1"},
+		{"No values gives nil", "(values)", "NIL"},
+		{"Multiple-value-list", "(multiple-value-list (values 1 2 3))", "(1 2 3)"},
+		{"Multiple-value-list of no values", "(multiple-value-list (values))", "NIL"},
+		{"Multiple-value-list of a single value", "(multiple-value-list 'a)", "(a)"},
+		{"Values pass through a function body", "(multiple-value-list (two))", "(x y)"},
+		{"Values pass through if", "(multiple-value-list (pick nil))", "(3 4 5)"},
+		{"Values pass through let", "(multiple-value-list (let ((a 1)) (values a 2)))", "(1 2)"},
+		{"Values pass through cond", "(multiple-value-list (cond (t (values 'c 'd))))", "(c d)"},
+		{"Values pass through funcall", "(multiple-value-list (funcall #'two))", "(x y)"},
+		{"Arguments take the primary value", "(+ (values 1 2) 10)", "11"},
+		{"Arguments of list take primary values", "(multiple-value-list (list (two)))", "((x))"},
+		{"Setq stores the primary value", "(setq p (two))", "x"},
+		{"Multiple-value-bind", "(multiple-value-bind (q r) (floor 17 5) (list q r))", "(3 2)"},
+		{"Multiple-value-bind pads with nil", "(multiple-value-bind (a b c) (values 1 2) (list a b c))", "(1 2 NIL)"},
+		{"Multiple-value-bind ignores extra values", "(multiple-value-bind (a) (values 1 2) a)", "1"},
+		{"Multiple-value-call", "(multiple-value-call #'list (values 1 2) 3)", "(1 2 3)"},
+		{"Multiple-value-call with several multiple values", "(multiple-value-call #'+ (floor 7 2) (floor 9 2))", "9"},
+		{"Multiple-value-call with no values first", "(multiple-value-call #'list (values) 1 2)", "(1 2)"},
+		{"Multiple-value-call with +", "(multiple-value-call #'+ (floor 7 2))", "4"},
+		{"Nth-value", "(nth-value 1 (values 'a 'b 'c))", "b"},
+		{"Nth-value past the end", "(nth-value 5 (values 'a))", "NIL"},
+		{"Values-list", "(multiple-value-list (values-list '(1 2 3)))", "(1 2 3)"},
+		{"Floor returns the remainder", "(multiple-value-list (floor 7 2))", "(3 1)"},
+		{"Floor of a negative number", "(multiple-value-list (floor -7 2))", "(-4 1)"},
+		{"Truncate returns the remainder", "(multiple-value-list (truncate -7 2))", "(-3 -1)"},
+		{"Floor of a ratio", "(multiple-value-list (floor 7/2))", "(3 1/2)"},
+		{"Round to even", "(multiple-value-list (round 5 2))", "(2 1)"},
+		{"Ceiling", "(multiple-value-list (ceiling 7 2))", "(4 -1)"},
+		{"Gethash of a present key", "(multiple-value-list (gethash 'a h))", "(1 T)"},
+		{"Gethash of a key stored as nil", "(multiple-value-list (gethash 'n h))", "(NIL T)"},
+		{"Gethash of a missing key", "(multiple-value-list (gethash 'z h))", "(NIL NIL)"},
+		{"Gethash with a default", "(multiple-value-list (gethash 'z h 0))", "(0 NIL)"},
+		{"Parse-integer returns the end index", "(multiple-value-list (parse-integer \" 42 \"))", "(42 4)"},
+		{"Parse-integer with junk stops at the junk", "(multiple-value-list (parse-integer \"12ab\" :junk-allowed t))", "(12 2)"},
+		{"Parse-integer with no digits", "(multiple-value-list (parse-integer \"xyz\" :junk-allowed t))", "(NIL 0)"},
+		{"Parse-integer with :start", "(multiple-value-list (parse-integer \"ab-12\" :start 2))", "(-12 5)"},
+		{"Mapcar uses primary values", "(mapcar #'floor '(7/2 9/4))", "(3 2)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestSpecialVariables(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(defvar *depth* 0)")
+	evalAndIgnoreError(interp, "(defparameter *base* 10)")
+	evalAndIgnoreError(interp, "(defconstant +limit+ 100)")
+	evalAndIgnoreError(interp, "(defun depth () *depth*)")
+	evalAndIgnoreError(interp, "(defun show-x () x)")
+	evalAndIgnoreError(interp, "(defun fail () (car 1 2))")
+	evalAndIgnoreError(interp, "(setq x 'global)")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Defvar returns the name", "(defvar *unset*)", "*unset*"},
+		{"Defvar sets the value", "*depth*", "0"},
+		{"Defvar does not reassign a bound variable", "(defvar *depth* 99)", "*depth*"},
+		{"The value is unchanged", "*depth*", "0"},
+		{"Defparameter always assigns", "(defparameter *base* 16)", "*base*"},
+		{"The new value", "*base*", "16"},
+		{"Defconstant", "+limit+", "100"},
+		{"Let binds a special variable dynamically", "(let ((*depth* 1)) (depth))", "1"},
+		{"The global value is restored", "*depth*", "0"},
+		{"A defvar that is never run proclaims nothing", "(progn (if nil (defvar *never* 1)) (defun peek-never () *never*) (let ((*never* 5)) (peek-never)))", "*never*"},
+		{"A defvar proclaims the forms after it in a toplevel progn", "(progn (defvar *later* 1) (defun peek-later () *later*) (let ((*later* 2)) (peek-later)))", "2"},
+		{"Nested dynamic bindings", "(let ((*depth* 1)) (list (depth) (let ((*depth* 2)) (depth)) (depth)))", "(1 2 1)"},
+		{"Let* binds special variables dynamically", "(let* ((*depth* 5) (y (depth))) y)", "5"},
+		{"Setq inside the let changes the dynamic binding", "(let ((*depth* 1)) (setq *depth* 7) (depth))", "7"},
+		{"Setq inside the let does not leak", "*depth*", "0"},
+		{"A lexical binding is not seen by called functions", "(let ((x 'lexical)) (show-x))", "global"},
+		{"Declare special makes a binding dynamic", "(let ((x 'dynamic)) (declare (special x)) (show-x))", "dynamic"},
+		{"A declared binding is restored", "x", "global"},
+		{"Let with a bare variable binds nil", "(let (a (b)) (list a b))", "(NIL NIL)"},
+		{"Setup a closure over a special", "(setq reader (lambda () *depth*))", "#<FUNCTION (LAMBDA ())>"},
+		{"A closure sees the current dynamic value", "(let ((*depth* 3)) (funcall reader))", "3"},
+		{"Setf of a special variable", "(setf *base* 8)", "8"},
+		{"A special parameter is bound dynamically", "(defun with-depth (*depth*) (depth)) (with-depth 7)", "7"},
+		{"A special parameter is restored", "*depth*", "0"},
+		{"A lambda binds a special parameter dynamically", "(funcall (lambda (*depth*) (depth)) 4)", "4"},
+		{"Declare special makes a parameter dynamic", "(defun show-param (x) (declare (special x)) (show-x)) (show-param 'param)", "param"},
+		{"A declared parameter is restored", "x", "global"},
+		{"Declare special in a lambda body refers to the global", "(let ((x 'lexical)) (funcall (lambda () (declare (special x)) x)))", "global"},
+		{"A compiled function binds a special parameter", "(defun with-depth-2 (*depth*) (depth)) (compile 'with-depth-2) (list (with-depth-2 9) *depth*)", "(9 0)"},
+		{"A compiled function honours declare special", "(defun show-param-2 (x) (declare (special x)) (show-x)) (compile 'show-param-2) (list (show-param-2 'compiled) x)", "(compiled global)"},
+		{"A special parameter of a tail call is rebound", "(defun count-depth (*depth*) (if (< *depth* 3) (count-depth (+ *depth* 1)) (depth))) (compile 'count-depth) (list (count-depth 0) *depth*)", "(3 0)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Assigning a constant", "(setq +limit+ 1)"},
+		{"Binding a constant", "(let ((+limit+ 1)) +limit+)"},
+		{"Redefining a constant with a different value", "(defconstant +limit+ 5)"},
+		{"Binding a constant as a parameter", "(funcall (lambda (+limit+) +limit+) 1)"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+
+	t.Run("A dynamic binding is restored when the body fails", func(t *testing.T) {
+		evalAndIgnoreError(interp, "(let ((*depth* 42)) (fail))")
+		if result := evalToString(t, interp, "*depth*"); result != "0" {
+			t.Errorf("Expected 0, got %s", result)
+		}
+	})
+
+	t.Run("A special parameter is restored when the body fails", func(t *testing.T) {
+		evalAndIgnoreError(interp, "(defun fail-deep (*depth*) (fail))")
+		evalAndIgnoreError(interp, "(fail-deep 42)")
+		if result := evalToString(t, interp, "*depth*"); result != "0" {
+			t.Errorf("Expected 0, got %s", result)
+		}
+		evalAndIgnoreError(interp, "(compile 'fail-deep)")
+		evalAndIgnoreError(interp, "(fail-deep 43)")
+		if result := evalToString(t, interp, "*depth*"); result != "0" {
+			t.Errorf("Expected 0 after the compiled function failed, got %s", result)
+		}
+	})
+}
+
+func TestContinuations(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(defun find-first (pred l) (call/cc (lambda (return) (mapc (lambda (x) (if (funcall pred x) (funcall return x))) l) nil)))")
+	evalAndIgnoreError(interp, "(defun count-down (n) (if (= n 0) 'done (count-down (1- n))))")
+	evalAndIgnoreError(interp, "(defun my-len (l) (if (null l) 0 (1+ (my-len (cdr l)))))")
+	evalAndIgnoreError(interp, "(defvar *level* 0)")
+	evalAndIgnoreError(interp, "(setq trail nil)")
+	evalAndIgnoreError(interp, "(defun note (x) (push x trail))")
+	evalAndIgnoreError(interp, "(setq cleaned nil)")
+	elems := make([]interface{}, 100000)
+	for i := range elems {
+		elems[i] = i
+	}
+	interp.Define("big", makeList(elems...))
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"A continuation that is not called", "(call/cc (lambda (k) 5))", "5"},
+		{"Escaping with a continuation", "(+ 1 (call/cc (lambda (k) (+ 10 (funcall k 2)))))", "3"},
+		{"The long name", "(call-with-current-continuation (lambda (k) (funcall k 'out) 'in))", "out"},
+		{"Escaping from inside mapc", "(find-first 'evenp '(1 3 4 5))", "4"},
+		{"No escape", "(find-first 'evenp '(1 3 5))", "NIL"},
+		{"A continuation prints unreadably", "(call/cc (lambda (k) k))", "#<CONTINUATION>"},
+		{"Passing multiple values", "(multiple-value-list (call/cc (lambda (k) (funcall k 1 2))))", "(1 2)"},
+		{"Reentering a continuation in a loop", "(let ((n 0)) (setq n (+ (call/cc (lambda (c) (setq k c) 1)) n)) (if (< n 5) (funcall k 1) n))", "5"},
+		{"Setup a saved continuation", "(setq r (+ 1 (call/cc (lambda (k) (setq saved k) 1))))", "2"},
+		{"Reentering it from a later form", "(funcall saved 10)", "11"},
+		{"The rest of the earlier form ran again", "r", "11"},
+		{"Call/ec escapes", "(call/ec (lambda (k) (funcall k 'early) 'late))", "early"},
+		{"Call/ec returns normally", "(call-with-escape-continuation (lambda (k) 'late))", "late"},
+		{"Call/ec escapes from nested calls", "(call/ec (lambda (k) (mapcar (lambda (x) (if (= x 2) (funcall k x) x)) '(1 2 3))))", "2"},
+		{"Dynamic-wind runs its thunks in order", "(progn (dynamic-wind (lambda () (note 'before)) (lambda () (note 'during)) (lambda () (note 'after))) (reverse trail))", "(before during after)"},
+		{"Dynamic-wind returns the thunk's value", "(dynamic-wind (lambda () nil) (lambda () 'value) (lambda () nil))", "value"},
+		{"Setup escaping from dynamic-wind", "(progn (setq trail nil) (call/cc (lambda (k) (dynamic-wind (lambda () (note 'in)) (lambda () (funcall k 'escaped)) (lambda () (note 'out))))))", "escaped"},
+		{"The after thunk ran on escape", "(reverse trail)", "(in out)"},
+		{"Setup reentering dynamic-wind", "(progn (setq trail nil) (dynamic-wind (lambda () (note 'in)) (lambda () (call/cc (lambda (k) (setq again k))) (note 'body)) (lambda () (note 'out))) 'first)", "first"},
+		{"Reenter the extent", "(funcall again nil)", "first"},
+		{"The before thunk ran again on reentry", "(reverse trail)", "(in body out in body out)"},
+		{"Unwind-protect returns the values of the protected form", "(multiple-value-list (unwind-protect (values 1 2) (setq cleaned 'normal)))", "(1 2)"},
+		{"Cleanup after a normal exit", "cleaned", "normal"},
+		{"Unwind-protect on escape", "(call/ec (lambda (k) (unwind-protect (funcall k 'out) (setq cleaned 'escaped))))", "out"},
+		{"Cleanup after an escape", "cleaned", "escaped"},
+		{"Nested cleanups run innermost first", "(progn (setq trail nil) (call/cc (lambda (k) (unwind-protect (unwind-protect (funcall k 1) (note 'inner)) (note 'outer)))) (reverse trail))", "(inner outer)"},
+		{"Escaping from a dynamic binding", "(call/ec (lambda (k) (let ((*level* 5)) (funcall k *level*))))", "5"},
+		{"The binding is restored", "*level*", "0"},
+		{"Progn returns the last value", "(progn 1 2 3)", "3"},
+		{"Tail calls do not grow the stack", "(count-down 100000)", "done"},
+		{"Deep recursion", "(my-len big)", "100000"},
+		{"Capture inside mapcar", "(setq mapped (mapcar (lambda (x) (call/cc (lambda (k) (if (= x 2) (setq inner k)) x))) '(1 2 3)))", "(1 2 3)"},
+		{"Reenter mapcar", "(if (= (car (cdr mapped)) 2) (funcall inner 20) mapped)", "(1 20 3)"},
+		{"Capture inside reduce", "(setq reduced (reduce (lambda (a b) (call/cc (lambda (k) (if (= b 2) (setq inner k)) (+ a b)))) '(1 2 3)))", "6"},
+		{"Reenter reduce", "(if (= reduced 6) (funcall inner 10) reduced)", "13"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	evalAndIgnoreError(interp, "(setq ec (call/ec (lambda (k) k)))")
+	evalAndIgnoreError(interp, "(sort (list 2 1) (lambda (a b) (call/cc (lambda (k) (setq sorting k) (< a b)))))")
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Call/ec after its extent ended", "(funcall ec 1)"},
+		{"A continuation captured inside sort after it returned", "(funcall sorting t)"},
+		{"Call/cc expects a function", "(call/cc)"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+
+	t.Run("Unwind-protect cleans up after an error", func(t *testing.T) {
+		evalAndIgnoreError(interp, "(unwind-protect (car 1 2) (setq cleaned 'failed))")
+		if result := evalToString(t, interp, "cleaned"); result != "failed" {
+			t.Errorf("Expected failed, got %s", result)
+		}
+	})
+}
+
+func TestGenerators(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(defun count-up (i n) (if (> i n) 'finished (progn (yield i) (count-up (1+ i) n))))")
+	evalAndIgnoreError(interp, "(defun count-to (n) (count-up 1 n))")
+	evalAndIgnoreError(interp, "(defun naturals (i) (yield i) (naturals (1+ i)))")
+	evalAndIgnoreError(interp, "(defun echo-loop (x) (echo-loop (yield (list 'got x))))")
+	evalAndIgnoreError(interp, "(defun echo () (echo-loop (yield 'ready)))")
+	evalAndIgnoreError(interp, "(defvar *mode* 'outer)")
+	evalAndIgnoreError(interp, "(defun mode-gen () (let ((*mode* 'inner)) (yield *mode*) (setq *mode* 'changed) (yield *mode*)))")
+	evalAndIgnoreError(interp, "(defun failing-gen () (yield 1) (car 1 2))")
+	evalAndIgnoreError(interp, "(setq g (make-generator 'count-to 3))")
+	evalAndIgnoreError(interp, "(setq nat (make-generator 'naturals 0))")
+	evalAndIgnoreError(interp, "(setq e (make-generator 'echo))")
+	evalAndIgnoreError(interp, "(setq mg (make-generator 'mode-gen))")
+	evalAndIgnoreError(interp, "(setq once (make-generator (lambda () (yield 'only))))")
+	evalAndIgnoreError(interp, "(setq bad (make-generator 'failing-gen))")
+	evalAndIgnoreError(interp, "(setq total 0)")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"A generator prints unreadably", "g", "#<GENERATOR>"},
+		{"The first value", "(next g)", "1"},
+		{"Next also returns T", "(multiple-value-list (next g))", "(2 T)"},
+		{"The last value", "(next g)", "3"},
+		{"Done after the last value", "(generator-done-p g)", "T"},
+		{"Next on a finished generator", "(multiple-value-list (next g))", "(NIL NIL)"},
+		{"An infinite generator", "(list (next nat) (next nat) (next nat))", "(0 1 2)"},
+		{"It keeps its place", "(next nat)", "3"},
+		{"Not done before the only value", "(generator-done-p once)", "NIL"},
+		{"The value found by generator-done-p is kept", "(next once)", "only"},
+		{"Done after it", "(generator-done-p once)", "T"},
+		{"A lambda generator", "(multiple-value-list (next (make-generator (lambda (a b) (yield (+ a b))) 1 2)))", "(3 T)"},
+		{"Starting a coroutine", "(next e)", "ready"},
+		{"Sending a value to yield", "(next e 5)", "(got 5)"},
+		{"Sending another", "(next e 'x)", "(got x)"},
+		{"Do-generator", "(do-generator (x (make-generator 'count-to 4) total) (setq total (+ total x)))", "10"},
+		{"Do-generator binds a local total", "(let ((sum 0)) (do-generator (x (make-generator 'count-to 5) sum) (setq sum (+ sum x))))", "15"},
+		{"Do-generator without a result", "(do-generator (x (make-generator 'count-to 2)) x)", "NIL"},
+		{"Many values without growing the stack", "(let ((sum 0)) (do-generator (x (make-generator 'count-to 100000) sum) (setq sum (+ sum x))))", "5000050000"},
+		{"A dynamic binding inside the generator", "(next mg)", "inner"},
+		{"Is undone while it is suspended", "*mode*", "outer"},
+		{"And redone when it resumes", "(next mg)", "changed"},
+		{"The caller's value is untouched", "*mode*", "outer"},
+		{"The first value of a failing generator", "(next bad)", "1"},
+		{"Yield from inside mapc", "(let ((each (make-generator (lambda () (mapc (lambda (x) (yield x)) '(1 2)))))) (list (next each) (next each)))", "(1 2)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Yield outside a generator", "(yield 1)"},
+		{"Yield from inside sort's predicate", "(next (make-generator (lambda () (sort (list 2 1) (lambda (a b) (yield a) (< a b))))))"},
+		{"The failing generator signals its error", "(next bad)"},
+		{"Next expects a generator", "(next 5)"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+
+	t.Run("A generator that failed is done", func(t *testing.T) {
+		if result := evalToString(t, interp, "(generator-done-p bad)"); result != "T" {
+			t.Errorf("Expected T, got %s", result)
+		}
+	})
+}
+
+func TestConditions(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(defvar trail nil)")
+	evalAndIgnoreError(interp, "(defun note (x) (setq trail (cons x trail)))")
+	evalAndIgnoreError(interp, "(defvar *level* 0)")
+	evalAndIgnoreError(interp, "(defun safe-div (a b) (handler-case (/ a b) (error () 'infinity)))")
+	evalAndIgnoreError(interp, "(compile 'safe-div)")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Ignore-errors without an error", "(ignore-errors 1 2)", "2"},
+		{"Ignore-errors returns NIL and the condition", "(multiple-value-list (ignore-errors (car 1 2)))", "(NIL #<ERROR \"car expects 1 argument\">)"},
+		{"Handler-case binds the condition", "(handler-case (error \"Bad value:\" 5) (error (e) (error-message e)))", "\"Bad value: 5\""},
+		{"Handler-case without an error", "(multiple-value-list (handler-case (values 1 2) (error () 'failed)))", "(1 2)"},
+		{"A clause without a variable", "(handler-case (car 1 2) (condition () 'caught))", "caught"},
+		{"A clause of type T", "(handler-case (car 1 2) (t () 'caught))", "caught"},
+		{"Cleanups run before the handler", "(progn (setq trail nil) (handler-case (unwind-protect (error \"x\") (note 'cleanup)) (error () (note 'handled))) (reverse trail))", "(cleanup handled)"},
+		{"Dynamic bindings are undone before the handler", "(handler-case (let ((*level* 1)) (error \"x\")) (error () *level*))", "0"},
+		{"An error inside a builtin's callback", "(handler-case (sort (list 2 1) (lambda (a b) (error \"no\"))) (error (e) (error-message e)))", "\"no\""},
+		{"A condition signaled again", "(handler-case (handler-case (error \"inner\") (error (e) (error e))) (error (e) (error-message e)))", "\"inner\""},
+		{"Handler-case in a compiled function", "(safe-div 1 0)", "infinity"},
+		{"A compiled function's result", "(safe-div 6 3)", "2"},
+		{"Yield inside handler-case", "(let ((g (make-generator (lambda () (handler-case (progn (yield 1) (error \"late\")) (error () (yield 2))))))) (list (next g) (next g)))", "(1 2)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Error signals an error", "(error \"oops\")"},
+		{"An error in a handler", "(handler-case (car 1 2) (error () (error \"again\")))"},
+		{"An unknown condition type", "(handler-case 1 (warning () 2))"},
+		{"Error-message expects a condition", "(error-message \"oops\")"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+
+	t.Run("The message of a Lisp error", func(t *testing.T) {
+		if _, err := interp.EvalString("(error \"Bad value:\" 5)"); err == nil || err.Error() != "Bad value: 5" {
+			t.Errorf("Expected the error Bad value: 5, got %v", err)
+		}
+	})
+}
+
+func TestPromisesAndStreams(t *testing.T) {
+	interp := New()
+
+	evalAndIgnoreError(interp, "(setq count 0)")
+	evalAndIgnoreError(interp, "(setq p (delay (progn (setq count (1+ count)) 42)))")
+	evalAndIgnoreError(interp, "(setq calls 0)")
+	evalAndIgnoreError(interp, "(setq squares (stream-map (lambda (x) (setq calls (1+ calls)) (* x x)) (integers-from 1)))")
+	evalAndIgnoreError(interp, "(defun sieve (s) (stream-cons (stream-car s) (sieve (stream-filter (lambda (x) (not (zerop (mod x (stream-car s))))) (stream-cdr s)))))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"A promise starts unforced", "p", "#<PROMISE unforced>"},
+		{"Delay does not evaluate", "count", "0"},
+		{"Force evaluates", "(force p)", "42"},
+		{"The promise is now forced", "p", "#<PROMISE forced>"},
+		{"Forcing again returns the same value", "(force p)", "42"},
+		{"The expression ran once", "count", "1"},
+		{"Forcing a non-promise", "(force 5)", "5"},
+		{"Make-promise is forced", "(make-promise 7)", "#<PROMISE forced>"},
+		{"Forcing make-promise", "(force (make-promise 7))", "7"},
+		{"Make-promise of a promise", "(eq (make-promise p) p)", "T"},
+		{"Promisep", "(list (promisep p) (promisep 1))", "(T NIL)"},
+		{"A delay closes over its environment", "(force (let ((x 3)) (delay (* x x))))", "9"},
+		{"Stream-cons delays the rest", "(stream-car (stream-cons 1 (car 1 2)))", "1"},
+		{"A stream prints with its promise", "(stream-cons 1 2)", "(1 . #<PROMISE unforced>)"},
+		{"Stream-cdr forces the rest", "(stream-cdr (stream-cons 1 2))", "2"},
+		{"Integers-from", "(stream-take (integers-from 1) 5)", "(1 2 3 4 5)"},
+		{"Stream-cdr of an infinite stream", "(stream-car (stream-cdr (stream-cdr (integers-from 10))))", "12"},
+		{"Taking more than a finite stream has", "(stream-take (stream-cons 1 nil) 3)", "(1)"},
+		{"Taking nothing", "(stream-take (integers-from 1) 0)", "NIL"},
+		{"Stream-map", "(stream-take squares 4)", "(1 4 9 16)"},
+		{"Stream-filter", "(stream-take (stream-filter 'evenp (integers-from 1)) 3)", "(2 4 6)"},
+		{"Streams are memoized", "(progn (stream-take squares 4) calls)", "4"},
+		{"A sieve of primes", "(stream-take (sieve (integers-from 2)) 6)", "(2 3 5 7 11 13)"},
+		{"Integers-from works with bignums", "(stream-take (integers-from 9223372036854775807) 2)", "(9223372036854775807 9223372036854775808)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Stream-car of the empty stream", "(stream-car nil)"},
+		{"Stream-cdr of a non-stream", "(stream-cdr 5)"},
+		{"Integers-from expects an integer", "(integers-from 'a)"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+}
+
+func TestAnalysis(t *testing.T) {
+	interp := New()
+	evalAndIgnoreError(interp, "(defun square (x) (* x x))")
+	evalAndIgnoreError(interp, "(defun adder (n) (lambda (x) (+ x n)))")
+	evalAndIgnoreError(interp, "(defun later (x) (if x (undefined-function x) 'skipped))")
+	evalAndIgnoreError(interp, "(setq add1 (adder 1))")
+	evalAndIgnoreError(interp, "(setq add2 (adder 2))")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"A defun is a named function", "(symbol-value 'square)", "#<FUNCTION square>"},
+		{"Calling a defun", "(square 7)", "49"},
+		{"Closures from one lambda keep their own alists", "(list (funcall add1 10) (funcall add2 10))", "(11 12)"},
+		{"A branch that is not taken is not run", "(later nil)", "skipped"},
+		{"Redefining a function replaces its body", "(progn (defun square (x) (+ x x)) (square 7))", "14"},
+		{"Quote returns its argument unevaluated", "(quote (square 7))", "(square 7)"},
+		{"Function of a symbol", "(funcall (function square) 4)", "8"},
+		{"Not", "(list (not nil) (not 1))", "(T NIL)"},
+		{"A lambda in function position", "((lambda (x y) (cons y x)) 1 2)", "(2 . 1)"},
+		{"Eval analyzes the form it is given", "(eval (list 'square 3))", "6"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	t.Run("Closures from one lambda share its analyzed body", func(t *testing.T) {
+		v1, _ := interp.Lookup("add1")
+		v2, _ := interp.Lookup("add2")
+		add1, add2 := v1.(*closure), v2.(*closure)
+		if add1.code != add2.code || len(add1.code.analyzed()) != 1 {
+			t.Errorf("Expected add1 and add2 to share one analyzed body")
+		}
+	})
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"A malformed if", "(if)"},
+		{"A malformed quote", "(quote 1 2)"},
+		{"A branch that is taken is run", "(later 1)"},
+		{"A non-symbol in function position", "(1 2)"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+}
+
+func TestLexicalEnvironments(t *testing.T) {
+	// Each program runs in a fresh interpreter.
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Setq of a parameter does not change the global", "(setq x 10) (defun f (x) (setq x 5) x) (list (f 1) x)", "(5 10)"},
+		{"Setq of a let variable does not change the global", "(setq y 1) (let ((y 2)) (setq y 3)) y", "1"},
+		{"Setq assigns the innermost binding", "(let ((v 1)) (let ((v 2)) (setq v 3)) v)", "1"},
+		{"Setq of an unbound variable sets the global", "(let ((v 1)) (setq w 2)) w", "2"},
+		{"A closure assigns a captured variable", "(let ((n 0)) (funcall (lambda () (setq n 1))) n)", "1"},
+		{"A counter closure keeps its count", "(defun make-counter () (let ((c 0)) (lambda () (setq c (+ c 1))))) (setq ctr (make-counter)) (funcall ctr) (list (funcall ctr) (funcall ctr))", "(2 3)"},
+		{"Closures over one binding share it", "(let ((n 0)) (let ((inc (lambda () (setq n (+ n 1)))) (get (lambda () n))) (funcall inc) (funcall inc) (funcall get)))", "2"},
+		{"Counters are independent", "(defun make-counter () (let ((c 0)) (lambda () (setq c (+ c 1))))) (let ((a (make-counter)) (b (make-counter))) (funcall a) (funcall a) (list (funcall a) (funcall b)))", "(3 1)"},
+		{"Do-generator accumulates into an outer variable", "(defun gen3 () (yield 1) (yield 2) (yield 3)) (let ((acc nil)) (do-generator (x (make-generator #'gen3)) (setq acc (cons x acc))) acc)", "(3 2 1)"},
+		{"Let* closures see the bindings before them", "(let* ((x 1) (f (lambda () x)) (x 2)) (list (funcall f) x))", "(1 2)"},
+		{"Setf of a captured variable", "(let ((n 0)) (funcall (lambda () (setf n 5) (incf n))) n)", "6"},
+		{"Compiled code assigns a parameter locally", "(setq z 10) (defun h (z) (setq z 5) z) (compile 'h) (list (h 1) z)", "(5 10)"},
+		{"A closure in compiled code shares its slots", "(defun g (x) (let ((k (lambda () (setq x (+ x 1))))) (funcall k) (funcall k) x)) (compile 'g) (g 1)", "3"},
+		{"A compiled closure assigns a captured variable", "(setq counter (let ((c 0)) (compile nil (lambda () (setq c (+ c 1)))))) (funcall counter) (funcall counter)", "2"},
+		{"A defun inside a let closes over its variables", "(let ((n 10)) (defun add-n (x) (+ x n))) (add-n 5)", "15"},
+		{"A compiled defun reads the environment it was defined in", "(let ((n 3)) (defun times-n (x) (* x n))) (compile 'times-n) (times-n 4)", "12"},
+		{"Modify macros update captured variables", "(let ((n 0) (l nil)) (funcall (lambda () (incf n 2) (push n l) (push 7 l))) (list n l))", "(2 (7 2))"},
+		{"Shiftf shifts lexical variables", "(let ((a 1) (b 2)) (list (shiftf a b 3) a b))", "(1 2 3)"},
+		{"A delay sees later assignments", "(let ((x 1)) (let ((p (delay x))) (setq x 2) (force p)))", "2"},
+		{"Eval uses the global environment", "(setq v 1) (let ((v 2)) (eval 'v))", "1"},
+		{"A setf expansion sees lexical variables", "(define-setf-expander my-car (x) (values (list 'c) (list x) (list 's) (list 'setf (list 'car 'c) 's) (list 'car 'c))) (let ((l (list 1 2))) (setf (my-car l) 9) l)", "(9 2)"},
+		{"Unwind-protect cleanup sees lexical variables", "(let ((n 0)) (unwind-protect (setq n 1) (setq n (+ n 10))) n)", "11"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, New(), tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	interp := New()
+	evalAndIgnoreError(interp, "(setq first-of #'car)")
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Function of a builtin returns the builtin", "(function car)", "#<BUILTIN-FUNCTION car>"},
+		{"A builtin is a value", "(funcall first-of '(a b))", "a"},
+		{"Builtins can be passed to builtins", "(mapcar #'1+ '(1 2 3))", "(2 3 4)"},
+		{"Not as a function", "(mapcar #'not '(t nil))", "(NIL T)"},
+		{"Not as a remove-if predicate", "(remove-if #'not '(1 nil 2 nil))", "(1 2)"},
+		{"Funcall as a function", "(funcall #'funcall #'+ 1 2)", "3"},
+		{"Apply as a function", "(mapcar #'apply (list #'+ #'list) '((1 2) (3 4)))", "(3 (3 4))"},
+		{"Eval as a function", "(mapcar #'eval '((+ 1 2) 'x))", "(3 x)"},
+		{"Eval as a function evaluates globally", "(let ((y 1)) (funcall #'eval 'first-of))", "#<BUILTIN-FUNCTION car>"},
+		{"Aliases are separate builtins", "(function first)", "#<BUILTIN-FUNCTION first>"},
+		{"A builtin as a hash table test", "(hash-table-test (make-hash-table :test #'equal))", "EQUAL"},
+		{"Documentation", "(documentation 'cons)", `"Construct a new list by prepending an element."`},
+		{"Documentation of a builtin object", "(documentation #'car 'function)", `"Return the first element of a list."`},
+		{"No documentation", "(documentation 'no-such-function)", "NIL"},
+		{"Fixed arity", "(multiple-value-list (function-arity 'cons))", "(2 2)"},
+		{"Optional arguments", "(multiple-value-list (function-arity #'subseq))", "(2 3)"},
+		{"Any number of arguments", "(multiple-value-list (function-arity '+))", "(0 NIL)"},
+		{"A pure builtin", "(function-pure-p 'cons)", "T"},
+		{"An impure builtin", "(function-pure-p 'rplaca)", "NIL"},
+		{"A builtin that calls back into Lisp is impure", "(function-pure-p 'mapcar)", "NIL"},
+		{"A defun takes precedence over a builtin", "(progn (defun list (x) (cons 'mine x)) (list 1))", "(mine . 1)"},
+		{"Function of a redefined builtin", "(funcall #'list 2)", "(mine . 2)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	arityErrors := []struct {
+		input    string
+		expected string
+	}{
+		{"(car)", "car expects 1 argument"},
+		{"(cons 1)", "cons expects 2 arguments"},
+		{"(subseq \"abc\")", "subseq expects 2 to 3 arguments"},
+		{"(mapcar #'1+)", "mapcar expects at least 2 arguments"},
+		{"(terpri 1)", "terpri expects 0 arguments"},
+		{"(funcall #'first 1 2)", "first expects 1 argument"},
+	}
+	for _, tc := range arityErrors {
+		t.Run("Arity error from "+tc.input, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil || err.Error() != tc.expected {
+				t.Errorf("Expected the error %q, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Function-arity of a user function", "(progn (defun f (x) x) (function-arity 'f))"},
+		{"Function-pure-p of a non-function", "(function-pure-p 5)"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+}
+
+func TestInterpreter(t *testing.T) {
+	a, b := New(), New()
+	if err := a.Load(strings.NewReader("(defvar *who* 'a)\n(defun greet () (list 'hello *who*))\n(defstruct point x y)")); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	b.Define("*who*", "b")
+
+	t.Run("Interpreters are independent", func(t *testing.T) {
+		if result := evalToString(t, a, "(greet)"); result != "(hello a)" {
+			t.Errorf("Expected (hello a), got %s", result)
+		}
+		if _, err := b.EvalString("(greet)"); err == nil {
+			t.Errorf("Expected greet to be undefined in b")
+		}
+		if result := evalToString(t, b, "*who*"); result != "b" {
+			t.Errorf("Expected b, got %s", result)
+		}
+		if _, err := b.EvalString("(make-point :x 1)"); err == nil {
+			t.Errorf("Expected the point structure to be undefined in b")
+		}
+	})
+
+	t.Run("EvalString evaluates every form", func(t *testing.T) {
+		if result := evalToString(t, b, "(setq n 1) (setq n (+ n 1)) (* n 10)"); result != "20" {
+			t.Errorf("Expected 20, got %s", result)
+		}
+		if result := evalToString(t, b, ""); result != "NIL" {
+			t.Errorf("Expected NIL, got %s", result)
+		}
+	})
+
+	t.Run("Define and Lookup", func(t *testing.T) {
+		b.Define("big", makeList(1, 2, 3))
+		if result := evalToString(t, b, "(length big)"); result != "3" {
+			t.Errorf("Expected 3, got %s", result)
+		}
+		v, ok := a.Lookup("greet")
+		if !ok {
+			t.Fatalf("Expected greet to be defined in a")
+		}
+		// A function keeps the global environment it was defined in.
+		b.Define("greet", v)
+		if result := evalToString(t, b, "(greet)"); result != "(hello a)" {
+			t.Errorf("Expected (hello a), got %s", result)
+		}
+		if _, ok := b.Lookup("undefined"); ok {
+			t.Errorf("Expected undefined to be unbound")
+		}
+	})
+
+	t.Run("Eval and EvalValues", func(t *testing.T) {
+		form, err := Read("(floor 7 2)")
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if v, err := a.Eval(form); err != nil || Format(v) != "3" {
+			t.Errorf("Expected 3, got %v, %v", v, err)
+		}
+		vals, err := a.EvalValues(form)
+		if err != nil || len(vals) != 2 || Format(vals[1]) != "1" {
+			t.Errorf("Expected the values 3 and 1, got %v, %v", vals, err)
+		}
+	})
+
+	t.Run("Errors are returned", func(t *testing.T) {
+		_, err := a.EvalString("(car 1 2)")
+		var lispErr *Error
+		if !errors.As(err, &lispErr) || err.Error() != "car expects 1 argument" {
+			t.Errorf("Expected a Lisp error, got %v", err)
+		}
+		if _, err := Read("(car"); err == nil {
+			t.Errorf("Expected a read error")
+		}
+		if err := a.Load(strings.NewReader("(setq x 1) (undefined-function)")); err == nil {
+			t.Errorf("Expected an error from Load")
+		}
+	})
+
+	t.Run("Interpreters can run on different goroutines", func(t *testing.T) {
+		var wg sync.WaitGroup
+		results := make([]string, 2)
+		for i, in := range []*Interpreter{a, b} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					v, err := in.EvalString("(list *who* (length (list 1 2 3)))")
+					if err != nil {
+						results[i] = err.Error()
+						return
+					}
+					results[i] = Format(v)
+				}
+			}()
+		}
+		wg.Wait()
+		if results[0] != "(a 3)" || results[1] != "(b 3)" {
+			t.Errorf("Expected (a 3) and (b 3), got %v", results)
+		}
+	})
+
+	t.Run("Interpreters run concurrently", func(t *testing.T) {
+		// Special bindings, dynamic-wind and the nested runs of mapcar all
+		// change the state of the running interpreter.
+		src := `(defvar *level* 0)
+			(defun nest (n)
+			  (let ((*level* n))
+			    (if (= n 0)
+			        *level*
+			        (dynamic-wind (lambda () nil)
+			                      (lambda () (+ *level* (nest (- n 1))))
+			                      (lambda () nil)))))`
+		var wg sync.WaitGroup
+		results := make([]string, 4)
+		for i := range results {
+			in := New()
+			if _, err := in.EvalString(src); err != nil {
+				t.Fatalf("EvalString failed: %v", err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					v, err := in.EvalString("(list (mapcar #'nest '(1 2 3 4)) *level*)")
+					if err != nil {
+						results[i] = err.Error()
+						return
+					}
+					results[i] = Format(v)
+				}
+			}()
+		}
+		wg.Wait()
+		for _, r := range results {
+			if r != "((1 3 6 10) 0)" {
+				t.Errorf("Expected ((1 3 6 10) 0), got %s", r)
+			}
+		}
+	})
+
+	t.Run("A Go function can call into another interpreter", func(t *testing.T) {
+		ask := func(other *Interpreter) func(string) (string, error) {
+			return func(src string) (string, error) {
+				v, err := other.EvalString(src)
+				return Format(v), err
+			}
+		}
+		if err := a.RegisterFunc("ask-b", ask(b)); err != nil {
+			t.Fatalf("RegisterFunc failed: %v", err)
+		}
+		if err := b.RegisterFunc("ask-a", ask(a)); err != nil {
+			t.Fatalf("RegisterFunc failed: %v", err)
+		}
+		if result := evalToString(t, a, `(list *who* (ask-b "(list *who* (ask-a \"*who*\"))"))`); result != `(a "(b \"a\")")` {
+			t.Errorf(`Expected (a "(b \"a\")"), got %s`, result)
+		}
+		if _, err := a.EvalString(`(ask-b "(car 1 2)")`); err == nil || !strings.Contains(err.Error(), "car expects 1 argument") {
+			t.Errorf("Expected the error from b, got %v", err)
+		}
+	})
+}
+
+func TestRegisterFunc(t *testing.T) {
+	type user struct {
+		Name   string
+		UserID int
+		Tags   []string `lisp:"labels"`
+		Secret string   `lisp:"-"`
+	}
+	errNegative := errors.New("negative")
+	interp := New()
+	funcs := map[string]interface{}{
+		"go-add":   func(a, b int) int { return a + b },
+		"go-scale": func(x float64, by float32) float64 { return x * float64(by) },
+		"go-upper": strings.ToUpper,
+		"go-sum": func(xs ...int) int {
+			total := 0
+			for _, x := range xs {
+				total += x
+			}
+			return total
+		},
+		"go-join": func(sep string, parts []string) string { return strings.Join(parts, sep) },
+		"go-counts": func(words []string) map[string]int {
+			counts := make(map[string]int)
+			for _, w := range words {
+				counts[w]++
+			}
+			return counts
+		},
+		"go-total": func(counts map[string]int) int {
+			total := 0
+			for _, n := range counts {
+				total += n
+			}
+			return total
+		},
+		"go-user": func(name string, id int) user {
+			return user{Name: name, UserID: id, Tags: []string{"new"}, Secret: "x"}
+		},
+		"go-user-id":  func(u *user) int { return u.UserID },
+		"go-divmod":   func(a, b int) (int, int) { return a / b, a % b },
+		"go-nothing":  func() {},
+		"go-nil-list": func() []int { return nil },
+		"go-not":      func(b bool) bool { return !b },
+		"go-sqrt": func(x float64) (float64, error) {
+			if x < 0 {
+				return 0, errNegative
+			}
+			return math.Sqrt(x), nil
+		},
+		"go-eval": func(src string) (string, error) {
+			v, err := interp.EvalString(src)
+			return Format(v), err
+		},
+	}
+	for name, fn := range funcs {
+		if err := interp.RegisterFunc(name, fn); err != nil {
+			t.Fatalf("RegisterFunc %s failed: %v", name, err)
+		}
+	}
+	evalAndIgnoreError(interp, "(defstruct person name user-id)")
+
+	testCases := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"Integer arguments", "(go-add 2 3)", "5"},
+		{"Float arguments", "(go-scale 1.5 2)", "3.0"},
+		{"String arguments", "(go-upper \"abc\")", "\"ABC\""},
+		{"A symbol as a string", "(go-upper 'abc)", "\"ABC\""},
+		{"Variadic with no extra arguments", "(go-sum)", "0"},
+		{"Variadic arguments", "(go-sum 1 2 3 4)", "10"},
+		{"Applied like a builtin", "(apply #'go-sum '(1 2 3))", "6"},
+		{"Mapped like a builtin", "(mapcar #'go-upper '(\"a\" \"b\"))", "(\"A\" \"B\")"},
+		{"A list as a slice", "(go-join \", \" '(\"a\" \"b\" \"c\"))", "\"a, b, c\""},
+		{"A vector as a slice", "(go-join \"-\" (vector \"x\" \"y\"))", "\"x-y\""},
+		{"NIL as a slice", "(go-join \"-\" nil)", "\"\""},
+		{"A map becomes a hash table", "(gethash \"b\" (go-counts '(\"a\" \"b\" \"b\")))", "2"},
+		{"A hash table as a map", "(go-total (go-counts '(\"a\" \"b\" \"b\")))", "3"},
+		{"A struct becomes a plist", "(go-user \"ann\" 7)", "(:name \"ann\" :user-id 7 :labels (\"new\"))"},
+		{"A plist as a struct pointer", "(go-user-id (list :name \"bob\" :user-id 9))", "9"},
+		{"A structure instance as a struct", "(go-user-id (make-person :name \"cy\" :user-id 4))", "4"},
+		{"Multiple results", "(multiple-value-list (go-divmod 7 2))", "(3 1)"},
+		{"No results", "(go-nothing)", "NIL"},
+		{"A nil slice becomes NIL", "(go-nil-list)", "NIL"},
+		{"Booleans", "(list (go-not nil) (go-not 0))", "(T NIL)"},
+		{"A nil error is dropped", "(go-sqrt 16)", "4.0"},
+		{"A returned error can be caught", "(handler-case (go-sqrt -1) (error (e) (error-message e)))", "\"go-sqrt: negative\""},
+		{"A callback into the interpreter", "(go-eval \"(go-add 1 (go-add 2 3))\")", "\"6\""},
+		{"Documentation", "(documentation 'go-add)", "\"Calls the Go function example.com/yourmodule/lisp.TestRegisterFunc.func1.\""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if result := evalToString(t, interp, tc.input); result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Too few arguments", "(go-add 1)"},
+		{"Too many arguments", "(go-add 1 2 3)"},
+		{"Too few variadic arguments", "(go-join)"},
+		{"A string as an int", "(go-add \"1\" 2)"},
+		{"A float as an int", "(go-add 1.5 2)"},
+		{"An int that overflows", "(go-add 100000000000000000000 1)"},
+		{"A dotted list as a slice", "(go-join \"\" '(\"a\" . \"b\"))"},
+		{"A list as a map", "(go-total '(1 2))"},
+		{"A bad field value", "(go-user-id (list :user-id \"nine\"))"},
+		{"An error from a callback", "(go-eval \"(go-add 1)\")"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+
+	t.Run("A returned error becomes a Lisp error", func(t *testing.T) {
+		evalAndIgnoreError(interp, "(setq cleaned nil)")
+		_, err := interp.EvalString("(unwind-protect (go-sqrt -1) (setq cleaned t))")
+		var lispErr *Error
+		if !errors.Is(err, errNegative) || !errors.As(err, &lispErr) || err.Error() != "go-sqrt: negative" {
+			t.Errorf("Expected a Lisp error wrapping %v, got %v", errNegative, err)
+		}
+		if result := evalToString(t, interp, "cleaned"); result != "T" {
+			t.Errorf("Expected the cleanup to run, got %s", result)
+		}
+	})
+
+	t.Run("Only functions can be registered", func(t *testing.T) {
+		if err := interp.RegisterFunc("go-bad", 42); err == nil {
+			t.Errorf("Expected an error registering a non-function")
+		}
+		if _, ok := interp.Lookup("go-bad"); ok {
+			t.Errorf("Expected go-bad to stay unbound")
+		}
+	})
+}
+
+func TestMarshal(t *testing.T) {
+	type point struct {
+		Struct `lisp:"point"`
+		X, Y   int
+	}
+	type shape struct {
+		Name    string
+		Corners []point  `lisp:"corners,vector"`
+		Tags    []string `lisp:"tags"`
+		Scale   float64  `lisp:"scale"`
+		Props   map[string]int
+		Parent  *shape
+		Hidden  bool `lisp:"-"`
+		Extra   interface{}
+	}
+	in := shape{
+		Name:    "tri",
+		Corners: []point{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 0, Y: 3}},
+		Tags:    []string{"a", "b"},
+		Scale:   1.5,
+		Props:   map[string]int{"sides": 3, "angles": 3},
+		Parent:  &shape{Name: "root"},
+		Hidden:  true,
+	}
+
+	t.Run("Marshal", func(t *testing.T) {
+		testCases := []struct {
+			description string
+			value       interface{}
+			expected    string
+		}{
+			{"An int", 42, "42"},
+			{"A uint64 past an int", uint64(1) << 63, "9223372036854775808"},
+			{"A string", "hi", "\"hi\""},
+			{"A slice", []int{1, 2, 3}, "(1 2 3)"},
+			{"An array", [2]bool{true, false}, "(T NIL)"},
+			{"A nil slice", []int(nil), "NIL"},
+			{"A nil pointer", (*point)(nil), "NIL"},
+			{"A struct", struct{ UserID int }{7}, "(:user-id 7)"},
+			{"A marked struct", point{X: 1, Y: 2}, "#S(point :x 1 :y 2)"},
+			{"A pointer to a marked struct", &point{X: 1, Y: 2}, "#S(point :x 1 :y 2)"},
+			{"A nested struct", in, "(:name \"tri\" :corners #(#S(point :x 0 :y 0) #S(point :x 4 :y 0) #S(point :x 0 :y 3)) :tags (\"a\" \"b\") :scale 1.5 :props #<HASH-TABLE :TEST EQUAL :COUNT 2> :parent (:name \"root\" :corners NIL :tags NIL :scale 0.0 :props NIL :parent NIL :extra NIL) :extra NIL)"},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.description, func(t *testing.T) {
+				v, err := Marshal(tc.value)
+				if err != nil {
+					t.Fatalf("Marshal failed: %v", err)
+				}
+				if result := Format(v); result != tc.expected {
+					t.Errorf("Expected %s, got %s", tc.expected, result)
+				}
+			})
+		}
+	})
+
+	t.Run("Round trips", func(t *testing.T) {
+		v, err := Marshal(in)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		var out shape
+		if err := Unmarshal(v, &out); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		in.Hidden = false
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("Expected %+v, got %+v", in, out)
+		}
+
+		for _, x := range []interface{}{-5, "text", []float64{1, 2.5}, map[int][]string{1: {"x"}, 2: nil}, point{X: 3, Y: 4}, []int(nil), map[string]int(nil)} {
+			v, err := Marshal(x)
+			if err != nil {
+				t.Fatalf("Marshal %v failed: %v", x, err)
+			}
+			p := reflect.New(reflect.TypeOf(x))
+			if err := Unmarshal(v, p.Interface()); err != nil {
+				t.Fatalf("Unmarshal %s failed: %v", Format(v), err)
+			}
+			if !reflect.DeepEqual(x, p.Elem().Interface()) {
+				t.Errorf("Expected %v, got %v", x, p.Elem().Interface())
+			}
+		}
+
+		v, err = Marshal([]int{})
+		if err != nil || v != nil {
+			t.Fatalf("Expected an empty slice to marshal to NIL, got %v, %v", v, err)
+		}
+		empty := []int{}
+		if err := Unmarshal(v, &empty); err != nil || empty != nil {
+			t.Errorf("Expected NIL to unmarshal to a nil slice, got %#v, %v", empty, err)
+		}
+	})
+
+	t.Run("Round trips through an interpreter", func(t *testing.T) {
+		interp := New()
+		evalAndIgnoreError(interp, "(defstruct point x y (label \"origin\"))")
+		p, err := interp.Marshal(point{X: 3, Y: 4})
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		interp.Define("p", p)
+		if result := evalToString(t, interp, "(list (point-p p) (point-x p) (point-label p))"); result != "(T 3 \"origin\")" {
+			t.Errorf("Expected (T 3 \"origin\"), got %s", result)
+		}
+		for _, tc := range []struct {
+			input    string
+			expected point
+		}{
+			{"(make-point :x 5 :y 6)", point{X: 5, Y: 6}},
+			{"(progn (setf (point-y p) 9) p)", point{X: 3, Y: 9}},
+			{"(aref (vector 1 p) 1)", point{X: 3, Y: 9}},
+		} {
+			v, err := interp.EvalString(tc.input)
+			if err != nil {
+				t.Fatalf("EvalString %s failed: %v", tc.input, err)
+			}
+			var got point
+			if err := Unmarshal(v, &got); err != nil || got != tc.expected {
+				t.Errorf("Expected %v from %s, got %v, %v", tc.expected, tc.input, got, err)
+			}
+		}
+		v, err := interp.EvalString("(list :name \"sq\" :tags '(\"x\") :props (let ((h (make-hash-table :test 'equal))) (setf (gethash \"sides\" h) 4) h))")
+		if err != nil {
+			t.Fatalf("EvalString failed: %v", err)
+		}
+		var sq shape
+		if err := Unmarshal(v, &sq); err != nil || sq.Name != "sq" || len(sq.Tags) != 1 || sq.Props["sides"] != 4 {
+			t.Errorf("Expected the sq shape, got %+v, %v", sq, err)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		var n int
+		if err := Unmarshal(1, n); err == nil {
+			t.Errorf("Expected an error unmarshaling into a non-pointer")
+		}
+		if err := Unmarshal(newLispString("1"), &n); err == nil {
+			t.Errorf("Expected an error unmarshaling a string into an int")
+		}
+		var p point
+		if err := Unmarshal(makeList(":x", 1, ":y"), &p); err == nil {
+			t.Errorf("Expected an error unmarshaling an odd plist")
+		}
+		interp := New()
+		evalAndIgnoreError(interp, "(defstruct other x y) (defstruct point x)")
+		v, _ := interp.EvalString("(make-other :x 1 :y 2)")
+		if err := Unmarshal(v, &p); err == nil {
+			t.Errorf("Expected an error unmarshaling another structure type")
+		}
+		if _, err := interp.Marshal(point{X: 1, Y: 2}); err == nil {
+			t.Errorf("Expected an error marshaling a field the structure lacks")
+		}
+		if _, err := Marshal(make(chan int)); err == nil {
+			t.Errorf("Expected an error marshaling a channel")
+		}
+		loop := &shape{Name: "loop"}
+		loop.Parent = loop
+		if _, err := Marshal(loop); err == nil {
+			t.Errorf("Expected an error marshaling a pointer cycle")
+		}
+		self := map[string]interface{}{}
+		self["self"] = self
+		if _, err := interp.Marshal(self); err == nil {
+			t.Errorf("Expected an error marshaling a map that contains itself")
+		}
+		list := []interface{}{nil}
+		list[0] = list
+		if _, err := Marshal(list); err == nil {
+			t.Errorf("Expected an error marshaling a slice that contains itself")
+		}
+		shared := &shape{Name: "shared"}
+		if _, err := Marshal([]*shape{shared, shared}); err != nil {
+			t.Errorf("Expected a pointer shared without a cycle to marshal, got %v", err)
+		}
+	})
+}
+
+// compilerDefinitions are function definitions from TestLispFunctions, shared
+// by TestCompiler and the interpreter and compiler benchmarks.
+var compilerDefinitions = []string{
+	"(defun rev (L R) (cond ((null L) R) (t (rev (cdr L) (cons (car L) R)))))",
+	"(defun my-append (L1 L2) (cond ((null L1) L2) (t (cons (car L1) (my-append (cdr L1) L2)))))",
+	"(defun my-length (l) (cond ((null l) 0) (t (1+ (my-length (cdr l))))))",
+	"(defun my-memq (a l) (cond ((null l) nil) ((eq a (car l)) l) (t (my-memq a (cdr l)))))",
+	"(defun my-mapcar (f l) (cond ((null l) nil) (t (cons (apply f (list (car l))) (my-mapcar f (cdr l))))))",
+	"(defun my-copy (l) (cond ((null l) nil) ((atom l) l) (t (cons (my-copy (car l)) (my-copy (cdr l))))))",
+	"(defun my-remove (x l) (cond ((null l) nil) ((equal x (car l)) (my-remove x (cdr l))) (t (cons (car l) (my-remove x (cdr l))))))",
+	"(defun my-add (n1 n2) (cond ((and (null n1) (null n2)) nil) ((null n1) n2) ((null n2) n1) (t (let* ((sum (+ (car n1) (car n2))) (digit (mod sum 10)) (carry (floor sum 10))) (if (or (cdr n1) (cdr n2) (not (zerop carry))) (cons digit (my-add (my-add (cdr n1) (cdr n2)) (list carry))) (cons digit nil))))))",
+	"(defun my-merge (l1 l2) (cond ((null l1) l2) ((null l2) l1) ((< (car l1) (car l2)) (cons (car l1) (my-merge (cdr l1) l2))) (t (cons (car l2) (my-merge l1 (cdr l2))))))",
+	"(defun starts-with (l1 l2) (cond ((null l1) t) ((null l2) nil) ((equal (car l1) (car l2)) (starts-with (cdr l1) (cdr l2))) (t nil)))",
+	"(defun my-sublist (l1 l2) (cond ((null l2) nil) ((starts-with l1 l2) t) (t (my-sublist l1 (cdr l2)))))",
+	"(defun count-down (n) (if (= n 0) 'done (count-down (1- n))))",
+}
+
+// compilerWorkload is evaluated by the benchmarks.
+var compilerWorkload = []string{
+	"(my-length (rev big nil))",
+	"(my-merge (my-copy evens) odds)",
+	"(my-add '(1 1 1 1 1 1 1 1 1 1) '(9 9 9 9 9 9 9 9 9 9))",
+	"(my-sublist '(498 499) (my-remove 3 big))",
+	"(count-down 1000)",
+}
+
+// setupCompilerWorkload returns an interpreter with the workload functions
+// and data defined, compiling the functions if compiled is true.
+func setupCompilerWorkload(compiled bool) *Interpreter {
+	interp := New()
+	for _, def := range compilerDefinitions {
+		name, err := interp.EvalString(def)
+		if err != nil {
+			panic(err)
+		}
+		if compiled {
+			if _, err := interp.Eval(makeList("compile", makeList("quote", name))); err != nil {
+				panic(err)
+			}
+		}
+	}
+	var big, evens, odds []interface{}
+	for i := 0; i < 500; i++ {
+		big = append(big, i)
+		if i%2 == 0 {
+			evens = append(evens, i)
+		} else {
+			odds = append(odds, i)
+		}
+	}
+	interp.Define("big", makeList(big...))
+	interp.Define("evens", makeList(evens...))
+	interp.Define("odds", makeList(odds...))
+	return interp
+}
+
+func TestCompiler(t *testing.T) {
+	interp := setupCompilerWorkload(true)
+	evalAndIgnoreError(interp, "(defun classify (n) (cond ((< n 0) 'negative) ((= n 0) 'zero) (t 'positive)))")
+	evalAndIgnoreError(interp, "(defun both (a b) (list (and a b) (or a b)))")
+	evalAndIgnoreError(interp, "(defun swap-sum (a b) (let ((a b) (b a)) (- a b)))")
+	evalAndIgnoreError(interp, "(defun counter (n) (let ((i 0)) (setq i (+ i n)) (setq total (+ total i)) i))")
+	evalAndIgnoreError(interp, "(defun adder (n) (lambda (x) (+ x n)))")
+	evalAndIgnoreError(interp, "(defun halves (n) (floor n 2))")
+	evalAndIgnoreError(interp, "(defvar *scale* 10)")
+	evalAndIgnoreError(interp, "(defun scaled (n) (* n *scale*))")
+	evalAndIgnoreError(interp, "(defun rescaled (n) (let ((*scale* 2)) (scaled n)))")
+	evalAndIgnoreError(interp, "(defun fallback-setq (n) (let ((x 1)) (setf x (+ x n)) x))")
+	evalAndIgnoreError(interp, "(setq total 0)")
+	for _, name := range []string{"classify", "both", "swap-sum", "counter", "adder", "halves", "scaled", "rescaled", "fallback-setq"} {
+		evalAndIgnoreError(interp, "(compile '"+name+")")
+	}
+
+	tests := []struct {
+		description string
+		input       string
+		expected    string
+	}{
+		{"A compiled function prints unreadably", "(symbol-value 'rev)", "#<COMPILED-FUNCTION rev>"},
+		{"Compiled rev", "(rev '(A B C D E) nil)", "(E D C B A)"},
+		{"Compiled my-append", "(my-append '((a) (b) (c)) '((d) (e) (f)))", "((a) (b) (c) (d) (e) (f))"},
+		{"Compiled my-length", "(my-length '(A (((B))) C))", "3"},
+		{"Compiled my-memq", "(my-memq 'D '(A B C D E F G))", "(D E F G)"},
+		{"Compiled my-mapcar", "(my-mapcar '1+ '(1 3 5 7))", "(2 4 6 8)"},
+		{"Compiled my-copy of a dotted list", "(my-copy '(A B . C))", "(A B . C)"},
+		{"Compiled my-remove", "(my-remove '(A B) '(A B (A B) A A B (A B)))", "(A B A A B)"},
+		{"Compiled my-add", "(my-add '(1) '(9 9 9 9 9 9 9 9 9 9))", "(0 0 0 0 0 0 0 0 0 0 1)"},
+		{"Compiled my-merge", "(my-merge '(1 3 5 7 9) '(2 4 6 8 10))", "(1 2 3 4 5 6 7 8 9 10)"},
+		{"Compiled my-sublist", "(my-sublist '(3 4 5) '(1 2 3 4 5))", "T"},
+		{"Compiled my-sublist failing", "(my-sublist '(2 4) '(1 2 3 4 5))", "NIL"},
+		{"Self tail calls run in constant space", "(count-down 1000000)", "done"},
+		{"Deep non-tail recursion", "(my-length big)", "500"},
+		{"Cond falls through to nil", "(list (classify -5) (classify 0) (classify 7))", "(negative zero positive)"},
+		{"And and or return T or NIL", "(list (both 1 2) (both nil 2) (both nil nil))", "((T T) (NIL T) (NIL NIL))"},
+		{"Let binds in parallel", "(swap-sum 1 10)", "9"},
+		{"Setq of a local and a global", "(list (counter 5) (counter 2) total)", "(5 2 7)"},
+		{"A lambda is left to the interpreter", "(funcall (adder 3) 4)", "7"},
+		{"Multiple values from a tail call", "(multiple-value-list (halves 7))", "(3 1)"},
+		{"A special variable", "(scaled 3)", "30"},
+		{"A dynamic binding is left to the interpreter", "(list (rescaled 3) *scale*)", "(6 10)"},
+		{"Assignments by the interpreter reach the slots", "(fallback-setq 4)", "5"},
+		{"Compile a lambda expression", "(funcall (compile nil '(lambda (x y) (+ x y))) 2 3)", "5"},
+		{"Compile and name a lambda expression", "(compile 'twice '(lambda (x) (* 2 x)))", "twice"},
+		{"Call the named function", "(twice 21)", "42"},
+		{"Compile a closure", "(funcall (compile nil (adder 10)) 5)", "15"},
+		{"Compiled functions work with builtins", "(mapcar 'twice '(1 2 3))", "(2 4 6)"},
+		{"Compiling twice is harmless", "(progn (compile 'rev) (rev '(1 2) nil))", "(2 1)"},
+		{"Yield through a compiled function", "(defun yield-twice (a) (yield a) (yield (+ a 1))) (defun via-compiled (a) (yield-twice a)) (compile 'via-compiled) (setq vg (make-generator 'via-compiled 5)) (list (next vg) (next vg) (nth-value 1 (next vg)))", "(5 6 NIL)"},
+		{"Yield from compiled code", "(compile 'yield-twice) (setq yg (make-generator 'yield-twice 1)) (list (next yg) (next yg))", "(1 2)"},
+		{"Reenter a continuation captured under compiled code", "(defun capture () (call/cc (lambda (c) (setq saved-k c) 1))) (defun add-captured (n) (+ n (capture))) (compile 'add-captured) (let ((results nil)) (push (add-captured 10) results) (if (< (length results) 2) (funcall saved-k 5)) results)", "(15 11)"},
+		{"Deep recursion through a compiled function and the interpreter", "(defun count-via (n) (if (= n 0) 0 (+ 1 (count-via-interpreted (- n 1))))) (defun count-via-interpreted (n) (count-via n)) (compile 'count-via) (count-via 100000)", "100000"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			result := evalToString(t, interp, tc.input)
+			if result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		description string
+		input       string
+	}{
+		{"Compile a builtin", "(compile 'car)"},
+		{"Wrong number of arguments", "(rev '(1))"},
+		{"A primitive checks its arguments", "(count-down 'a)"},
+	}
+	for _, tc := range errorTests {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := interp.EvalString(tc.input); err == nil {
+				t.Errorf("Expected an error from %s", tc.input)
+			}
+		})
+	}
+
+	t.Run("Disassemble", func(t *testing.T) {
+		expected := `#<COMPILED-FUNCTION count-down> (n)
+   0  LOCAL       0 ; n
+   1  CONST       0
+   2  =
+   3  JUMP-IF-NIL 6
+   4  CONST       done
+   5  RETURN
+   6  LOCAL       0 ; n
+   7  SUB1
+   8  TAIL-CALL
+`
+		result, _ := interp.do(func() interface{} { return interp.compileFunction("count-down").disassemble() })
+		if result != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, result)
+		}
+	})
+}
+
+func BenchmarkInterpreted(b *testing.B) {
+	benchmarkWorkload(b, false)
+}
+
+func BenchmarkCompiled(b *testing.B) {
+	benchmarkWorkload(b, true)
+}
+
+func benchmarkWorkload(b *testing.B, compiled bool) {
+	interp := setupCompilerWorkload(compiled)
+	exprs := make([]Value, len(compilerWorkload))
+	for i, w := range compilerWorkload {
+		exprs[i], _ = Read(w)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, e := range exprs {
+			if _, err := interp.Eval(e); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
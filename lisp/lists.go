@@ -0,0 +1,565 @@
+package lisp
+
+import (
+	"strings"
+)
+
+// A cons is a Lisp cons cell. Lists are chains of conses linked through their
+// cdrs and ending in NIL (Go nil), so two lists can share structure and a
+// destructive operation on a cell is visible through every reference to it.
+type cons struct {
+	car, cdr interface{}
+}
+
+// makeList builds a proper list of elems, or NIL when there are none.
+func makeList(elems ...interface{}) interface{} {
+	return makeDottedList(elems, nil)
+}
+
+// makeDottedList builds a list of elems whose last cdr is tail.
+func makeDottedList(elems []interface{}, tail interface{}) interface{} {
+	result := tail
+	for i := len(elems) - 1; i >= 0; i-- {
+		result = &cons{elems[i], result}
+	}
+	return result
+}
+
+// listElements returns the elements of a list and whether x is a list. A
+// dotted or circular list is an error.
+func listElements(x interface{}) ([]interface{}, bool) {
+	switch v := x.(type) {
+	case nil:
+		return nil, true
+	case *cons:
+		switch proper, circular := properList(v); {
+		case circular:
+			panic("a circular list is not a proper list")
+		case !proper:
+			panic(toLispString(v) + " is not a proper list")
+		}
+		var elems []interface{}
+		for c, ok := v, true; ok; c, ok = c.cdr.(*cons) {
+			elems = append(elems, c.car)
+		}
+		return elems, true
+	}
+	return nil, false
+}
+
+// properList checks if x is a proper list, one that ends in NIL, and if it
+// is not, whether it is circular rather than dotted.
+func properList(x interface{}) (proper, circular bool) {
+	slow := x
+	for i := 0; ; i++ {
+		c, ok := x.(*cons)
+		if !ok {
+			return x == nil, false
+		}
+		x = c.cdr
+		// slow moves at half the speed of x, so x catches up with it in a cycle.
+		if i%2 == 1 {
+			slow = slow.(*cons).cdr
+			if next, ok := x.(*cons); ok && next == slow.(*cons) {
+				return false, true
+			}
+		}
+	}
+}
+
+// isProperList checks if x is a list that ends in NIL.
+func isProperList(x interface{}) bool {
+	proper, _ := properList(x)
+	return proper
+}
+
+// isList checks if x is a list: NIL or a cons.
+func isList(x interface{}) bool {
+	_, ok := x.(*cons)
+	return ok || x == nil
+}
+
+// lispCar returns the first element of a list, or NIL for NIL and non-lists.
+func lispCar(x interface{}) interface{} {
+	if c, ok := x.(*cons); ok {
+		return c.car
+	}
+	return nil
+}
+
+// lispCdr returns the rest of a list after its first element, or NIL.
+func lispCdr(x interface{}) interface{} {
+	if c, ok := x.(*cons); ok {
+		return c.cdr
+	}
+	return nil
+}
+
+// consValue constructs a new cons cell whose car is a and whose cdr is b.
+func consValue(a, b interface{}) interface{} {
+	return &cons{a, b}
+}
+
+// consArg checks that x is a cons, panicking with msg otherwise.
+func consArg(x interface{}, msg string) *cons {
+	c, ok := x.(*cons)
+	if !ok {
+		panic(msg)
+	}
+	return c
+}
+
+// setCar replaces the car of a cons in place.
+func setCar(x, value interface{}) interface{} {
+	consArg(x, "setf: cannot set the car of "+toLispString(x)).car = value
+	return value
+}
+
+// setCdr replaces the cdr of a cons in place.
+func setCdr(x, value interface{}) interface{} {
+	consArg(x, "setf: cannot set the cdr of "+toLispString(x)).cdr = value
+	return value
+}
+
+// nthIndex checks that n is a non-negative integer index for nth.
+func nthIndex(n interface{}) int {
+	i, ok := n.(int)
+	if !ok || i < 0 {
+		panic("nth expects a non-negative integer index")
+	}
+	return i
+}
+
+// nthCons returns the cons at index n of a list, or nil past its end.
+func nthCons(n, x interface{}) *cons {
+	i := nthIndex(n)
+	c, _ := x.(*cons)
+	for ; c != nil && i > 0; i-- {
+		c, _ = c.cdr.(*cons)
+	}
+	return c
+}
+
+// nthElement returns the element of a list at index n, or NIL past its end.
+func nthElement(n, x interface{}) interface{} {
+	if c := nthCons(n, x); c != nil {
+		return c.car
+	}
+	return nil
+}
+
+// setNth replaces the element of a list at index n.
+func setNth(n, x, value interface{}) interface{} {
+	c := nthCons(n, x)
+	if c == nil {
+		panic("setf: index " + toLispString(n) + " is past the end of " + toLispString(x))
+	}
+	c.car = value
+	return value
+}
+
+// nconc destructively concatenates lists by setting the last cdr of each
+// non-empty list to the next one. The last argument is linked in as it is,
+// without walking it, so it may be any object, even a circular list or one
+// of the other arguments.
+func nconc(lists []interface{}) interface{} {
+	var result interface{}
+	var last *cons
+	for i, l := range lists {
+		if isNil(l) {
+			continue
+		}
+		// The last cell of each list but the final one is found before it is
+		// linked in, which could make it circular.
+		var tail *cons
+		if i < len(lists)-1 {
+			c, ok := l.(*cons)
+			if !ok {
+				panic("nconc expects lists")
+			}
+			if _, circular := properList(c); circular {
+				panic("nconc: only the last argument can be a circular list")
+			}
+			for tail = c; ; {
+				next, more := tail.cdr.(*cons)
+				if !more {
+					break
+				}
+				tail = next
+			}
+		}
+		if last == nil {
+			result = l
+		} else {
+			last.cdr = l
+		}
+		last = tail
+	}
+	return result
+}
+
+// nreverse reverses a list in place by relinking its cells, returning the
+// cell that was last.
+func nreverse(x interface{}) interface{} {
+	if _, circular := properList(x); circular {
+		panic("nreverse expects a proper list, not a circular one")
+	}
+	var result interface{}
+	for x != nil {
+		c := consArg(x, "nreverse expects a proper list")
+		x, c.cdr = c.cdr, result
+		result = c
+	}
+	return result
+}
+
+// deleteItem destructively removes the elements of a list that are eql to
+// item by unlinking their cells.
+func deleteItem(item, x interface{}) interface{} {
+	head := &cons{nil, x}
+	prev := head
+	for next, ok := prev.cdr.(*cons); ok; next, ok = prev.cdr.(*cons) {
+		if eqlp(next.car, item) {
+			prev.cdr = next.cdr
+		} else {
+			prev = next
+		}
+	}
+	return head.cdr
+}
+
+// formatList prints a list in (a b c) syntax, or (a b . c) when its last cdr
+// is not NIL. A cdr that a cycle returns to is printed after a dot too, as
+// its label.
+func (p *printer) formatList(c *cons) string {
+	var b strings.Builder
+	b.WriteString("(")
+	for cell := c; ; {
+		b.WriteString(p.printObject(cell.car))
+		next, ok := cell.cdr.(*cons)
+		if !ok || p.cycles[next] {
+			if cell.cdr != nil {
+				b.WriteString(" . " + p.printObject(cell.cdr))
+			}
+			break
+		}
+		b.WriteString(" ")
+		cell = next
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// A matcher compares an item with the elements of a sequence as the :test,
+// :test-not and :key keyword arguments of the sequence functions specify:
+// the key is applied to each element, and the test, EQL by default, is
+// called with the item and the key's result.
+type matcher struct {
+	test, testNot, key interface{}
+	in                 *Interpreter
+}
+
+// newMatcher creates a matcher from parsed keyword arguments.
+func newMatcher(kwargs map[string]interface{}, in *Interpreter) *matcher {
+	m := &matcher{test: kwargs["TEST"], testNot: kwargs["TEST-NOT"], key: kwargs["KEY"], in: in}
+	if !isNil(m.test) && !isNil(m.testNot) {
+		panic("cannot supply both :test and :test-not")
+	}
+	return m
+}
+
+// keyOf applies the :key function to an element.
+func (m *matcher) keyOf(elem interface{}) interface{} {
+	if isNil(m.key) {
+		return elem
+	}
+	return m.in.applyFunction(m.key, []interface{}{elem})
+}
+
+// matches checks if item satisfies the test against elem, after applying the key to elem.
+func (m *matcher) matches(item, elem interface{}) bool {
+	k := m.keyOf(elem)
+	switch {
+	case !isNil(m.test):
+		return !isNil(m.in.applyFunction(m.test, []interface{}{item, k}))
+	case !isNil(m.testNot):
+		return isNil(m.in.applyFunction(m.testNot, []interface{}{item, k}))
+	}
+	return eqlp(item, k)
+}
+
+// listArg checks that x is a list, panicking with msg otherwise.
+func listArg(x interface{}, msg string) interface{} {
+	if !isList(x) {
+		panic(msg)
+	}
+	return x
+}
+
+// appendLists concatenates lists, copying all but the last, which the result shares.
+func appendLists(lists []interface{}) interface{} {
+	if len(lists) == 0 {
+		return nil
+	}
+	var elems []interface{}
+	for _, l := range lists[:len(lists)-1] {
+		elems = append(elems, toList(listArg(l, "append expects lists"))...)
+	}
+	return makeDottedList(elems, lists[len(lists)-1])
+}
+
+// reverseList returns a fresh list with the elements of a list in reverse order.
+func reverseList(x interface{}) interface{} {
+	var result interface{}
+	for _, e := range toList(x) {
+		result = &cons{e, result}
+	}
+	return result
+}
+
+// nthcdr returns the tail of a list after n cdrs.
+func nthcdr(n, x interface{}) interface{} {
+	i := nthIndex(n)
+	for ; i > 0 && x != nil; i-- {
+		x = consArg(x, "nthcdr expects a list").cdr
+	}
+	return x
+}
+
+// lastConses returns the last n conses of a list.
+func lastConses(x interface{}, n int) interface{} {
+	// Walk a lead pointer n cells ahead, then advance both to the end.
+	lead := x
+	for i := 0; i < n; i++ {
+		c, ok := lead.(*cons)
+		if !ok {
+			return x
+		}
+		lead = c.cdr
+	}
+	for {
+		c, ok := lead.(*cons)
+		if !ok {
+			return x
+		}
+		lead = c.cdr
+		x = x.(*cons).cdr
+	}
+}
+
+// butlast returns a fresh list of all but the last n elements of a list.
+func butlast(x interface{}, n int) interface{} {
+	elems := toList(x)
+	if n >= len(elems) {
+		return nil
+	}
+	return makeList(elems[:len(elems)-n]...)
+}
+
+// memberTail returns the tail of a list beginning with the first element
+// that matches item, or NIL.
+func memberTail(item, x interface{}, m *matcher) interface{} {
+	for c, ok := x.(*cons); ok; c, ok = c.cdr.(*cons) {
+		if m.matches(item, c.car) {
+			return c
+		}
+	}
+	return nil
+}
+
+// assocPair returns the first pair of an association list whose car (or
+// cdr, for rassoc) matches item, or NIL. NIL elements are skipped.
+func assocPair(item, pairs interface{}, m *matcher, byCdr bool) interface{} {
+	for c, ok := pairs.(*cons); ok; c, ok = c.cdr.(*cons) {
+		pair, isPair := c.car.(*cons)
+		if !isPair {
+			continue
+		}
+		k := pair.car
+		if byCdr {
+			k = pair.cdr
+		}
+		if m.matches(item, k) {
+			return pair
+		}
+	}
+	return nil
+}
+
+// mapArguments returns the arguments of the calls that map a function over
+// successive elements of the lists, or over successive tails for maplist and
+// mapl, stopping at the end of the shortest list.
+func mapArguments(lists []interface{}, tails bool) [][]interface{} {
+	var argLists [][]interface{}
+	for {
+		args := make([]interface{}, len(lists))
+		for i, l := range lists {
+			c, ok := l.(*cons)
+			if !ok {
+				return argLists
+			}
+			args[i] = c.car
+			if tails {
+				args[i] = c
+			}
+			lists[i] = c.cdr
+		}
+		argLists = append(argLists, args)
+	}
+}
+
+// callEach makes the machine call fn with each of the argument lists in
+// order, then calls then with the primary values of all the calls.
+func (m *machine) callEach(fn interface{}, argLists [][]interface{}, then func(m *machine, results []interface{})) {
+	m.callEachFrom(fn, argLists, 0, nil, then)
+}
+
+// callEachFrom continues callEach from the call n. done holds the results
+// of the earlier calls as a list, the latest first, which resuming a frame
+// again can share, as it is never modified.
+func (m *machine) callEachFrom(fn interface{}, argLists [][]interface{}, n int, done interface{}, then func(m *machine, results []interface{})) {
+	if n == len(argLists) {
+		results := make([]interface{}, n)
+		for i := n - 1; i >= 0; i-- {
+			c := done.(*cons)
+			results[i], done = c.car, c.cdr
+		}
+		then(m, results)
+		return
+	}
+	m.push(func(m *machine, v interface{}) {
+		m.callEachFrom(fn, argLists, n+1, &cons{primary(v), done}, then)
+	})
+	m.apply(fn, argLists[n])
+}
+
+// reduceSequence makes the machine combine elems with fn, from the left or,
+// with :from-end, from the right. The keyword arguments are INITIAL-VALUE
+// and FROM-END; the key has already been applied to elems.
+func (m *machine) reduceSequence(fn interface{}, elems []interface{}, kwargs map[string]interface{}) {
+	fromEnd := !isNil(kwargs["FROM-END"])
+	init, hasInit := kwargs["INITIAL-VALUE"]
+	if !hasInit {
+		switch len(elems) {
+		case 0:
+			m.callEach(fn, [][]interface{}{nil}, func(m *machine, results []interface{}) { m.ret(results[0]) })
+			return
+		case 1:
+			m.ret(elems[0])
+			return
+		}
+		if fromEnd {
+			init, elems = elems[len(elems)-1], elems[:len(elems)-1]
+		} else {
+			init, elems = elems[0], elems[1:]
+		}
+	}
+	m.fold(fn, init, elems, fromEnd)
+}
+
+// fold makes the machine combine the accumulated value acc with each of
+// elems in turn, from the end if fromEnd.
+func (m *machine) fold(fn, acc interface{}, elems []interface{}, fromEnd bool) {
+	if len(elems) == 0 {
+		m.ret(acc)
+		return
+	}
+	args, rest := []interface{}{acc, elems[0]}, elems[1:]
+	if fromEnd {
+		args, rest = []interface{}{elems[len(elems)-1], acc}, elems[:len(elems)-1]
+	}
+	m.push(func(m *machine, v interface{}) { m.fold(fn, primary(v), rest, fromEnd) })
+	m.apply(fn, args)
+}
+
+// containsMatch checks if a list has an element whose key matches the key of x.
+func containsMatch(x, lst interface{}, m *matcher) bool {
+	return memberTail(m.keyOf(x), lst, m) != nil
+}
+
+// adjoin adds item to the front of a list unless the list already contains
+// a matching element.
+func adjoin(item, lst interface{}, m *matcher) interface{} {
+	if containsMatch(item, lst, m) {
+		return lst
+	}
+	return &cons{item, lst}
+}
+
+// setOperation implements union, intersection, set-difference and
+// set-exclusive-or on two lists, keeping the elements of each list in order.
+func setOperation(op string, a, b interface{}, m *matcher) interface{} {
+	var result []interface{}
+	keep := func(from, other interface{}, present bool) {
+		for c, ok := from.(*cons); ok; c, ok = c.cdr.(*cons) {
+			if containsMatch(c.car, other, m) == present {
+				result = append(result, c.car)
+			}
+		}
+	}
+	switch op {
+	case "UNION":
+		result = toList(a)
+		keep(b, a, false)
+	case "INTERSECTION":
+		keep(a, b, true)
+	case "SET-DIFFERENCE":
+		keep(a, b, false)
+	case "SET-EXCLUSIVE-OR":
+		keep(a, b, false)
+		keep(b, a, false)
+	}
+	return makeList(result...)
+}
+
+// subsetp checks if every element of a is matched by an element of b.
+func subsetp(a, b interface{}, m *matcher) bool {
+	for c, ok := a.(*cons); ok; c, ok = c.cdr.(*cons) {
+		if !containsMatch(c.car, b, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// treeEqual checks if two trees of conses have the same shape and leaves
+// that satisfy test, EQL by default.
+func treeEqual(x, y interface{}, m *matcher) bool {
+	for {
+		xc, xok := x.(*cons)
+		yc, yok := y.(*cons)
+		if !xok || !yok {
+			return !xok && !yok && m.matches(x, y)
+		}
+		if !treeEqual(xc.car, yc.car, m) {
+			return false
+		}
+		x, y = xc.cdr, yc.cdr
+	}
+}
+
+// substTree returns a copy of tree in which each subtree that replace maps
+// to a new value is substituted. Unchanged subtrees are shared with tree.
+func substTree(tree interface{}, replace func(interface{}) (interface{}, bool)) interface{} {
+	if v, ok := replace(tree); ok {
+		return v
+	}
+	c, ok := tree.(*cons)
+	if !ok {
+		return tree
+	}
+	car, cdr := substTree(c.car, replace), substTree(c.cdr, replace)
+	if car == c.car && cdr == c.cdr {
+		return c
+	}
+	return &cons{car, cdr}
+}
+
+// copyTree returns a copy of a tree of conses; the leaves are shared.
+func copyTree(tree interface{}) interface{} {
+	c, ok := tree.(*cons)
+	if !ok {
+		return tree
+	}
+	return &cons{copyTree(c.car), copyTree(c.cdr)}
+}
@@ -0,0 +1,386 @@
+package lisp
+
+import (
+	"strings"
+)
+
+// Expressions are evaluated by an explicit-stack machine rather than by
+// recursive Go calls, so that the rest of a computation is an ordinary value
+// that call/cc can capture. The machine keeps its continuation as a linked
+// list of frames on the heap: evaluating a form either returns a value to
+// the innermost frame or pushes frames and moves on to a subform. Frames are
+// never modified once pushed, so a captured continuation can be resumed any
+// number of times.
+//
+// The mapping functions mapcar, mapc, mapcan, maplist and mapl and reduce
+// call back into Lisp on the machine, so continuations captured in their
+// callbacks behave like any others. Other builtins that call back into
+// Lisp, such as sort, remove-if, find-if and those taking :test or :key
+// functions, do so through applyFunction, which starts a nested run of the
+// machine. A continuation captured in a nested run can escape from it, but
+// cannot be resumed once the builtin has returned: invoking it signals
+// "the continuation was captured inside a builtin that has returned", and
+// yield cannot be called there either.
+
+// A frame is one step of a continuation: resume receives the value of the
+// form evaluated for it. The base frame of a run has no resume function. A
+// frame with a handle function, pushed by handler-case or ignore-errors,
+// also receives the errors signaled while it is on the continuation.
+type frame struct {
+	next   *frame
+	resume func(m *machine, v interface{})
+	handle func(m *machine, err *Error)
+}
+
+// A run is one activation of the machine, started by myEvalValues or
+// applyFunctionValues. A toplevel run is one not nested inside another. A
+// run started by next belongs to a generator, which yield suspends.
+type run struct {
+	toplevel  bool
+	done      bool
+	winds     *wind
+	generator *generator
+}
+
+// A machine executes the analyzed form code in env, or, when returning is
+// true, passes value to the frame k. in is the interpreter it runs for.
+type machine struct {
+	in        *Interpreter
+	run       *run
+	k         *frame
+	code      *analysis
+	env       *environment
+	value     interface{}
+	returning bool
+}
+
+// A continuation is the rest of a computation, captured by call/cc or
+// call/ec. An escape continuation from call/ec can only be invoked while the
+// call/ec form that created it is still running.
+type continuation struct {
+	k      *frame
+	winds  *wind
+	run    *run
+	escape bool
+	live   bool
+}
+
+// A continuationJump carries the values passed to a continuation from a
+// nested run out to the run that captured it.
+type continuationJump struct {
+	c    *continuation
+	vals []interface{}
+}
+
+// execute runs the machine from start until the base frame receives a value.
+func (in *Interpreter) execute(start func(m *machine)) interface{} {
+	r := &run{toplevel: in.runDepth == 0, winds: in.winds}
+	in.runDepth++
+	defer func() {
+		in.runDepth--
+		r.done = true
+	}()
+	m := &machine{in: in, run: r, k: &frame{}}
+	start(m)
+	for {
+		if result, finished := m.loop(); finished {
+			return result
+		}
+	}
+}
+
+// loop steps the machine until it finishes. A jump to one of the run's
+// continuations from a nested run, or an error caught by a handler frame,
+// stops the loop with finished false, ready to be resumed. Any other panic
+// unwinds the run's dynamic-wind entries before it propagates.
+func (m *machine) loop() (result interface{}, finished bool) {
+	defer func() {
+		if x := recover(); x != nil {
+			if j, ok := x.(*continuationJump); ok {
+				if m.accepts(j.c) {
+					m.resumeAt(j.c, j.vals)
+					return
+				}
+			} else if m.handle(x) {
+				return
+			}
+			m.in.rewind(m.run.winds)
+			panic(x)
+		}
+	}()
+	for {
+		if !m.returning {
+			m.code.exec(m, m.env)
+			continue
+		}
+		f := m.k
+		if f.resume == nil {
+			return m.value, true
+		}
+		m.k = f.next
+		m.returning = false
+		f.resume(m, m.value)
+	}
+}
+
+// handle passes the error x to the innermost handler frame of the run, if
+// there is one, which continues the machine in place of the frames above it.
+func (m *machine) handle(x interface{}) bool {
+	for f := m.k; f.resume != nil; f = f.next {
+		if f.handle != nil {
+			m.k = f.next
+			f.handle(m, condition(x))
+			return true
+		}
+	}
+	return false
+}
+
+// eval makes the machine evaluate expr in the global environment next.
+func (m *machine) eval(expr interface{}) {
+	m.exec(m.in.globalScope().analyze(expr), nil)
+}
+
+// exec makes the machine execute the analyzed form code in env next.
+func (m *machine) exec(code *analysis, env *environment) {
+	m.code, m.env, m.returning = code, env, false
+}
+
+// ret returns a value, or multiple values, to the innermost frame.
+func (m *machine) ret(v interface{}) {
+	m.value, m.returning = v, true
+}
+
+// push adds a frame that receives the value of the next form evaluated.
+func (m *machine) push(resume func(m *machine, v interface{})) {
+	m.k = &frame{next: m.k, resume: resume}
+}
+
+// pushHandler adds a frame that passes on the values it receives and calls
+// handle with the errors signaled before then, after unwinding the
+// dynamic-wind entries down to the ones in effect now.
+func (m *machine) pushHandler(handle func(m *machine, err *Error)) {
+	winds := m.in.winds
+	m.k = &frame{next: m.k, resume: func(m *machine, v interface{}) { m.ret(v) }, handle: func(m *machine, err *Error) {
+		m.in.rewind(winds)
+		handle(m, err)
+	}}
+}
+
+// pushRestore adds a frame that unwinds the dynamic-wind entries down to
+// winds and passes on the values it receives.
+func (m *machine) pushRestore(winds *wind) {
+	m.push(func(m *machine, v interface{}) {
+		m.in.rewind(winds)
+		m.ret(v)
+	})
+}
+
+// apply calls a function value with evaluated arguments. The bodies of
+// closures and user-defined functions are evaluated in tail position, unless
+// they bind special parameters.
+func (m *machine) apply(fn interface{}, args []interface{}) {
+	switch f := fn.(type) {
+	case string:
+		m.applyNamed(f, strings.ToUpper(f), args)
+	case *closure:
+		if f.in != nil && f.in != m.in {
+			// A closure from another interpreter runs there.
+			m.ret(f.in.applyFunctionValues(f, args))
+			return
+		}
+		env := bindFormals(f.formals, args, f.env)
+		if len(f.code.dynamic) > 0 {
+			// Special parameters are bound dynamically until the body exits.
+			m.pushRestore(m.in.winds)
+			for _, i := range f.code.dynamic {
+				m.in.bindParameter(f.formals[i].(string), args[i])
+			}
+		}
+		m.evalBody(f.code.analyzed(), env)
+	case *continuation:
+		m.throw(f, args)
+	case *compiledFunction:
+		m.callCompiled(f, args)
+	case *structFunction:
+		m.ret(m.in.applyStructFunction(f, args))
+	case *builtin:
+		m.callBuiltin(f, args)
+	default:
+		panic("Invalid function: " + toLispString(fn))
+	}
+}
+
+// applyNamed calls the function named by the symbol name, whose upper-case
+// form is up, with evaluated arguments.
+func (m *machine) applyNamed(name, up string, args []interface{}) {
+	switch up {
+	case "CALL/CC", "CALL-WITH-CURRENT-CONTINUATION":
+		if len(args) != 1 {
+			panic("call/cc expects 1 argument")
+		}
+		c := &continuation{k: m.k, winds: m.in.winds, run: m.run}
+		m.apply(args[0], []interface{}{c})
+		return
+	case "CALL/EC", "CALL-WITH-ESCAPE-CONTINUATION":
+		if len(args) != 1 {
+			panic("call/ec expects 1 argument")
+		}
+		m.ret(m.in.callWithEscapeContinuation(args[0]))
+		return
+	case "DYNAMIC-WIND":
+		// (dynamic-wind before thunk after) calls before, thunk and after,
+		// calling after whenever control leaves thunk and before whenever
+		// it reenters it.
+		if len(args) != 3 {
+			panic("dynamic-wind expects 3 functions")
+		}
+		m.pushRestore(m.in.winds)
+		m.in.enterWind(func() { m.in.applyFunction(args[0], nil) }, func() { m.in.applyFunction(args[2], nil) })
+		m.apply(args[1], nil)
+		return
+	case "YIELD":
+		// (yield [value]) suspends the generator, returning the value
+		// sent by the next call to next.
+		if len(args) > 1 {
+			panic("yield expects an optional value")
+		}
+		m.yield(append(args, nil)[0])
+		return
+	}
+	def, defined := m.in.globals[name]
+	switch def.(type) {
+	case *closure, *continuation, *compiledFunction, *builtin:
+		m.apply(def, args)
+		return
+	}
+	if b := builtins[up]; b != nil {
+		m.callBuiltin(b, args)
+		return
+	}
+	if f, ok := def.(*structFunction); ok {
+		m.ret(m.in.applyStructFunction(f, args))
+		return
+	}
+	if !defined {
+		panic("Unknown function: " + name)
+	}
+	panic("Invalid function definition for: " + name)
+}
+
+// accepts checks if the machine can resume a continuation itself: one
+// captured in its own run, or, at top level, one captured in an earlier
+// top-level run, whose remaining frames then finish this run instead.
+func (m *machine) accepts(c *continuation) bool {
+	return c.run == m.run || (c.run != nil && c.run.done && c.run.toplevel && m.run.toplevel)
+}
+
+// throw passes vals to a continuation, jumping out of nested runs if needed.
+func (m *machine) throw(c *continuation, vals []interface{}) {
+	switch {
+	case c.escape && !c.live:
+		panic("call/ec: the continuation was invoked after its extent ended")
+	case !c.escape && m.accepts(c):
+		m.resumeAt(c, vals)
+		return
+	case !c.escape && c.run.done && !c.run.toplevel:
+		panic("call/cc: the continuation was captured inside a builtin that has returned")
+	}
+	panic(&continuationJump{c: c, vals: vals})
+}
+
+// resumeAt makes the machine continue with c, returning vals to it.
+func (m *machine) resumeAt(c *continuation, vals []interface{}) {
+	m.in.rewind(c.winds)
+	m.k = c.k
+	m.ret(values(vals...))
+}
+
+// callWithEscapeContinuation calls fn with an escape continuation, which
+// returns its arguments as the values of the call when invoked.
+func (in *Interpreter) callWithEscapeContinuation(fn interface{}) (result interface{}) {
+	c := &continuation{escape: true, live: true}
+	defer func() {
+		c.live = false
+		if x := recover(); x != nil {
+			if j, ok := x.(*continuationJump); ok && j.c == c {
+				result = values(j.vals...)
+				return
+			}
+			panic(x)
+		}
+	}()
+	return in.applyFunctionValues(fn, []interface{}{c})
+}
+
+// A wind is an entry of the dynamic-wind stack: after runs when control
+// leaves its extent, by returning, escaping or failing, and before runs
+// when a continuation reenters it.
+type wind struct {
+	before, after func()
+	next          *wind
+	depth         int
+}
+
+// enterWind calls before, if any, and pushes a wind.
+func (in *Interpreter) enterWind(before, after func()) {
+	if before != nil {
+		before()
+	}
+	depth := 0
+	if in.winds != nil {
+		depth = in.winds.depth + 1
+	}
+	in.winds = &wind{before: before, after: after, next: in.winds, depth: depth}
+}
+
+// bindSpecial binds a special variable dynamically with a wind that restores
+// the previous value when its extent is left and rebinds it on reentry.
+func (in *Interpreter) bindSpecial(name string, value interface{}) {
+	var restore func()
+	in.enterWind(func() { restore = in.bindDynamic(name, value) }, func() {
+		value = in.globals[name]
+		restore()
+	})
+}
+
+// rewind moves the dynamic-wind stack to target, running the after
+// functions of the winds left, innermost first, then the before functions of
+// the winds entered, outermost first.
+func (in *Interpreter) rewind(target *wind) {
+	common := commonWind(in.winds, target)
+	for in.winds != common {
+		w := in.winds
+		in.winds = w.next
+		if w.after != nil {
+			w.after()
+		}
+	}
+	var entered []*wind
+	for w := target; w != common; w = w.next {
+		entered = append(entered, w)
+	}
+	for i := len(entered) - 1; i >= 0; i-- {
+		if entered[i].before != nil {
+			entered[i].before()
+		}
+		in.winds = entered[i]
+	}
+}
+
+// commonWind returns the innermost wind shared by two wind stacks.
+func commonWind(a, b *wind) *wind {
+	for a != b {
+		switch {
+		case a == nil:
+			b = b.next
+		case b == nil, a.depth > b.depth:
+			a = a.next
+		case b.depth > a.depth:
+			b = b.next
+		default:
+			a, b = a.next, b.next
+		}
+	}
+	return a
+}
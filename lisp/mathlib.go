@@ -0,0 +1,139 @@
+package lisp
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+)
+
+// The irrational functions below return exact results where they can (the
+// square root of a perfect square, the magnitude of #c(3 4)) and otherwise
+// floats. Arguments outside a function's real domain, such as the square root
+// or logarithm of a negative number, give complex results instead of NaN.
+
+// exactSqrt returns the exact square root of a non-negative rational if its
+// numerator and denominator are both perfect squares.
+func exactSqrt(x interface{}) (interface{}, bool) {
+	r := toRat(x)
+	num := new(big.Int).Sqrt(r.Num())
+	den := new(big.Int).Sqrt(r.Denom())
+	if new(big.Int).Mul(num, num).Cmp(r.Num()) != 0 || new(big.Int).Mul(den, den).Cmp(r.Denom()) != 0 {
+		return nil, false
+	}
+	return normalizeRat(new(big.Rat).SetFrac(num, den)), true
+}
+
+// numSqrt returns the principal square root of a number.
+func numSqrt(x interface{}) interface{} {
+	if numberRank(x) == rankComplex {
+		return fromComplex128(cmplx.Sqrt(toComplex128(x)))
+	}
+	if numSign(x) < 0 {
+		root := numSqrt(numNeg(x))
+		if numberRank(root) == rankFloat {
+			return &complexNum{0.0, root}
+		}
+		return makeComplex(0, root)
+	}
+	if isRational(x) {
+		if root, ok := exactSqrt(x); ok {
+			return root
+		}
+	}
+	return math.Sqrt(toFloat(x))
+}
+
+// numExp returns e raised to the power x.
+func numExp(x interface{}) interface{} {
+	if numberRank(x) == rankComplex {
+		return fromComplex128(cmplx.Exp(toComplex128(x)))
+	}
+	return math.Exp(toFloat(x))
+}
+
+// numLog returns the natural logarithm of a non-zero number.
+func numLog(x interface{}) interface{} {
+	if numZerop(x) {
+		panic("log of zero")
+	}
+	if numberRank(x) == rankComplex || numSign(x) < 0 {
+		return fromComplex128(cmplx.Log(toComplex128(x)))
+	}
+	return math.Log(toFloat(x))
+}
+
+// numTrig applies the trigonometric function named by fn (SIN, COS, TAN, ASIN
+// or ACOS) to x.
+func numTrig(fn string, x interface{}) interface{} {
+	inDomain := numberRank(x) != rankComplex
+	if fn == "ASIN" || fn == "ACOS" {
+		inDomain = inDomain && math.Abs(toFloat(x)) <= 1
+	}
+	if inDomain {
+		f := toFloat(x)
+		switch fn {
+		case "SIN":
+			return math.Sin(f)
+		case "COS":
+			return math.Cos(f)
+		case "TAN":
+			return math.Tan(f)
+		case "ASIN":
+			return math.Asin(f)
+		}
+		return math.Acos(f)
+	}
+	c := toComplex128(x)
+	switch fn {
+	case "SIN":
+		return fromComplex128(cmplx.Sin(c))
+	case "COS":
+		return fromComplex128(cmplx.Cos(c))
+	case "TAN":
+		return fromComplex128(cmplx.Tan(c))
+	case "ASIN":
+		return fromComplex128(cmplx.Asin(c))
+	}
+	return fromComplex128(cmplx.Acos(c))
+}
+
+// numAtan returns the arc tangent of y, or of y/x using the signs of both
+// arguments to choose the quadrant when x is given.
+func numAtan(y interface{}, x interface{}) interface{} {
+	if x != nil {
+		return math.Atan2(toFloat(y), toFloat(x))
+	}
+	if numberRank(y) == rankComplex {
+		return fromComplex128(cmplx.Atan(toComplex128(y)))
+	}
+	return math.Atan(toFloat(y))
+}
+
+// numAbs returns the absolute value of a real, or the magnitude of a complex.
+func numAbs(x interface{}) interface{} {
+	if c, ok := x.(*complexNum); ok {
+		if isRational(c.re) {
+			return numSqrt(numAdd(numMul(c.re, c.re), numMul(c.im, c.im)))
+		}
+		return cmplx.Abs(toComplex128(x))
+	}
+	if numSign(x) < 0 {
+		return numNeg(x)
+	}
+	return x
+}
+
+// numSignum returns -1, 0 or 1 of the same type as a real x, or the complex
+// number with magnitude 1 and the same phase as a complex x.
+func numSignum(x interface{}) interface{} {
+	if numZerop(x) {
+		return x
+	}
+	if numberRank(x) == rankComplex {
+		return numDiv(x, numAbs(x))
+	}
+	if numberRank(x) == rankFloat {
+		return math.Copysign(1, toFloat(x))
+	}
+	return numSign(x)
+}
@@ -0,0 +1,685 @@
+package lisp
+
+import (
+	"math"
+	"math/big"
+	"math/cmplx"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Numbers form a tower of four ranks. Integers are represented as Go ints
+// (fixnums) while they fit in a machine word and as *big.Int (bignums) once an
+// operation overflows. Ratios are exact fractions backed by *big.Rat, floats
+// are float64 and complex numbers (see complex.go) pair two real parts.
+// Arithmetic on mixed arguments converts the lower-ranked argument upward, and
+// exact results are always normalized back down, so a bignum never holds a
+// value that fits in an int and a ratio never has a denominator of 1.
+
+// minFixnum is the smallest value representable as an int.
+const minFixnum = -1 << (strconv.IntSize - 1)
+
+// Ranks of the numeric tower, from the narrowest to the widest type.
+const (
+	rankInteger = iota
+	rankRatio
+	rankFloat
+	rankComplex
+)
+
+// normalizeBig demotes a bignum to an int when its value fits.
+func normalizeBig(b *big.Int) interface{} {
+	if b.IsInt64() {
+		v := b.Int64()
+		if int64(int(v)) == v {
+			return int(v)
+		}
+	}
+	return b
+}
+
+// normalizeRat demotes a ratio to an integer when its denominator is 1.
+func normalizeRat(r *big.Rat) interface{} {
+	if r.IsInt() {
+		return normalizeBig(new(big.Int).Set(r.Num()))
+	}
+	return r
+}
+
+// numberRank returns the rank of x in the numeric tower, or -1 if x is not a number.
+func numberRank(x interface{}) int {
+	switch x.(type) {
+	case int, *big.Int:
+		return rankInteger
+	case *big.Rat:
+		return rankRatio
+	case float64:
+		return rankFloat
+	case *complexNum:
+		return rankComplex
+	}
+	return -1
+}
+
+// isInteger checks if x is a fixnum or a bignum.
+func isInteger(x interface{}) bool {
+	return numberRank(x) == rankInteger
+}
+
+// isRational checks if x is an integer or a ratio.
+func isRational(x interface{}) bool {
+	r := numberRank(x)
+	return r == rankInteger || r == rankRatio
+}
+
+// isReal checks if x is a number other than a complex.
+func isReal(x interface{}) bool {
+	r := numberRank(x)
+	return r >= 0 && r < rankComplex
+}
+
+// isNumber checks if x is any kind of Lisp number.
+func isNumber(x interface{}) bool {
+	return numberRank(x) >= 0
+}
+
+// toBig converts an integer value to a freshly allocated *big.Int.
+func toBig(x interface{}) *big.Int {
+	switch v := x.(type) {
+	case int:
+		return big.NewInt(int64(v))
+	case *big.Int:
+		return new(big.Int).Set(v)
+	}
+	panic("expected an integer")
+}
+
+// toRat converts a rational or float value to a freshly allocated *big.Rat.
+func toRat(x interface{}) *big.Rat {
+	switch v := x.(type) {
+	case int:
+		return new(big.Rat).SetInt64(int64(v))
+	case *big.Int:
+		return new(big.Rat).SetInt(v)
+	case *big.Rat:
+		return new(big.Rat).Set(v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			panic("cannot convert an infinite or NaN float to a rational")
+		}
+		return new(big.Rat).SetFloat64(v)
+	}
+	panic("expected a number")
+}
+
+// toFloat converts any real number to a float64.
+func toFloat(x interface{}) float64 {
+	switch v := x.(type) {
+	case int:
+		return float64(v)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	}
+	panic("expected a number")
+}
+
+// floatToInteger converts an integral float to an integer value.
+func floatToInteger(f float64) interface{} {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		panic("cannot convert an infinite or NaN float to an integer")
+	}
+	if f >= -(1<<62) && f < 1<<62 {
+		return int(f)
+	}
+	b, _ := big.NewFloat(f).Int(nil)
+	return normalizeBig(b)
+}
+
+// integerArg checks that x is an integer, panicking with msg otherwise.
+func integerArg(x interface{}, msg string) interface{} {
+	if !isInteger(x) {
+		panic(msg)
+	}
+	return x
+}
+
+// realArg checks that x is a real number, panicking with msg otherwise.
+func realArg(x interface{}, msg string) interface{} {
+	if !isReal(x) {
+		panic(msg)
+	}
+	return x
+}
+
+// numberArg checks that x is a number, panicking with msg otherwise.
+func numberArg(x interface{}, msg string) interface{} {
+	if !isNumber(x) {
+		panic(msg)
+	}
+	return x
+}
+
+// maxRank returns the rank both arguments must be converted to before combining them.
+func maxRank(x, y interface{}) int {
+	rx, ry := numberRank(x), numberRank(y)
+	if rx > ry {
+		return rx
+	}
+	return ry
+}
+
+// numAdd adds two numbers of any rank.
+func numAdd(x, y interface{}) interface{} {
+	switch maxRank(x, y) {
+	case rankInteger:
+		return intAdd(x, y)
+	case rankRatio:
+		return normalizeRat(new(big.Rat).Add(toRat(x), toRat(y)))
+	case rankComplex:
+		return complexAdd(x, y)
+	}
+	return toFloat(x) + toFloat(y)
+}
+
+// numSub subtracts y from x.
+func numSub(x, y interface{}) interface{} {
+	switch maxRank(x, y) {
+	case rankInteger:
+		return intSub(x, y)
+	case rankRatio:
+		return normalizeRat(new(big.Rat).Sub(toRat(x), toRat(y)))
+	case rankComplex:
+		return complexSub(x, y)
+	}
+	return toFloat(x) - toFloat(y)
+}
+
+// numMul multiplies two numbers of any rank.
+func numMul(x, y interface{}) interface{} {
+	switch maxRank(x, y) {
+	case rankInteger:
+		return intMul(x, y)
+	case rankRatio:
+		return normalizeRat(new(big.Rat).Mul(toRat(x), toRat(y)))
+	case rankComplex:
+		return complexMul(x, y)
+	}
+	return toFloat(x) * toFloat(y)
+}
+
+// numDiv divides x by y. Dividing two rationals gives an exact result.
+func numDiv(x, y interface{}) interface{} {
+	if numZerop(y) {
+		panic("division by zero")
+	}
+	switch maxRank(x, y) {
+	case rankComplex:
+		return complexDiv(x, y)
+	case rankFloat:
+		return toFloat(x) / toFloat(y)
+	}
+	return normalizeRat(new(big.Rat).Quo(toRat(x), toRat(y)))
+}
+
+// numNeg negates a number.
+func numNeg(x interface{}) interface{} {
+	switch v := x.(type) {
+	case *big.Rat:
+		return new(big.Rat).Neg(v)
+	case float64:
+		return -v
+	case *complexNum:
+		return makeComplex(numNeg(v.re), numNeg(v.im))
+	}
+	return intNeg(x)
+}
+
+// numZerop checks if a number of any rank is zero.
+func numZerop(x interface{}) bool {
+	if c, ok := x.(*complexNum); ok {
+		return numSign(c.re) == 0 && numSign(c.im) == 0
+	}
+	return numSign(x) == 0
+}
+
+// numEqual checks if two numbers of any rank have the same value, which is how = compares.
+func numEqual(x, y interface{}) bool {
+	if maxRank(x, y) == rankComplex {
+		return numCmp(realPart(x), realPart(y)) == 0 && numCmp(imagPart(x), imagPart(y)) == 0
+	}
+	return numCmp(x, y) == 0
+}
+
+// numSign returns -1, 0 or 1 according to the sign of a real number.
+func numSign(x interface{}) int {
+	switch v := x.(type) {
+	case *big.Rat:
+		return v.Sign()
+	case float64:
+		switch {
+		case v < 0:
+			return -1
+		case v > 0:
+			return 1
+		}
+		return 0
+	}
+	return intSign(x)
+}
+
+// numCmp compares two real numbers, returning -1, 0 or 1. Mixed comparisons
+// with floats are done exactly by converting the float to a rational.
+func numCmp(x, y interface{}) int {
+	rx, ry := numberRank(x), numberRank(y)
+	switch {
+	case rx == rankInteger && ry == rankInteger:
+		return intCmp(x, y)
+	case rx == rankFloat && ry == rankFloat:
+		a, b := x.(float64), y.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	return toRat(x).Cmp(toRat(y))
+}
+
+// numCompareChain applies the comparison op (=, /=, <, >, <= or >=) to one or
+// more numbers. /= holds when no two arguments are equal; the others hold when
+// the comparison holds for every adjacent pair.
+func numCompareChain(op string, args []interface{}) bool {
+	if len(args) < 1 {
+		panic(op + " expects at least one argument")
+	}
+	for _, a := range args {
+		if op == "=" || op == "/=" {
+			numberArg(a, op+" expects numbers")
+		} else {
+			realArg(a, op+" expects real numbers")
+		}
+	}
+	if op == "/=" {
+		for i := range args {
+			for j := i + 1; j < len(args); j++ {
+				if numEqual(args[i], args[j]) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	for i := 0; i+1 < len(args); i++ {
+		var ok bool
+		switch op {
+		case "=":
+			ok = numEqual(args[i], args[i+1])
+		case "<":
+			ok = numCmp(args[i], args[i+1]) < 0
+		case ">":
+			ok = numCmp(args[i], args[i+1]) > 0
+		case "<=":
+			ok = numCmp(args[i], args[i+1]) <= 0
+		case ">=":
+			ok = numCmp(args[i], args[i+1]) >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// eqlNumbers checks if two numbers have the same type and value, which is how
+// EQ, EQL and EQUAL compare numbers.
+func eqlNumbers(x, y interface{}) bool {
+	if numberRank(x) != numberRank(y) {
+		return false
+	}
+	if c, ok := x.(*complexNum); ok {
+		d := y.(*complexNum)
+		return eqlNumbers(c.re, d.re) && eqlNumbers(c.im, d.im)
+	}
+	return numCmp(x, y) == 0
+}
+
+// roundRat rounds a rational to an integer using mode, which is one of
+// "FLOOR", "CEILING", "TRUNCATE" or "ROUND" (ties go to the even integer).
+func roundRat(r *big.Rat, mode string) *big.Int {
+	num, den := r.Num(), r.Denom()
+	q, m := new(big.Int).DivMod(num, den, new(big.Int)) // floor division since den > 0
+	switch mode {
+	case "CEILING":
+		if m.Sign() != 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	case "TRUNCATE":
+		if m.Sign() != 0 && num.Sign() < 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	case "ROUND":
+		c := new(big.Int).Lsh(m, 1).Cmp(den)
+		if c > 0 || (c == 0 && q.Bit(0) == 1) {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// roundFloat rounds a float to an integral float using the same modes as roundRat.
+func roundFloat(f float64, mode string) float64 {
+	switch mode {
+	case "CEILING":
+		return math.Ceil(f)
+	case "TRUNCATE":
+		return math.Trunc(f)
+	case "ROUND":
+		return math.RoundToEven(f)
+	}
+	return math.Floor(f)
+}
+
+// numRound divides x by y and rounds the quotient to an integer using mode.
+// It returns the quotient and the remainder x - q*y.
+func numRound(x, y interface{}, mode string) (interface{}, interface{}) {
+	if numSign(y) == 0 {
+		panic("division by zero")
+	}
+	switch maxRank(x, y) {
+	case rankInteger:
+		if mode == "FLOOR" {
+			return intFloor(x, y)
+		}
+		if mode == "TRUNCATE" {
+			return intTruncate(x, y)
+		}
+	case rankFloat:
+		fx, fy := toFloat(x), toFloat(y)
+		q := roundFloat(fx/fy, mode)
+		return floatToInteger(q), fx - q*fy
+	}
+	q := normalizeBig(roundRat(new(big.Rat).Quo(toRat(x), toRat(y)), mode))
+	return q, numSub(x, numMul(q, y))
+}
+
+// intAdd adds two integers, promoting to a bignum on overflow.
+func intAdd(x, y interface{}) interface{} {
+	if a, ok := x.(int); ok {
+		if b, ok := y.(int); ok {
+			s := a + b
+			// Overflow happened if both operands have the same sign and the sum does not.
+			if (a >= 0) == (b >= 0) && (s >= 0) != (a >= 0) {
+				return new(big.Int).Add(toBig(a), toBig(b))
+			}
+			return s
+		}
+	}
+	return normalizeBig(new(big.Int).Add(toBig(x), toBig(y)))
+}
+
+// intNeg negates an integer, promoting to a bignum when negating the smallest fixnum.
+func intNeg(x interface{}) interface{} {
+	if a, ok := x.(int); ok && a != minFixnum {
+		return -a
+	}
+	return normalizeBig(new(big.Int).Neg(toBig(x)))
+}
+
+// intSub subtracts y from x, promoting to a bignum on overflow.
+func intSub(x, y interface{}) interface{} {
+	if a, ok := x.(int); ok {
+		if b, ok := y.(int); ok {
+			d := a - b
+			// Overflow happened if the operands have different signs and the result
+			// does not have the sign of x.
+			if (a >= 0) != (b >= 0) && (d >= 0) != (a >= 0) {
+				return new(big.Int).Sub(toBig(a), toBig(b))
+			}
+			return d
+		}
+	}
+	return normalizeBig(new(big.Int).Sub(toBig(x), toBig(y)))
+}
+
+// intMul multiplies two integers, promoting to a bignum on overflow.
+func intMul(x, y interface{}) interface{} {
+	if a, ok := x.(int); ok {
+		if b, ok := y.(int); ok {
+			if a == 0 || b == 0 {
+				return 0
+			}
+			p := a * b
+			if p/b == a && !(a == -1 && b == minFixnum) && !(b == -1 && a == minFixnum) {
+				return p
+			}
+			return new(big.Int).Mul(toBig(a), toBig(b))
+		}
+	}
+	return normalizeBig(new(big.Int).Mul(toBig(x), toBig(y)))
+}
+
+// intCmp compares two integers, returning -1, 0 or 1.
+func intCmp(x, y interface{}) int {
+	if a, ok := x.(int); ok {
+		if b, ok := y.(int); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	}
+	return toBig(x).Cmp(toBig(y))
+}
+
+// intSign returns -1, 0 or 1 according to the sign of an integer.
+func intSign(x interface{}) int {
+	switch v := x.(type) {
+	case int:
+		switch {
+		case v < 0:
+			return -1
+		case v > 0:
+			return 1
+		}
+		return 0
+	case *big.Int:
+		return v.Sign()
+	}
+	panic("expected an integer")
+}
+
+// intTruncate divides x by y, rounding the quotient toward zero.
+// It returns the quotient and the remainder.
+func intTruncate(x, y interface{}) (interface{}, interface{}) {
+	if intSign(y) == 0 {
+		panic("division by zero")
+	}
+	if a, ok := x.(int); ok {
+		if b, ok := y.(int); ok && !(a == minFixnum && b == -1) {
+			return a / b, a % b
+		}
+	}
+	q, r := new(big.Int).QuoRem(toBig(x), toBig(y), new(big.Int))
+	return normalizeBig(q), normalizeBig(r)
+}
+
+// intFloor divides x by y, rounding the quotient toward negative infinity.
+// It returns the quotient and the remainder, which has the sign of y.
+func intFloor(x, y interface{}) (interface{}, interface{}) {
+	q, r := intTruncate(x, y)
+	if intSign(r) != 0 && intSign(r) != intSign(y) {
+		q = intSub(q, 1)
+		r = intAdd(r, y)
+	}
+	return q, r
+}
+
+// numExpt raises base to power. Integer powers of exact numbers give exact
+// results; other powers are computed in floating point, and a negative or
+// complex base with a non-integer power gives the principal complex value.
+func numExpt(base, power interface{}) interface{} {
+	if isInteger(power) {
+		if intSign(power) < 0 {
+			return numDiv(1, numExpt(base, intNeg(power)))
+		}
+		switch b := base.(type) {
+		case int, *big.Int:
+			return normalizeBig(new(big.Int).Exp(toBig(b), toBig(power), nil))
+		case *big.Rat:
+			num := new(big.Int).Exp(b.Num(), toBig(power), nil)
+			den := new(big.Int).Exp(b.Denom(), toBig(power), nil)
+			return normalizeRat(new(big.Rat).SetFrac(num, den))
+		case float64:
+			return math.Pow(b, toFloat(power))
+		}
+		// Exponentiation by squaring keeps exact complex results exact.
+		var result interface{} = 1
+		for p := toBig(power); p.Sign() > 0; p.Rsh(p, 1) {
+			if p.Bit(0) == 1 {
+				result = numMul(result, base)
+			}
+			base = numMul(base, base)
+		}
+		return result
+	}
+	if numZerop(base) && numberRank(power) != rankComplex && numSign(power) > 0 {
+		return 0.0
+	}
+	if numberRank(base) == rankComplex || numberRank(power) == rankComplex || numSign(base) < 0 {
+		return fromComplex128(cmplx.Pow(toComplex128(base), toComplex128(power)))
+	}
+	return math.Pow(toFloat(base), toFloat(power))
+}
+
+// intGcd returns the greatest common divisor of two integers, which is never negative.
+func intGcd(x, y interface{}) interface{} {
+	a := toBig(x)
+	b := toBig(y)
+	return normalizeBig(new(big.Int).GCD(nil, nil, a.Abs(a), b.Abs(b)))
+}
+
+// intLcm returns the least common multiple of two integers, which is never negative.
+func intLcm(x, y interface{}) interface{} {
+	if intSign(x) == 0 || intSign(y) == 0 {
+		return 0
+	}
+	q, _ := intTruncate(intMul(x, y), intGcd(x, y))
+	if intSign(q) < 0 {
+		return intNeg(q)
+	}
+	return q
+}
+
+// intIsqrt returns the greatest integer whose square is less than or equal to x.
+func intIsqrt(x interface{}) interface{} {
+	if intSign(x) < 0 {
+		panic("isqrt expects a non-negative integer")
+	}
+	return normalizeBig(new(big.Int).Sqrt(toBig(x)))
+}
+
+// numerator returns the numerator of a rational in lowest terms.
+func numerator(x interface{}) interface{} {
+	if r, ok := x.(*big.Rat); ok {
+		return normalizeBig(new(big.Int).Set(r.Num()))
+	}
+	return x
+}
+
+// denominator returns the positive denominator of a rational in lowest terms.
+func denominator(x interface{}) interface{} {
+	if r, ok := x.(*big.Rat); ok {
+		return normalizeBig(new(big.Int).Set(r.Denom()))
+	}
+	return 1
+}
+
+// rationalizeFloat returns the simplest rational that converts back to f.
+// It walks the continued fraction expansion of f and stops at the first
+// convergent that rounds to the same float.
+func rationalizeFloat(f float64) interface{} {
+	exact := toRat(f)
+	if exact.IsInt() {
+		return normalizeRat(exact)
+	}
+	neg := exact.Sign() < 0
+	exact.Abs(exact)
+	num := new(big.Int).Set(exact.Num())
+	den := new(big.Int).Set(exact.Denom())
+	h0, h1 := big.NewInt(0), big.NewInt(1)
+	k0, k1 := big.NewInt(1), big.NewInt(0)
+	for {
+		a, rem := new(big.Int).DivMod(num, den, new(big.Int))
+		h2 := new(big.Int).Add(new(big.Int).Mul(a, h1), h0)
+		k2 := new(big.Int).Add(new(big.Int).Mul(a, k1), k0)
+		candidate := new(big.Rat).SetFrac(h2, k2)
+		if v, _ := candidate.Float64(); v == math.Abs(f) || rem.Sign() == 0 {
+			if neg {
+				candidate.Neg(candidate)
+			}
+			return normalizeRat(candidate)
+		}
+		num, den = den, rem
+		h0, h1 = h1, h2
+		k0, k1 = k1, k2
+	}
+}
+
+// formatFloat prints a float so that it always reads back as a float,
+// using exponent notation for very large and very small magnitudes.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return s
+	}
+	mantissa, exponent, hasExp := strings.Cut(s, "e")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	if !hasExp {
+		return mantissa
+	}
+	exp, _ := strconv.Atoi(exponent)
+	return mantissa + "e" + strconv.Itoa(exp)
+}
+
+var (
+	integerSyntax = regexp.MustCompile(`^[+-]?[0-9]+\.?$`)
+	ratioSyntax   = regexp.MustCompile(`^[+-]?[0-9]+/[0-9]+$`)
+	floatSyntax   = regexp.MustCompile(`^[+-]?([0-9]*\.[0-9]+|[0-9]+(\.[0-9]*)?[eEdD][+-]?[0-9]+|[0-9]*\.[0-9]+[eEdD][+-]?[0-9]+)$`)
+)
+
+// parseNumber parses a numeric literal: an integer (read as a bignum when it
+// does not fit in an int), a ratio such as 1/3, or a float such as 1.5 or 2e10.
+func parseNumber(s string) (interface{}, bool) {
+	switch {
+	case integerSyntax.MatchString(s):
+		b, _ := new(big.Int).SetString(strings.TrimSuffix(s, "."), 10)
+		return normalizeBig(b), true
+	case ratioSyntax.MatchString(s):
+		r, _ := new(big.Rat).SetString(s)
+		if r == nil {
+			panic("division by zero")
+		}
+		return normalizeRat(r), true
+	case floatSyntax.MatchString(s):
+		f, err := strconv.ParseFloat(strings.NewReplacer("d", "e", "D", "e").Replace(s), 64)
+		if err != nil {
+			return nil, false
+		}
+		return f, true
+	}
+	return nil, false
+}
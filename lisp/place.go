@@ -0,0 +1,463 @@
+package lisp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A place is a location that setf and the modify macros (incf, push, rotatef
+// and so on) can read and write. Resolving a place form evaluates its
+// subforms exactly once, so (incf (aref v (next-index))) calls next-index once.
+type place struct {
+	get func() interface{}
+	set func(value interface{}) interface{}
+}
+
+// A placeCode is an analyzed place form: a variable, (car x), (cdr x),
+// (nth n x), (aref array subscripts...), (gethash key table),
+// (get symbol indicator), (symbol-value symbol), a structure slot accessor
+// or a user place defined with defsetf or define-setf-expander. Resolving
+// it evaluates args, the analyzed argument forms, and passes their values to
+// resolve. Setf expanders and structure accessors are looked up when the
+// place is resolved, as they may be defined after the code that uses them.
+type placeCode struct {
+	form     interface{}
+	head     string
+	argForms []interface{}
+	args     []*analysis
+	scope    *scope
+	resolve  func(in *Interpreter, env *environment, args []interface{}) *place
+}
+
+// A setfExpander defines how to store into places whose head is a user
+// function, as registered by defsetf or define-setf-expander.
+type setfExpander struct {
+	// Short form of defsetf: (setf (access args...) v) calls (update args... v).
+	update interface{}
+	// Long form of defsetf: storer is called with a temporary variable for
+	// each argument and a store variable, and returns a form that stores
+	// the value of the store variable.
+	storer *closure
+	// define-setf-expander: expander is called with the unevaluated
+	// argument forms and returns the values temps, vals, stores, writer
+	// and reader.
+	expander *closure
+}
+
+// analyzePlace analyzes a place form.
+func (sc *scope) analyzePlace(form interface{}) *placeCode {
+	if sym, ok := form.(string); ok {
+		get, set := sc.variable(sym)
+		return &placeCode{form: form, scope: sc, resolve: func(in *Interpreter, env *environment, _ []interface{}) *place {
+			return &place{
+				get: func() interface{} { return get(in, env) },
+				set: func(v interface{}) interface{} { return set(in, env, v) },
+			}
+		}}
+	}
+	p, ok := listElements(form)
+	if !ok || len(p) == 0 {
+		panic("setf: invalid place " + toLispString(form))
+	}
+	head, ok := p[0].(string)
+	if !ok {
+		panic("setf: invalid place " + toLispString(form))
+	}
+	pc := &placeCode{form: form, head: head, argForms: p[1:], args: sc.analyzeAll(p[1:]), scope: sc}
+	switch strings.ToUpper(head) {
+	case "CAR", "FIRST":
+		if len(p) != 2 {
+			panic("setf: car place expects 1 argument")
+		}
+		pc.resolve = func(_ *Interpreter, _ *environment, args []interface{}) *place {
+			return &place{
+				get: func() interface{} { return lispCar(args[0]) },
+				set: func(v interface{}) interface{} { return setCar(args[0], v) },
+			}
+		}
+	case "CDR", "REST":
+		if len(p) != 2 {
+			panic("setf: cdr place expects 1 argument")
+		}
+		pc.resolve = func(_ *Interpreter, _ *environment, args []interface{}) *place {
+			return &place{
+				get: func() interface{} { return lispCdr(args[0]) },
+				set: func(v interface{}) interface{} { return setCdr(args[0], v) },
+			}
+		}
+	case "NTH":
+		if len(p) != 3 {
+			panic("setf: nth place expects 2 arguments")
+		}
+		pc.resolve = func(_ *Interpreter, _ *environment, args []interface{}) *place {
+			return &place{
+				get: func() interface{} { return nthElement(args[0], args[1]) },
+				set: func(v interface{}) interface{} { return setNth(args[0], args[1], v) },
+			}
+		}
+	case "AREF":
+		if len(p) < 2 {
+			panic("setf: aref place expects an array")
+		}
+		pc.resolve = func(_ *Interpreter, _ *environment, args []interface{}) *place {
+			return &place{
+				get: func() interface{} { return aref(args[0], args[1:]) },
+				set: func(v interface{}) interface{} { return setAref(args[0], args[1:], v) },
+			}
+		}
+	case "GETHASH":
+		if len(p) != 3 && len(p) != 4 {
+			panic("setf: gethash place expects a key, a hash table and an optional default")
+		}
+		pc.resolve = func(_ *Interpreter, _ *environment, args []interface{}) *place {
+			table := hashTableArg(args[1], "gethash expects a hash table")
+			return &place{
+				get: func() interface{} {
+					if v, found := table.get(args[0]); found || len(args) < 3 {
+						return v
+					}
+					return args[2]
+				},
+				set: func(v interface{}) interface{} {
+					table.put(args[0], v)
+					return v
+				},
+			}
+		}
+	case "GET":
+		if len(p) != 3 && len(p) != 4 {
+			panic("setf: get place expects a symbol, an indicator and an optional default")
+		}
+		pc.resolve = func(in *Interpreter, _ *environment, args []interface{}) *place {
+			sym := symbolArg(args[0], "get expects a symbol")
+			return &place{
+				get: func() interface{} {
+					if v, found := in.getProperty(sym, args[1]); found || len(args) < 3 {
+						return v
+					}
+					return args[2]
+				},
+				set: func(v interface{}) interface{} { return in.putProperty(sym, args[1], v) },
+			}
+		}
+	case "SYMBOL-VALUE":
+		if len(p) != 2 {
+			panic("setf: symbol-value place expects 1 argument")
+		}
+		pc.resolve = func(in *Interpreter, _ *environment, args []interface{}) *place {
+			sym := symbolArg(args[0], "symbol-value expects a symbol")
+			return &place{
+				get: func() interface{} { return in.symbolValue(sym) },
+				set: func(v interface{}) interface{} { return in.setGlobal(sym, v) },
+			}
+		}
+	default:
+		pc.resolve = func(in *Interpreter, _ *environment, args []interface{}) *place {
+			f, ok := in.globals[head].(*structFunction)
+			if !ok || f.kind != structAccessor {
+				panic("setf: invalid place " + toLispString(form))
+			}
+			if len(args) != 1 {
+				panic("setf: " + head + " place expects 1 argument")
+			}
+			return &place{
+				get: func() interface{} { return in.applyStructFunction(f, args) },
+				set: func(v interface{}) interface{} { return setStructSlot(f, args[0], v) },
+			}
+		}
+	}
+	return pc
+}
+
+// resolvePlace resolves an analyzed place in env and passes it to then.
+func (m *machine) resolvePlace(pc *placeCode, env *environment, then func(m *machine, p *place)) {
+	var exp *setfExpander
+	if pc.head != "" {
+		exp = m.in.expanders[strings.ToUpper(pc.head)]
+	}
+	if exp != nil && exp.update == nil {
+		then(m, m.in.expandUserPlace(pc, exp, env))
+		return
+	}
+	m.evalArgs(pc.args, env, false, func(m *machine, args []interface{}) {
+		if exp != nil {
+			then(m, m.in.userPlace(pc.head, exp, args))
+			return
+		}
+		then(m, pc.resolve(m.in, env, args))
+	})
+}
+
+// resolvePlaces resolves analyzed places in order after the places already
+// in done, then calls then with all of them.
+func (m *machine) resolvePlaces(pcs []*placeCode, env *environment, done []*place, then func(m *machine, places []*place)) {
+	if len(done) == len(pcs) {
+		then(m, done)
+		return
+	}
+	n := len(done)
+	m.resolvePlace(pcs[n], env, func(m *machine, p *place) {
+		m.resolvePlaces(pcs, env, append(done[:n:n], p), then)
+	})
+}
+
+// userPlace returns the place of a call to head, whose setf expander is
+// from the short form of defsetf, with evaluated arguments.
+func (in *Interpreter) userPlace(head string, exp *setfExpander, args []interface{}) *place {
+	return &place{
+		get: func() interface{} { return in.applyFunction(head, args) },
+		set: func(v interface{}) interface{} {
+			in.applyFunction(exp.update, append(append([]interface{}(nil), args...), v))
+			return v
+		},
+	}
+}
+
+// setfExpansion returns the setf expansion of a place whose expander is from
+// define-setf-expander or the long form of defsetf: temporary variables,
+// the forms whose values they are bound to, the store variable, a form
+// that stores the store variable's value in the place and one that reads
+// the place. The long form of defsetf binds a temporary #:ARGn to each
+// argument and calls its storer with them and #:STORE.
+func (in *Interpreter) setfExpansion(pc *placeCode, exp *setfExpander) (temps, vals, stores []interface{}, writer, reader interface{}) {
+	if exp.storer != nil {
+		temps = make([]interface{}, len(pc.argForms))
+		for i := range temps {
+			temps[i] = "#:ARG" + strconv.Itoa(i+1)
+		}
+		store := "#:STORE"
+		writer = in.applyFunction(exp.storer, append(append([]interface{}(nil), temps...), store))
+		return temps, pc.argForms, []interface{}{store}, writer, consValue(pc.head, makeList(temps...))
+	}
+	expansion := valuesOf(in.applyFunctionValues(exp.expander, pc.argForms))
+	if len(expansion) != 5 {
+		panic("setf: the expander for " + pc.head + " must return the values temps, vals, stores, writer and reader")
+	}
+	return toList(expansion[0]), toList(expansion[1]), toList(expansion[2]), expansion[3], expansion[4]
+}
+
+// expandUserPlace resolves a place using its setf expansion (see
+// setfExpansion): each temp is bound to the value of the matching val form,
+// and the reader and writer are evaluated with those bindings, the writer
+// also having the store variable bound to the new value. The expansion is
+// only known once the expander has run, so it is analyzed each time the
+// place is resolved.
+func (in *Interpreter) expandUserPlace(pc *placeCode, exp *setfExpander, env *environment) *place {
+	temps, vals, stores, writerForm, readerForm := in.setfExpansion(pc, exp)
+	if len(temps) != len(vals) || len(stores) != 1 {
+		panic("setf: the expander for " + pc.head + " returned mismatched temps, vals or stores")
+	}
+	names := make([]string, len(temps)+1)
+	for i, t := range temps {
+		names[i] = symbolArg(t, "setf: expander temps must be symbols")
+	}
+	store := len(temps)
+	names[store] = symbolArg(stores[0], "setf: expander stores must be symbols")
+	// The temps and the store share a frame. The temps are bound in
+	// sequence, like let*, each val form seeing only the temps before it.
+	local := &environment{values: make([]interface{}, len(names)), parent: env}
+	for i := range temps {
+		local.values[i] = in.evalCode(pc.scope.child(names[:i]).analyze(vals[i]), local)
+	}
+	inner := pc.scope.child(names)
+	writer, reader := inner.analyze(writerForm), inner.analyze(readerForm)
+	return &place{
+		get: func() interface{} { return in.evalCode(reader, local) },
+		set: func(v interface{}) interface{} {
+			local.values[store] = v
+			in.evalCode(writer, local)
+			return v
+		},
+	}
+}
+
+// analyzeSetf analyzes a setf form, which stores each value in the place
+// before it and returns the last value stored.
+func (sc *scope) analyzeSetf(args []interface{}) *analysis {
+	if len(args)%2 != 0 {
+		panic("setf expects an even number of arguments")
+	}
+	places := make([]*placeCode, len(args)/2)
+	values := make([]*analysis, len(args)/2)
+	for i := range places {
+		places[i], values[i] = sc.analyzePlace(args[2*i]), sc.analyze(args[2*i+1])
+	}
+	var next func(m *machine, env *environment, i int, result interface{})
+	next = func(m *machine, env *environment, i int, result interface{}) {
+		if i == len(places) {
+			m.ret(result)
+			return
+		}
+		m.resolvePlace(places[i], env, func(m *machine, p *place) {
+			m.push(func(m *machine, v interface{}) { next(m, env, i+1, p.set(primary(v))) })
+			m.exec(values[i], env)
+		})
+	}
+	return &analysis{exec: func(m *machine, env *environment) { next(m, env, 0, nil) }}
+}
+
+// analyzeDefsetf analyzes a defsetf form in its short form
+// (defsetf access update) or its long form
+// (defsetf access (params...) (store) body...), whose body returns a form
+// that stores the value of store in the place.
+func (sc *scope) analyzeDefsetf(args []interface{}) *analysis {
+	if len(args) < 2 {
+		panic("defsetf: must have (defsetf access update) or (defsetf access (args...) (store) body...)")
+	}
+	access := symbolArg(args[0], "defsetf: access function must be a symbol")
+	key := strings.ToUpper(access)
+	if update, ok := args[1].(string); ok && len(args) == 2 {
+		return directAnalysis(func(m *machine, _ *environment) interface{} {
+			m.in.expanders[key] = &setfExpander{update: update}
+			return access
+		})
+	}
+	params, ok := listElements(args[1])
+	if !ok {
+		panic("defsetf: second argument must be an update function or a list of parameters")
+	}
+	if len(args) < 3 {
+		panic("defsetf: long form expects exactly one store variable")
+	}
+	stores, ok := listElements(args[2])
+	if !ok || len(stores) != 1 {
+		panic("defsetf: long form expects exactly one store variable")
+	}
+	store := symbolArg(stores[0], "defsetf: store variable must be a symbol")
+	makeFn := sc.analyzeFunction(append(params[:len(params):len(params)], store), args[3:])
+	return directAnalysis(func(m *machine, env *environment) interface{} {
+		m.in.expanders[key] = &setfExpander{storer: makeFn(env)}
+		return access
+	})
+}
+
+// analyzeDefineSetfExpander analyzes a
+// (define-setf-expander access (params...) body...) form, whose body returns
+// the values temps, vals, stores, writer and reader.
+func (sc *scope) analyzeDefineSetfExpander(args []interface{}) *analysis {
+	if len(args) < 2 {
+		panic("define-setf-expander: must have (define-setf-expander access (args...) body...)")
+	}
+	access := symbolArg(args[0], "define-setf-expander: access function must be a symbol")
+	params, ok := listElements(args[1])
+	if !ok {
+		panic("define-setf-expander: second argument must be a list of parameters")
+	}
+	makeFn := sc.analyzeFunction(params, args[2:])
+	return directAnalysis(func(m *machine, env *environment) interface{} {
+		m.in.expanders[strings.ToUpper(access)] = &setfExpander{expander: makeFn(env)}
+		return access
+	})
+}
+
+// analyzeModify analyzes the modify macros incf, decf, push, pop, pushnew,
+// rotatef and shiftf, named by op in upper case.
+func (sc *scope) analyzeModify(op string, args []interface{}) *analysis {
+	name := strings.ToLower(op)
+	switch op {
+	case "INCF", "DECF":
+		if len(args) < 1 || len(args) > 2 {
+			panic(name + " expects a place and an optional delta")
+		}
+		pc := sc.analyzePlace(args[0])
+		var delta *analysis
+		if len(args) == 2 {
+			delta = sc.analyze(args[1])
+		}
+		update := func(m *machine, p *place, delta interface{}) {
+			old := numberArg(p.get(), name+" expects a place holding a number")
+			if op == "INCF" {
+				m.ret(p.set(numAdd(old, delta)))
+				return
+			}
+			m.ret(p.set(numSub(old, delta)))
+		}
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.resolvePlace(pc, env, func(m *machine, p *place) {
+				if delta == nil {
+					update(m, p, 1)
+					return
+				}
+				m.push(func(m *machine, v interface{}) { update(m, p, numberArg(primary(v), name+" expects a number")) })
+				m.exec(delta, env)
+			})
+		}}
+	case "PUSH", "PUSHNEW":
+		if len(args) < 2 {
+			panic(name + " expects an item and a place")
+		}
+		if op == "PUSH" && len(args) != 2 {
+			panic("push expects an item and a place")
+		}
+		item, pc, keys := sc.analyze(args[0]), sc.analyzePlace(args[1]), sc.analyzeAll(args[2:])
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.push(func(m *machine, v interface{}) {
+				item := primary(v)
+				m.resolvePlace(pc, env, func(m *machine, p *place) {
+					if op == "PUSH" {
+						m.ret(p.set(consValue(item, p.get())))
+						return
+					}
+					m.evalArgs(keys, env, false, func(m *machine, vals []interface{}) {
+						kwargs := keywordArgs(name, vals, "TEST", "TEST-NOT", "KEY")
+						m.ret(p.set(adjoin(item, p.get(), newMatcher(kwargs, m.in))))
+					})
+				})
+			})
+			m.exec(item, env)
+		}}
+	case "POP":
+		if len(args) != 1 {
+			panic("pop expects a place")
+		}
+		pc := sc.analyzePlace(args[0])
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.resolvePlace(pc, env, func(m *machine, p *place) {
+				lst := p.get()
+				p.set(lispCdr(lst))
+				m.ret(lispCar(lst))
+			})
+		}}
+	case "ROTATEF", "SHIFTF":
+		placeForms := args
+		var newValue *analysis
+		if op == "SHIFTF" {
+			if len(args) < 2 {
+				panic("shiftf expects at least one place and a new value")
+			}
+			placeForms = args[:len(args)-1]
+			newValue = sc.analyze(args[len(args)-1])
+		}
+		pcs := make([]*placeCode, len(placeForms))
+		for i, f := range placeForms {
+			pcs[i] = sc.analyzePlace(f)
+		}
+		return &analysis{exec: func(m *machine, env *environment) {
+			m.resolvePlaces(pcs, env, nil, func(m *machine, places []*place) {
+				values := make([]interface{}, len(places))
+				for i, p := range places {
+					values[i] = p.get()
+				}
+				if op == "ROTATEF" {
+					for i, p := range places {
+						p.set(values[(i+1)%len(values)])
+					}
+					m.ret(nil)
+					return
+				}
+				m.push(func(m *machine, v interface{}) {
+					for i, p := range places {
+						if i+1 < len(places) {
+							p.set(values[i+1])
+						} else {
+							p.set(primary(v))
+						}
+					}
+					m.ret(values[0])
+				})
+				m.exec(newValue, env)
+			})
+		}}
+	}
+	panic("unknown modify macro " + name)
+}
@@ -0,0 +1,293 @@
+package lisp
+
+import (
+	"sort"
+	"strings"
+)
+
+// The generic sequence functions work on lists, vectors and strings alike by
+// reading a sequence's elements into a slice with sequenceElements and, where
+// they return a new sequence, building one of the same kind with
+// makeSequenceLike. Functions that modify a sequence in place write back
+// through storeSequenceElements.
+
+// storeSequenceElements overwrites the elements of seq from index start on
+// with elems.
+func storeSequenceElements(seq interface{}, start int, elems []interface{}) {
+	switch v := seq.(type) {
+	case *lispString:
+		for i, e := range elems {
+			v.runes[start+i] = rune(charArg(e, "a string can only hold characters"))
+		}
+	case *lispArray:
+		copy(v.data[start:], elems)
+	default:
+		c := nthCons(start, seq)
+		for _, e := range elems {
+			c.car = e
+			c, _ = c.cdr.(*cons)
+		}
+	}
+}
+
+// predicateMatcher returns a matcher whose test calls pred on each element
+// after applying the key, negated for the -if-not variants.
+func predicateMatcher(pred interface{}, not bool, kwargs map[string]interface{}, in *Interpreter) func(interface{}) bool {
+	m := &matcher{key: kwargs["KEY"], in: in}
+	return func(elem interface{}) bool {
+		return isNil(in.applyFunction(pred, []interface{}{m.keyOf(elem)})) == not
+	}
+}
+
+// itemMatcher returns a function checking if an element matches item under
+// the :test, :test-not and :key keyword arguments.
+func itemMatcher(item interface{}, kwargs map[string]interface{}, in *Interpreter) func(interface{}) bool {
+	m := newMatcher(kwargs, in)
+	return func(elem interface{}) bool { return m.matches(item, elem) }
+}
+
+// seqMatcher returns the element test of a sequence function called name:
+// for the -IF and -IF-NOT variants the first argument is a predicate,
+// otherwise it is an item compared under :test, :test-not and :key.
+func seqMatcher(name string, first interface{}, kwargs map[string]interface{}, in *Interpreter) func(interface{}) bool {
+	switch {
+	case strings.HasSuffix(name, "-IF"):
+		return predicateMatcher(first, false, kwargs, in)
+	case strings.HasSuffix(name, "-IF-NOT"):
+		return predicateMatcher(first, true, kwargs, in)
+	}
+	return itemMatcher(first, kwargs, in)
+}
+
+// seqKeywords returns the keywords accepted by a sequence function called
+// name, in addition to START, END, KEY and FROM-END.
+func seqKeywords(name string, extra ...string) []string {
+	allowed := append([]string{"START", "END", "KEY", "FROM-END"}, extra...)
+	if !strings.HasSuffix(name, "-IF") && !strings.HasSuffix(name, "-IF-NOT") {
+		allowed = append(allowed, "TEST", "TEST-NOT")
+	}
+	return allowed
+}
+
+// findPosition returns the index of the first element of elems between the
+// :start and :end bounds that satisfies match, or the last with :from-end,
+// and -1 when there is none.
+func findPosition(name string, elems []interface{}, match func(interface{}) bool, kwargs map[string]interface{}) int {
+	s, e := sequenceBounds(strings.ToLower(name), len(elems), kwargs["START"], kwargs["END"])
+	if !isNil(kwargs["FROM-END"]) {
+		for i := e - 1; i >= s; i-- {
+			if match(elems[i]) {
+				return i
+			}
+		}
+		return -1
+	}
+	for i := s; i < e; i++ {
+		if match(elems[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeMatching returns a sequence like seq without the elements between
+// the :start and :end bounds that satisfy match. A :count limits how many
+// are removed, from the end with :from-end.
+func removeMatching(name string, seq interface{}, match func(interface{}) bool, kwargs map[string]interface{}) interface{} {
+	elems := sequenceElements(seq, strings.ToLower(name)+" expects a sequence")
+	s, e := sequenceBounds(strings.ToLower(name), len(elems), kwargs["START"], kwargs["END"])
+	limit := len(elems)
+	if c, ok := kwargs["COUNT"]; ok && !isNil(c) {
+		limit = nthIndex(c)
+	}
+	remove := make([]bool, len(elems))
+	indices := make([]int, 0, e-s)
+	for i := s; i < e; i++ {
+		indices = append(indices, i)
+	}
+	if !isNil(kwargs["FROM-END"]) {
+		for i, j := 0, len(indices)-1; i < j; i, j = i+1, j-1 {
+			indices[i], indices[j] = indices[j], indices[i]
+		}
+	}
+	for _, i := range indices {
+		if limit == 0 {
+			break
+		}
+		if match(elems[i]) {
+			remove[i] = true
+			limit--
+		}
+	}
+	var kept []interface{}
+	for i, x := range elems {
+		if !remove[i] {
+			kept = append(kept, x)
+		}
+	}
+	return makeSequenceLike(seq, kept)
+}
+
+// countMatching returns how many elements between the :start and :end bounds satisfy match.
+func countMatching(name string, seq interface{}, match func(interface{}) bool, kwargs map[string]interface{}) int {
+	elems := sequenceElements(seq, strings.ToLower(name)+" expects a sequence")
+	s, e := sequenceBounds(strings.ToLower(name), len(elems), kwargs["START"], kwargs["END"])
+	n := 0
+	for _, x := range elems[s:e] {
+		if match(x) {
+			n++
+		}
+	}
+	return n
+}
+
+// mapSequences calls fn on successive elements of the sequences, stopping at
+// the end of the shortest, and returns the results.
+func mapSequences(name string, fn interface{}, seqs []interface{}, in *Interpreter) []interface{} {
+	all := make([][]interface{}, len(seqs))
+	n := -1
+	for i, s := range seqs {
+		all[i] = sequenceElements(s, name+" expects sequences")
+		if n < 0 || len(all[i]) < n {
+			n = len(all[i])
+		}
+	}
+	results := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		args := make([]interface{}, len(all))
+		for j := range all {
+			args[j] = all[j][i]
+		}
+		results = append(results, in.applyFunction(fn, args))
+	}
+	return results
+}
+
+// quantify implements some, every, notany and notevery: it calls pred on
+// successive elements of the sequences and stops as soon as the answer is known.
+func quantify(op string, pred interface{}, seqs []interface{}, in *Interpreter) interface{} {
+	all := make([][]interface{}, len(seqs))
+	n := -1
+	for i, s := range seqs {
+		all[i] = sequenceElements(s, strings.ToLower(op)+" expects sequences")
+		if n < 0 || len(all[i]) < n {
+			n = len(all[i])
+		}
+	}
+	for i := 0; i < n; i++ {
+		args := make([]interface{}, len(all))
+		for j := range all {
+			args[j] = all[j][i]
+		}
+		v := in.applyFunction(pred, args)
+		switch {
+		case op == "SOME" && !isNil(v):
+			return v
+		case op == "NOTANY" && !isNil(v), op == "EVERY" && isNil(v):
+			return nil
+		case op == "NOTEVERY" && isNil(v):
+			return "T"
+		}
+	}
+	return boolToT(op == "EVERY" || op == "NOTANY")
+}
+
+// lessFunc returns a comparison that calls pred on the keys of two elements.
+func lessFunc(pred interface{}, key interface{}, in *Interpreter) func(a, b interface{}) bool {
+	m := &matcher{key: key, in: in}
+	return func(a, b interface{}) bool {
+		return !isNil(in.applyFunction(pred, []interface{}{m.keyOf(a), m.keyOf(b)}))
+	}
+}
+
+// sortSequence sorts a sequence in place with pred and returns it. The sort
+// is always stable, so it serves both sort and stable-sort.
+func sortSequence(seq, pred, key interface{}, in *Interpreter) interface{} {
+	elems := sequenceElements(seq, "sort expects a sequence")
+	less := lessFunc(pred, key, in)
+	sort.SliceStable(elems, func(i, j int) bool { return less(elems[i], elems[j]) })
+	storeSequenceElements(seq, 0, elems)
+	return seq
+}
+
+// mergeSequences merges two sequences sorted by pred into a new sequence of
+// resultType. When neither element is less than the other, the element from
+// the first sequence comes first.
+func mergeSequences(resultType, a, b, pred, key interface{}, in *Interpreter) interface{} {
+	x := sequenceElements(a, "merge expects sequences")
+	y := sequenceElements(b, "merge expects sequences")
+	less := lessFunc(pred, key, in)
+	merged := make([]interface{}, 0, len(x)+len(y))
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		if less(y[j], x[i]) {
+			merged = append(merged, y[j])
+			j++
+		} else {
+			merged = append(merged, x[i])
+			i++
+		}
+	}
+	merged = append(append(merged, x[i:]...), y[j:]...)
+	return concatenate(resultType, []interface{}{newVector(merged)})
+}
+
+// removeDuplicates returns a sequence like seq keeping only the last of any
+// elements that match under :test and :key, or the first with :from-end.
+func removeDuplicates(seq interface{}, kwargs map[string]interface{}, in *Interpreter) interface{} {
+	elems := sequenceElements(seq, "remove-duplicates expects a sequence")
+	m := newMatcher(kwargs, in)
+	fromEnd := !isNil(kwargs["FROM-END"])
+	var kept []interface{}
+	for i, x := range elems {
+		var others []interface{}
+		if fromEnd {
+			others = elems[:i]
+		} else {
+			others = elems[i+1:]
+		}
+		duplicate := false
+		for _, o := range others {
+			// The test is called with the earlier element first.
+			a, b := o, x
+			if !fromEnd {
+				a, b = x, o
+			}
+			if m.matches(m.keyOf(a), b) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, x)
+		}
+	}
+	return makeSequenceLike(seq, kept)
+}
+
+// fillSequence stores item in each element of seq between the :start and :end bounds.
+func fillSequence(seq, item interface{}, kwargs map[string]interface{}) interface{} {
+	elems := sequenceElements(seq, "fill expects a sequence")
+	s, e := sequenceBounds("fill", len(elems), kwargs["START"], kwargs["END"])
+	fill := make([]interface{}, e-s)
+	for i := range fill {
+		fill[i] = item
+	}
+	storeSequenceElements(seq, s, fill)
+	return seq
+}
+
+// replaceSequence copies elements of src into dst between the bounds given
+// by :start1, :end1, :start2 and :end2, stopping at the shorter range.
+func replaceSequence(dst, src interface{}, kwargs map[string]interface{}) interface{} {
+	d := sequenceElements(dst, "replace expects sequences")
+	s := sequenceElements(src, "replace expects sequences")
+	s1, e1 := sequenceBounds("replace", len(d), kwargs["START1"], kwargs["END1"])
+	s2, e2 := sequenceBounds("replace", len(s), kwargs["START2"], kwargs["END2"])
+	n := e1 - s1
+	if e2-s2 < n {
+		n = e2 - s2
+	}
+	storeSequenceElements(dst, s1, append([]interface{}(nil), s[s2:s2+n]...))
+	return dst
+}
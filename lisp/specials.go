@@ -0,0 +1,117 @@
+package lisp
+
+import (
+	"strings"
+)
+
+// Special variables are bound dynamically rather than lexically: their value
+// always lives in the interpreter's globals, and let rebinds them by saving the global
+// value and restoring it when the let form is exited, normally or by a panic.
+// Code called from inside the let therefore sees the new value.
+
+// isSpecial checks if a variable has been proclaimed special by defvar,
+// defparameter or defconstant.
+func (in *Interpreter) isSpecial(name string) bool {
+	return in.specials[name]
+}
+
+// isConstant checks if a variable names a constant defined by defconstant.
+func (in *Interpreter) isConstant(name string) bool {
+	return in.constants[name]
+}
+
+// bindDynamic gives a special variable a new global value and returns a
+// function that restores the previous value, or unbinds the variable if it
+// had none.
+func (in *Interpreter) bindDynamic(name string, value interface{}) func() {
+	old, bound := in.globals[name]
+	in.globals[name] = value
+	return func() {
+		if bound {
+			in.globals[name] = old
+		} else {
+			delete(in.globals, name)
+		}
+	}
+}
+
+// bindParameter binds a special parameter of a function dynamically.
+func (in *Interpreter) bindParameter(name string, value interface{}) {
+	if in.isConstant(name) {
+		panic("cannot bind the constant " + name + " as a parameter")
+	}
+	in.bindSpecial(name, value)
+}
+
+// declaredSpecials collects the variables named in (declare (special vars...))
+// forms at the start of a body, returning them and the rest of the body.
+// Other declarations are ignored.
+func declaredSpecials(body []interface{}) (map[string]bool, []interface{}) {
+	declared := make(map[string]bool)
+	for len(body) > 0 {
+		decl, ok := listElements(body[0])
+		if !ok || len(decl) == 0 || !isSymbol(decl[0], "DECLARE") {
+			break
+		}
+		for _, spec := range decl[1:] {
+			parts, ok := listElements(spec)
+			if !ok || len(parts) == 0 || !isSymbol(parts[0], "SPECIAL") {
+				continue
+			}
+			for _, v := range parts[1:] {
+				declared[symbolArg(v, "declare: special expects symbols")] = true
+			}
+		}
+		body = body[1:]
+	}
+	return declared, body
+}
+
+// analyzeDefvar analyzes a defvar, defparameter or defconstant form, named
+// by op in upper case: (op name [value [doc]]). All three proclaim the
+// variable special when they run, so that forms analyzed after that bind
+// the variable dynamically; a form that is only analyzed proclaims nothing.
+// Function bodies and the forms of a toplevel progn are analyzed when they
+// are first reached, so they see the proclamation. defvar only assigns the
+// value if the variable is unbound; defparameter and defconstant always
+// assign it, and a constant cannot be assigned or bound afterwards.
+func (sc *scope) analyzeDefvar(op string, args []interface{}) *analysis {
+	name := strings.ToLower(op)
+	if len(args) < 1 || len(args) > 3 || (op != "DEFVAR" && len(args) < 2) {
+		panic(name + " expects a name, a value and an optional documentation string")
+	}
+	varName := symbolArg(args[0], name+": variable name must be a symbol")
+	var value *analysis
+	if len(args) >= 2 {
+		value = sc.analyze(args[1])
+	}
+	return &analysis{exec: func(m *machine, env *environment) {
+		in := m.in
+		if in.isConstant(varName) {
+			if op != "DEFCONSTANT" {
+				panic(name + ": cannot redefine the constant " + varName)
+			}
+			m.push(func(m *machine, v interface{}) {
+				if !equalp(in.globals[varName], primary(v)) {
+					panic(name + ": cannot redefine the constant " + varName)
+				}
+				m.ret(varName)
+			})
+			m.exec(value, env)
+			return
+		}
+		in.specials[varName] = true
+		if _, bound := in.globals[varName]; value == nil || (op == "DEFVAR" && bound) {
+			m.ret(varName)
+			return
+		}
+		m.push(func(m *machine, v interface{}) {
+			in.globals[varName] = primary(v)
+			if op == "DEFCONSTANT" {
+				in.constants[varName] = true
+			}
+			m.ret(varName)
+		})
+		m.exec(value, env)
+	}}
+}
@@ -0,0 +1,312 @@
+package lisp
+
+import (
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// A lispString is a Lisp string: a mutable sequence of characters. Strings
+// are read from double-quoted literals, in which a backslash escapes the
+// following character. Symbols remain plain Go strings.
+type lispString struct {
+	runes []rune
+}
+
+// newLispString creates a Lisp string holding the characters of s.
+func newLispString(s string) *lispString {
+	return &lispString{runes: []rune(s)}
+}
+
+// String returns the contents of the Lisp string as a Go string.
+func (s *lispString) String() string {
+	return string(s.runes)
+}
+
+// parseStringLiteral converts a double-quoted string token to a Lisp string.
+func parseStringLiteral(token string) *lispString {
+	var b strings.Builder
+	body := token[1 : len(token)-1]
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' && i+1 < len(body) {
+			i++
+		}
+		b.WriteByte(body[i])
+	}
+	return newLispString(b.String())
+}
+
+// formatString prints a Lisp string as a double-quoted literal that reads
+// back as the same string.
+func formatString(s *lispString) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s.runes {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// stringArg checks that x is a string, panicking with msg otherwise.
+func stringArg(x interface{}, msg string) *lispString {
+	s, ok := x.(*lispString)
+	if !ok {
+		panic(msg)
+	}
+	return s
+}
+
+// stringDesignator returns the text designated by x: the contents of a
+// string, the name of a symbol, or a single character. It panics with msg
+// for anything else.
+func stringDesignator(x interface{}, msg string) string {
+	switch v := x.(type) {
+	case *lispString:
+		return v.String()
+	case string:
+		return v
+	case lispChar:
+		return string(rune(v))
+	case nil:
+		return "NIL"
+	}
+	panic(msg)
+}
+
+// sequenceBounds resolves the :start and :end arguments of a sequence
+// function against a sequence of length n. A nil end means the whole sequence.
+func sequenceBounds(name string, n int, start, end interface{}) (int, int) {
+	s, e := 0, n
+	if start != nil {
+		v, ok := start.(int)
+		if !ok {
+			panic(name + ": start must be an integer")
+		}
+		s = v
+	}
+	if end != nil {
+		v, ok := end.(int)
+		if !ok {
+			panic(name + ": end must be an integer")
+		}
+		e = v
+	}
+	if s < 0 || e > n || s > e {
+		panic(name + ": bounds out of range")
+	}
+	return s, e
+}
+
+// subseq returns a fresh copy of the part of a sequence between start and end.
+func subseq(seq interface{}, start, end interface{}) interface{} {
+	switch v := seq.(type) {
+	case *lispArray:
+		if v.isVector() {
+			s, e := sequenceBounds("subseq", v.length(), start, end)
+			return newVector(append([]interface{}(nil), v.data[s:e]...))
+		}
+	case *lispString:
+		s, e := sequenceBounds("subseq", len(v.runes), start, end)
+		return &lispString{runes: append([]rune(nil), v.runes[s:e]...)}
+	case *cons, nil:
+		lst := toList(v)
+		s, e := sequenceBounds("subseq", len(lst), start, end)
+		return makeList(lst[s:e]...)
+	}
+	panic("subseq expects a sequence")
+}
+
+// sequenceElements returns the elements of a string, vector or list as a list.
+func sequenceElements(seq interface{}, msg string) []interface{} {
+	switch v := seq.(type) {
+	case *lispArray:
+		if v.isVector() {
+			return append([]interface{}(nil), v.elements()...)
+		}
+	case *lispString:
+		elems := make([]interface{}, len(v.runes))
+		for i, r := range v.runes {
+			elems[i] = lispChar(r)
+		}
+		return elems
+	case *cons, nil:
+		return toList(v)
+	}
+	panic(msg)
+}
+
+// makeSequenceLike returns a fresh sequence of the same kind as seq (a
+// string, vector or list) holding elems.
+func makeSequenceLike(seq interface{}, elems []interface{}) interface{} {
+	switch seq.(type) {
+	case *lispString:
+		return concatenate("STRING", []interface{}{newVector(elems)})
+	case *lispArray:
+		return newVector(elems)
+	}
+	return makeList(elems...)
+}
+
+// concatenate joins sequences into a new sequence of resultType, which is
+// the symbol STRING, VECTOR or LIST.
+func concatenate(resultType interface{}, seqs []interface{}) interface{} {
+	var elems []interface{}
+	for _, seq := range seqs {
+		elems = append(elems, sequenceElements(seq, "concatenate expects sequences")...)
+	}
+	switch {
+	case isSymbol(resultType, "STRING"):
+		s := &lispString{runes: make([]rune, len(elems))}
+		for i, e := range elems {
+			s.runes[i] = rune(charArg(e, "concatenate: a string can only hold characters"))
+		}
+		return s
+	case isSymbol(resultType, "VECTOR"), isSymbol(resultType, "SIMPLE-VECTOR"):
+		return newVector(elems)
+	case isSymbol(resultType, "LIST"):
+		return makeList(elems...)
+	}
+	panic("concatenate: unsupported result type " + toLispString(resultType))
+}
+
+// stringTrim removes the characters in bag from the left and/or right end of s.
+func stringTrim(bag interface{}, s string, left, right bool) *lispString {
+	var cutset strings.Builder
+	for _, c := range sequenceElements(bag, "string-trim expects a sequence of characters") {
+		cutset.WriteRune(rune(charArg(c, "string-trim expects a sequence of characters")))
+	}
+	if left {
+		s = strings.TrimLeft(s, cutset.String())
+	}
+	if right {
+		s = strings.TrimRight(s, cutset.String())
+	}
+	return newLispString(s)
+}
+
+// stringCompare compares two strings with op (STRING=, STRING/=, STRING<,
+// STRING>, STRING<=, STRING>=, STRING-EQUAL or STRING-LESSP). Equality tests
+// return T or NIL; the others return the index of the first mismatch when the
+// comparison holds and NIL otherwise.
+func stringCompare(op string, a, b string) interface{} {
+	x, y := []rune(a), []rune(b)
+	if op == "STRING-EQUAL" || op == "STRING-LESSP" {
+		x, y = []rune(strings.ToUpper(a)), []rune(strings.ToUpper(b))
+	}
+	i := 0
+	for i < len(x) && i < len(y) && x[i] == y[i] {
+		i++
+	}
+	// cmp is the sign of x compared to y at the first mismatch.
+	cmp := 0
+	switch {
+	case i < len(x) && i < len(y):
+		cmp = 1
+		if x[i] < y[i] {
+			cmp = -1
+		}
+	case i < len(y):
+		cmp = -1
+	case i < len(x):
+		cmp = 1
+	}
+	var holds bool
+	switch op {
+	case "STRING=", "STRING-EQUAL":
+		return boolToT(cmp == 0)
+	case "STRING/=":
+		holds = cmp != 0
+	case "STRING<", "STRING-LESSP":
+		holds = cmp < 0
+	case "STRING>":
+		holds = cmp > 0
+	case "STRING<=":
+		holds = cmp <= 0
+	case "STRING>=":
+		holds = cmp >= 0
+	}
+	if holds {
+		return i
+	}
+	return nil
+}
+
+// searchSequence returns the index of the first occurrence of needle in
+// haystack, comparing elements with eql, or NIL if it does not occur.
+func searchSequence(needle, haystack interface{}) interface{} {
+	n := sequenceElements(needle, "search expects sequences")
+	h := sequenceElements(haystack, "search expects sequences")
+	for i := 0; i+len(n) <= len(h); i++ {
+		match := true
+		for j := range n {
+			if !eqlp(n[j], h[i+j]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return nil
+}
+
+// splitString splits s at each occurrence of sep, or at runs of whitespace
+// when sep is empty, returning a list of strings.
+func splitString(s, sep string) interface{} {
+	var parts []string
+	if sep == "" {
+		parts = strings.Fields(s)
+	} else {
+		parts = strings.Split(s, sep)
+	}
+	result := make([]interface{}, len(parts))
+	for i, p := range parts {
+		result[i] = newLispString(p)
+	}
+	return makeList(result...)
+}
+
+// parseIntegerString parses an optionally signed integer in the given radix
+// from s[start:end], ignoring surrounding whitespace, and returns it with the
+// index where parsing stopped. With junkAllowed, it stops at the first
+// non-digit and returns NIL if there are no digits; otherwise anything but a
+// well-formed integer is an error.
+func parseIntegerString(s string, start, end interface{}, radix int, junkAllowed bool) (interface{}, int) {
+	runes := []rune(s)
+	st, en := sequenceBounds("parse-integer", len(runes), start, end)
+	i := st
+	for i < en && unicode.IsSpace(runes[i]) {
+		i++
+	}
+	sign := ""
+	if i < en && (runes[i] == '+' || runes[i] == '-') {
+		sign = string(runes[i])
+		i++
+	}
+	digitsStart := i
+	for i < en && digitWeight(lispChar(runes[i]), radix) >= 0 {
+		i++
+	}
+	digits := string(runes[digitsStart:i])
+	if junkAllowed {
+		if digits == "" {
+			return nil, i
+		}
+	} else {
+		rest := i
+		for rest < en && unicode.IsSpace(runes[rest]) {
+			rest++
+		}
+		if digits == "" || rest < en {
+			panic("parse-integer: not an integer: " + s)
+		}
+		i = en
+	}
+	b, _ := new(big.Int).SetString(sign+digits, radix)
+	return normalizeBig(b), i
+}
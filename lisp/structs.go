@@ -0,0 +1,477 @@
+package lisp
+
+import (
+	"strings"
+)
+
+// A structType describes a record type defined by defstruct. Its slots
+// include the slots of the type it :includes, which come first, so an
+// instance of a subtype can be used wherever its parent type is expected.
+type structType struct {
+	name   string
+	slots  []structSlot
+	parent *structType
+}
+
+// A structSlot is one named field of a structure type. init is its
+// initform, analyzed when the type is defined.
+type structSlot struct {
+	name     string
+	initform interface{}
+	init     *analysis
+	readOnly bool
+}
+
+// A structInstance is a structure object: a type and one value per slot.
+type structInstance struct {
+	typ    *structType
+	values []interface{}
+}
+
+// The kinds of functions defstruct defines for a structure type.
+const (
+	structConstructor = iota
+	structAccessor
+	structPredicate
+	structCopier
+)
+
+// A structFunction is a function generated by defstruct. It is stored in the
+// global environment under its name, like a user-defined function, and applied by
+// the machine.
+type structFunction struct {
+	name string
+	kind int
+	typ  *structType
+	slot int      // index of the slot, for accessors
+	boa  *boaList // the argument list of a BOA constructor
+}
+
+// A boaList is the argument list of a "by order of arguments" constructor,
+// defined with (:constructor name (args...)). Each of its variables fills
+// the slot of the same name. The lambda list keywords &optional, &rest,
+// &key and &aux are allowed; default forms are evaluated in the global
+// environment, like initforms. Slots the list does not name, and optional
+// or key variables without a default or an argument, get their initform.
+// keys is not nil when the list has &key.
+type boaList struct {
+	params []boaParam
+	keys   []string
+	rest   bool
+}
+
+// A boaParam is a variable of a boaList: the slot it fills, the lambda list
+// keyword it follows, if any, its keyword, for &key, and its default form.
+type boaParam struct {
+	slot int
+	kind string
+	key  string
+	init *analysis
+}
+
+// isSubtype checks if t is the type parent or includes it, directly or indirectly.
+func (t *structType) isSubtype(parent *structType) bool {
+	for ; t != nil; t = t.parent {
+		if t == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// isNamed checks if t or a type it includes has the given name.
+func (t *structType) isNamed(name string) bool {
+	for ; t != nil; t = t.parent {
+		if strings.EqualFold(t.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// slotIndex returns the index of the named slot, or -1 if there is none.
+func (t *structType) slotIndex(name string) int {
+	for i, s := range t.slots {
+		if strings.EqualFold(s.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// myEvalDefstruct evaluates a defstruct form, defining a structure type and
+// its constructor, accessors, predicate and copier. The first argument is the
+// name, or a list of the name and options (:conc-name, :constructor, which
+// may be given several times and with a BOA argument list, :predicate,
+// :copier and :include); the rest are slot descriptions, each a
+// symbol or a list (name initform [:read-only flag] [:type type]).
+func (in *Interpreter) myEvalDefstruct(args []interface{}) interface{} {
+	if len(args) < 1 {
+		panic("defstruct: must have (defstruct name slots...)")
+	}
+	var options []interface{}
+	nameSpec := args[0]
+	if spec, ok := listElements(args[0]); ok && len(spec) > 0 {
+		nameSpec, options = spec[0], spec[1:]
+	}
+	name, ok := nameSpec.(string)
+	if !ok {
+		panic("defstruct: name must be a symbol")
+	}
+	typ := &structType{name: name}
+	concName := name + "-"
+	predicate, copier := name+"-p", "copy-"+name
+	// constructors holds the constructors named by :constructor options, and
+	// their BOA argument lists, if any. Without one there is a keyword
+	// constructor, make-name.
+	type constructorOption struct {
+		name    string
+		boa     interface{}
+		boaList bool
+	}
+	var constructors []constructorOption
+	constructorGiven := false
+	for _, o := range options {
+		opt := toList(o)
+		if len(opt) == 0 {
+			panic("defstruct: invalid option " + toLispString(o))
+		}
+		key, _ := opt[0].(string)
+		// A missing option value, as in (:conc-name) or :conc-name alone, is NIL.
+		var value interface{}
+		if len(opt) > 1 {
+			value = opt[1]
+		}
+		switch strings.ToUpper(key) {
+		case ":CONC-NAME":
+			concName = ""
+			if !isNil(value) {
+				concName = stringDesignator(value, "defstruct: :conc-name must be a symbol")
+			}
+		case ":CONSTRUCTOR":
+			constructorGiven = true
+			if len(opt) > 3 {
+				panic("defstruct: invalid option " + toLispString(o))
+			}
+			if constructor := optionName(value, len(opt) > 1, "make-"+name); constructor != "" {
+				c := constructorOption{name: constructor, boaList: len(opt) == 3}
+				if c.boaList {
+					c.boa = opt[2]
+				}
+				constructors = append(constructors, c)
+			}
+		case ":PREDICATE":
+			predicate = optionName(value, len(opt) > 1, predicate)
+		case ":COPIER":
+			copier = optionName(value, len(opt) > 1, copier)
+		case ":INCLUDE":
+			parentName, _ := value.(string)
+			parent, ok := in.structs[strings.ToUpper(parentName)]
+			if !ok {
+				panic("defstruct: cannot include unknown structure " + toLispString(value))
+			}
+			typ.parent = parent
+			typ.slots = append(typ.slots, parent.slots...)
+			// Further elements override the initforms of inherited slots.
+			for _, override := range opt[2:] {
+				slot := in.parseSlot(override)
+				i := typ.slotIndex(slot.name)
+				if i < 0 {
+					panic("defstruct: " + parentName + " has no slot " + slot.name)
+				}
+				typ.slots[i] = slot
+			}
+		default:
+			panic("defstruct: unknown option " + toLispString(o))
+		}
+	}
+	for _, s := range args[1:] {
+		if _, isDoc := s.(*lispString); isDoc {
+			continue
+		}
+		slot := in.parseSlot(s)
+		if typ.slotIndex(slot.name) >= 0 {
+			panic("defstruct: duplicate slot " + slot.name)
+		}
+		typ.slots = append(typ.slots, slot)
+	}
+	in.structs[strings.ToUpper(name)] = typ
+
+	if !constructorGiven {
+		constructors = []constructorOption{{name: "make-" + name}}
+	}
+	for _, c := range constructors {
+		f := &structFunction{name: c.name, kind: structConstructor, typ: typ}
+		if c.boaList {
+			f.boa = in.parseBOAList(typ, c.boa)
+		}
+		in.globals[c.name] = f
+	}
+	if predicate != "" {
+		in.globals[predicate] = &structFunction{name: predicate, kind: structPredicate, typ: typ}
+	}
+	if copier != "" {
+		in.globals[copier] = &structFunction{name: copier, kind: structCopier, typ: typ}
+	}
+	for i, s := range typ.slots {
+		accessor := concName + s.name
+		in.globals[accessor] = &structFunction{name: accessor, kind: structAccessor, typ: typ, slot: i}
+	}
+	return name
+}
+
+// optionName returns the function name given by a defstruct option, the
+// default when the option has no value, or "" when the value is NIL.
+func optionName(value interface{}, given bool, def string) string {
+	if !given {
+		return def
+	}
+	if isNil(value) {
+		return ""
+	}
+	return stringDesignator(value, "defstruct: function names must be symbols")
+}
+
+// parseBOAList parses the argument list of a BOA constructor for typ.
+func (in *Interpreter) parseBOAList(typ *structType, x interface{}) *boaList {
+	elems, ok := listElements(x)
+	if !ok {
+		panic("defstruct: a constructor's argument list must be a list")
+	}
+	boa := &boaList{}
+	kind := ""
+	for _, e := range elems {
+		if sym, ok := e.(string); ok {
+			switch up := strings.ToUpper(sym); up {
+			case "&OPTIONAL", "&REST", "&KEY", "&AUX":
+				if up == "&KEY" && boa.keys == nil {
+					boa.keys = []string{}
+				}
+				kind = up
+				continue
+			}
+		}
+		p := boaParam{kind: kind}
+		var varName string
+		if spec, ok := listElements(e); ok && len(spec) > 0 && kind != "" && kind != "&REST" {
+			if len(spec) > 2 {
+				panic("defstruct: invalid constructor argument " + toLispString(e))
+			}
+			varName = symbolArg(spec[0], "defstruct: constructor arguments must be symbols")
+			if len(spec) == 2 {
+				p.init = in.globalScope().analyze(spec[1])
+			}
+		} else {
+			varName = symbolArg(e, "defstruct: constructor arguments must be symbols")
+		}
+		if p.slot = typ.slotIndex(varName); p.slot < 0 {
+			panic("defstruct: " + typ.name + " has no slot " + varName)
+		}
+		switch kind {
+		case "&REST":
+			boa.rest = true
+		case "&KEY":
+			p.key = strings.ToUpper(varName)
+			boa.keys = append(boa.keys, p.key)
+		}
+		boa.params = append(boa.params, p)
+	}
+	return boa
+}
+
+// parseSlot parses a slot description: a symbol, or (name initform options...).
+// The initform is evaluated in the global environment.
+func (in *Interpreter) parseSlot(s interface{}) structSlot {
+	if name, ok := s.(string); ok {
+		return structSlot{name: name, init: constantAnalysis(nil)}
+	}
+	spec, ok := listElements(s)
+	if !ok || len(spec) == 0 {
+		panic("defstruct: invalid slot " + toLispString(s))
+	}
+	name, ok := spec[0].(string)
+	if !ok {
+		panic("defstruct: slot name must be a symbol")
+	}
+	slot := structSlot{name: name}
+	if len(spec) > 1 {
+		slot.initform = spec[1]
+	}
+	if len(spec) > 2 {
+		kwargs := keywordArgs("defstruct", spec[2:], "TYPE", "READ-ONLY")
+		slot.readOnly = !isNil(kwargs["READ-ONLY"])
+	}
+	slot.init = in.globalScope().analyze(slot.initform)
+	return slot
+}
+
+// newStructInstance creates an instance of typ from keyword arguments naming
+// its slots. Slots without an argument get the value of their initform.
+func (in *Interpreter) newStructInstance(name string, typ *structType, args []interface{}) *structInstance {
+	allowed := make([]string, len(typ.slots))
+	for i, s := range typ.slots {
+		allowed[i] = strings.ToUpper(s.name)
+	}
+	kwargs := keywordArgs(name, args, allowed...)
+	inst := &structInstance{typ: typ, values: make([]interface{}, len(typ.slots))}
+	for i, s := range typ.slots {
+		if v, ok := kwargs[allowed[i]]; ok {
+			inst.values[i] = v
+		} else {
+			inst.values[i] = in.evalCode(s.init, nil)
+		}
+	}
+	return inst
+}
+
+// newBOAInstance creates an instance of the type of the BOA constructor f
+// from its arguments.
+func (in *Interpreter) newBOAInstance(f *structFunction, args []interface{}) *structInstance {
+	typ := f.typ
+	inst := &structInstance{typ: typ, values: make([]interface{}, len(typ.slots))}
+	set := make([]bool, len(typ.slots))
+	next := 0
+	var kwargs map[string]interface{}
+	for _, p := range f.boa.params {
+		var v interface{}
+		switch p.kind {
+		case "":
+			if next == len(args) {
+				panic(f.name + ": too few arguments")
+			}
+			v = args[next]
+			next++
+		case "&OPTIONAL":
+			switch {
+			case next < len(args):
+				v = args[next]
+				next++
+			case p.init != nil:
+				v = in.evalCode(p.init, nil)
+			default:
+				continue
+			}
+		case "&REST":
+			// The rest list and the keyword arguments share the arguments left.
+			v = makeList(args[next:]...)
+		case "&KEY":
+			if kwargs == nil {
+				kwargs = keywordArgs(f.name, args[next:], f.boa.keys...)
+			}
+			if kv, ok := kwargs[p.key]; ok {
+				v = kv
+			} else if p.init != nil {
+				v = in.evalCode(p.init, nil)
+			} else {
+				continue
+			}
+		case "&AUX":
+			if p.init != nil {
+				v = in.evalCode(p.init, nil)
+			}
+		}
+		inst.values[p.slot], set[p.slot] = v, true
+	}
+	switch {
+	case f.boa.keys != nil && kwargs == nil:
+		keywordArgs(f.name, args[next:], f.boa.keys...)
+	case next < len(args) && !f.boa.rest && f.boa.keys == nil:
+		panic(f.name + ": too many arguments")
+	}
+	for i, s := range typ.slots {
+		if !set[i] {
+			inst.values[i] = in.evalCode(s.init, nil)
+		}
+	}
+	return inst
+}
+
+// structArg checks that x is an instance of typ or one of its subtypes.
+func structArg(x interface{}, typ *structType, fname string) *structInstance {
+	inst, ok := x.(*structInstance)
+	if !ok || !inst.typ.isSubtype(typ) {
+		panic(fname + ": " + toLispString(x) + " is not a " + typ.name)
+	}
+	return inst
+}
+
+// applyStructFunction applies a function generated by defstruct.
+func (in *Interpreter) applyStructFunction(f *structFunction, args []interface{}) interface{} {
+	switch f.kind {
+	case structConstructor:
+		if f.boa != nil {
+			return in.newBOAInstance(f, args)
+		}
+		return in.newStructInstance(f.name, f.typ, args)
+	case structPredicate:
+		if len(args) != 1 {
+			panic(f.name + " expects 1 argument")
+		}
+		inst, ok := args[0].(*structInstance)
+		return boolToT(ok && inst.typ.isSubtype(f.typ))
+	case structCopier:
+		if len(args) != 1 {
+			panic(f.name + " expects 1 argument")
+		}
+		return copyStruct(structArg(args[0], f.typ, f.name))
+	}
+	if len(args) != 1 {
+		panic(f.name + " expects 1 argument")
+	}
+	return structArg(args[0], f.typ, f.name).values[f.slot]
+}
+
+// setStructSlot stores value in the slot read by the accessor f.
+func setStructSlot(f *structFunction, obj, value interface{}) interface{} {
+	if f.typ.slots[f.slot].readOnly {
+		panic("setf: slot " + f.typ.slots[f.slot].name + " of " + f.typ.name + " is read-only")
+	}
+	structArg(obj, f.typ, f.name).values[f.slot] = value
+	return value
+}
+
+// copyStruct returns a shallow copy of a structure instance.
+func copyStruct(inst *structInstance) *structInstance {
+	return &structInstance{typ: inst.typ, values: append([]interface{}(nil), inst.values...)}
+}
+
+// readStructLiteral builds the structure denoted by #S(name :slot value...).
+// The slot values are not evaluated. Structure types belong to an
+// interpreter, so there must be one to read them in.
+func readStructLiteral(in *Interpreter, contents interface{}) *structInstance {
+	spec, ok := listElements(contents)
+	if !ok || len(spec) == 0 {
+		panic("#S expects (name :slot value...)")
+	}
+	name, _ := spec[0].(string)
+	if in == nil {
+		panic("#S: structures can only be read by an interpreter")
+	}
+	typ, ok := in.structs[strings.ToUpper(name)]
+	if !ok {
+		panic("#S: unknown structure " + toLispString(spec[0]))
+	}
+	return in.newStructInstance("#S", typ, spec[1:])
+}
+
+// formatStruct prints a structure instance in #S(name :slot value...) syntax.
+func (p *printer) formatStruct(inst *structInstance) string {
+	parts := []string{inst.typ.name}
+	for i, s := range inst.typ.slots {
+		parts = append(parts, ":"+s.name, p.printObject(inst.values[i]))
+	}
+	return "#S(" + strings.Join(parts, " ") + ")"
+}
+
+// equalpStructs checks if two structures have the same type and EQUALP slots.
+func equalpStructs(a, b *structInstance) bool {
+	if a.typ != b.typ {
+		return false
+	}
+	for i := range a.values {
+		if !equalFold(a.values[i], b.values[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package lisp
+
+import (
+	"strings"
+)
+
+// symbolArg checks that x is a symbol, panicking with msg otherwise.
+func symbolArg(x interface{}, msg string) string {
+	sym, ok := x.(string)
+	if !ok {
+		panic(msg)
+	}
+	return sym
+}
+
+// getProperty returns the value of the indicator on a symbol's property list
+// and whether it was present. Indicators are compared with EQ. The property
+// lists are kept in the interpreter's plists, keyed by the upper-case symbol
+// name, as flat lists of indicator/value pairs.
+func (in *Interpreter) getProperty(sym string, indicator interface{}) (interface{}, bool) {
+	plist := in.plists[strings.ToUpper(sym)]
+	for i := 0; i+1 < len(plist); i += 2 {
+		if eqlp(plist[i], indicator) {
+			return plist[i+1], true
+		}
+	}
+	return nil, false
+}
+
+// putProperty sets the value of the indicator on a symbol's property list.
+func (in *Interpreter) putProperty(sym string, indicator, value interface{}) interface{} {
+	key := strings.ToUpper(sym)
+	plist := in.plists[key]
+	for i := 0; i+1 < len(plist); i += 2 {
+		if eqlp(plist[i], indicator) {
+			plist[i+1] = value
+			return value
+		}
+	}
+	in.plists[key] = append(plist, indicator, value)
+	return value
+}
+
+// removeProperty removes the indicator from a symbol's property list,
+// reporting whether it was present.
+func (in *Interpreter) removeProperty(sym string, indicator interface{}) bool {
+	key := strings.ToUpper(sym)
+	plist := in.plists[key]
+	for i := 0; i+1 < len(plist); i += 2 {
+		if eqlp(plist[i], indicator) {
+			in.plists[key] = append(plist[:i:i], plist[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// symbolValue returns the global value of a symbol.
+func (in *Interpreter) symbolValue(sym string) interface{} {
+	if isKeyword(sym) || strings.EqualFold(sym, "T") {
+		return sym
+	}
+	if strings.EqualFold(sym, "NIL") {
+		return nil
+	}
+	if v, ok := in.globals[sym]; ok {
+		return v
+	}
+	panic("symbol-value: " + sym + " is unbound")
+}
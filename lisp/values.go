@@ -0,0 +1,36 @@
+package lisp
+
+// multipleValues holds the values of a form that returns more or fewer than
+// one value, such as (values 1 2) or (floor 7 2). It only travels from a
+// form to the construct that receives its values: myEvalValues returns it,
+// and everything that needs a single value takes the primary one with
+// primary, so it never appears as an ordinary Lisp object.
+type multipleValues []interface{}
+
+// values returns vals as the values of a form: the value itself when there
+// is exactly one, and a multipleValues otherwise.
+func values(vals ...interface{}) interface{} {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return multipleValues(vals)
+}
+
+// primary returns the primary value of a result, or NIL when there are no values.
+func primary(x interface{}) interface{} {
+	if mv, ok := x.(multipleValues); ok {
+		if len(mv) == 0 {
+			return nil
+		}
+		return mv[0]
+	}
+	return x
+}
+
+// valuesOf returns all the values of a result as a slice.
+func valuesOf(x interface{}) []interface{} {
+	if mv, ok := x.(multipleValues); ok {
+		return mv
+	}
+	return []interface{}{x}
+}